@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// --- RECHERCHE D'ENTREPRISES PAR LOT ---
+
+// Nombre maximal d'identifiants par requête de lot
+const maxBatchIDs = 100
+
+// Recherches simultanées d'un lot, et délai global du lot : il doit rester
+// inférieur à HTTP_WRITE_TIMEOUT (60s par défaut) pour que la réponse ne
+// soit pas coupée en cours d'écriture
+const (
+	batchConcurrency = 8
+	batchTimeout     = 40 * time.Second
+)
+
+// Corps de POST /api/entreprise/batch
+type EntrepriseBatchRequest struct {
+	IDs []string `json:"ids"` // SIREN ou SIRET
+}
+
+// Résultat d'une ligne du lot : entreprise trouvée ou erreur
+type EntrepriseBatchResult struct {
+	Numid      string              `json:"numid"`
+	Entreprise *EntrepriseResponse `json:"entreprise,omitempty"`
+	Error      string              `json:"error,omitempty"`
+}
+
+type EntrepriseBatchResponse struct {
+	Results []EntrepriseBatchResult `json:"results"`
+}
+
+// Colonnes de l'export CSV (?format=csv)
+var batchCSVHeader = []string{"siren", "denomination", "ville", "code_postal", "tva", "error"}
+
+// entrepriseBatchHandler résout une liste de SIREN/SIRET. Les erreurs sont
+// reportées ligne par ligne sans faire échouer le lot. Avec ?format=csv,
+// le résultat est envoyé en CSV au fil des recherches.
+func entrepriseBatchHandler(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeError(w, http.StatusBadRequest, "INVALID_FORMAT", "Le paramètre 'format' doit valoir json ou csv")
+		return
+	}
+
+	var req EntrepriseBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", "Requête trop volumineuse")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "JSON invalide")
+		return
+	}
+
+	if len(req.IDs) == 0 {
+		writeError(w, http.StatusBadRequest, "MISSING_IDS", "Le champ 'ids' doit contenir au moins un SIREN ou SIRET")
+		return
+	}
+	if len(req.IDs) > maxBatchIDs {
+		writeError(w, http.StatusBadRequest, "TOO_MANY_IDS", fmt.Sprintf("%d identifiants maximum par lot", maxBatchIDs))
+		return
+	}
+
+	logger.Info("recherche entreprise par lot", "route", "/api/entreprise/batch", "count", len(req.IDs), "format", format)
+
+	ctx, cancel := context.WithTimeout(r.Context(), batchTimeout)
+	defer cancel()
+	results := lookupBatch(ctx, req.IDs)
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="entreprises.csv"`)
+		w.WriteHeader(http.StatusOK)
+
+		// Lignes écrites dans l'ordre des identifiants, dès qu'elles sont prêtes
+		cw := csv.NewWriter(w)
+		cw.Write(batchCSVHeader)
+		for _, res := range results {
+			cw.Write((<-res).csvRecord())
+			cw.Flush()
+		}
+		if err := cw.Error(); err != nil {
+			logger.Warn("export CSV interrompu", "route", "/api/entreprise/batch", "error", err)
+		}
+		return
+	}
+
+	resp := EntrepriseBatchResponse{Results: make([]EntrepriseBatchResult, 0, len(req.IDs))}
+	for _, res := range results {
+		resp.Results = append(resp.Results, <-res)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// lookupBatch lance les recherches du lot, au plus batchConcurrency à la
+// fois. Le résultat de ids[i] est disponible sur le i-ème canal.
+func lookupBatch(ctx context.Context, ids []string) []chan EntrepriseBatchResult {
+	results := make([]chan EntrepriseBatchResult, len(ids))
+	for i := range results {
+		results[i] = make(chan EntrepriseBatchResult, 1)
+	}
+
+	slots := make(chan struct{}, batchConcurrency)
+	go func() {
+		for i, raw := range ids {
+			slots <- struct{}{}
+			go func() {
+				defer func() { <-slots }()
+				results[i] <- lookupBatchEntry(ctx, raw)
+			}()
+		}
+	}()
+	return results
+}
+
+// lookupBatchEntry recherche une entreprise du lot (via le cache)
+func lookupBatchEntry(ctx context.Context, raw string) EntrepriseBatchResult {
+	result := EntrepriseBatchResult{Numid: raw}
+
+	numid, err := parseNumid(raw, numidAny)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Numid = numid
+
+	cacheKey := fmt.Sprintf("%s|%+v", numid, allEntrepriseFields)
+	data, err := entrepriseCache.lookup(ctx, cacheKey, func(ctx context.Context) (*EntrepriseResponse, error) {
+		return companyProvider.Lookup(ctx, numid, allEntrepriseFields)
+	})
+	switch {
+	case errors.Is(err, errEntrepriseIntrouvable):
+		result.Error = "Entreprise inconnue"
+	case errors.Is(err, context.DeadlineExceeded):
+		result.Error = "Délai du lot dépassé"
+	case err != nil:
+		loggerFromContext(ctx).Error("échec recherche entreprise", "route", "/api/entreprise/batch", "numid", numid, "error", err)
+		result.Error = "Erreur lors de l'appel à l'API entreprise"
+	default:
+		result.Entreprise = data
+	}
+	return result
+}
+
+// csvRecord convertit un résultat en ligne CSV (voir batchCSVHeader)
+func (res EntrepriseBatchResult) csvRecord() []string {
+	if res.Entreprise == nil {
+		return []string{res.Numid, "", "", "", "", res.Error}
+	}
+
+	e := res.Entreprise
+	var ville, codePostal string
+	if e.AdressePostaleLegale != nil {
+		ville, codePostal = e.AdressePostaleLegale.Ville, e.AdressePostaleLegale.CodePostal
+	}
+	return []string{e.Siren, e.Denomination, ville, codePostal, e.Tva, res.Error}
+}
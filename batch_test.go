@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// batchBody construit le corps d'une requête de lot de n identifiants
+func batchBody(n int) string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%q", "552032534")
+	}
+	return `{"ids":[` + strings.Join(ids, ",") + `]}`
+}
+
+func TestEntrepriseBatchBodyLimit(t *testing.T) {
+	useStubProvider(t, danone)
+	handler := newTestHandler(t)
+	previous := maxBodyBytes
+	maxBodyBytes = 512
+	t.Cleanup(func() { maxBodyBytes = previous })
+
+	body := batchBody(60) // environ 800 octets
+	if len(body) <= 512 {
+		t.Fatalf("corps de test trop petit (%d octets)", len(body))
+	}
+
+	// Content-Length connu : refus avant lecture
+	r := httptest.NewRequest(http.MethodPost, "/api/entreprise/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge || decodeAPIError(t, w).Code != "REQUEST_TOO_LARGE" {
+		t.Errorf("Content-Length trop grand : statut = %d (%s), attendu 413 REQUEST_TOO_LARGE", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, attendu une erreur JSON", ct)
+	}
+
+	// Corps envoyé par morceaux : la lecture s'interrompt à la limite
+	r = httptest.NewRequest(http.MethodPost, "/api/entreprise/batch", io.NopCloser(strings.NewReader(body)))
+	r.ContentLength = -1
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge || decodeAPIError(t, w).Code != "REQUEST_TOO_LARGE" {
+		t.Errorf("corps sans Content-Length : statut = %d (%s), attendu 413 REQUEST_TOO_LARGE", w.Code, w.Body)
+	}
+
+	// Sous la limite : traité normalement
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/entreprise/batch", strings.NewReader(batchBody(2))))
+	if w.Code != http.StatusOK {
+		t.Errorf("petit lot : statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+}
+
+func TestBodyLimitFor(t *testing.T) {
+	t.Setenv("MAX_ATTACHMENT_BYTES", "3000000")
+	t.Setenv("MAX_TOTAL_ATTACHMENT_BYTES", "3000000")
+
+	for _, path := range []string{"/api/send-email", "/api/email/preview", "/Send/"} {
+		if got := bodyLimitFor(path); got != emailMaxBodyBytes() || got <= 4000000 {
+			t.Errorf("bodyLimitFor(%q) = %d, attendu la limite des emails (%d)", path, got, emailMaxBodyBytes())
+		}
+	}
+	for _, path := range []string{"/api/entreprise/batch", "/api/email/validate", "/api/entreprise"} {
+		if got := bodyLimitFor(path); got != maxBodyBytes {
+			t.Errorf("bodyLimitFor(%q) = %d, attendu MAX_BODY_BYTES (%d)", path, got, maxBodyBytes)
+		}
+	}
+}
+
+func TestEntrepriseBatchCSV(t *testing.T) {
+	// Le premier identifiant répond le dernier : l'ordre des lignes doit
+	// rester celui de la requête
+	useStubProvider(t, func(ctx context.Context, numid string, fields entrepriseFields) (*EntrepriseResponse, error) {
+		if numid == "552032534" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		if numid == "356000000" {
+			return &EntrepriseResponse{Siren: "356000000", Denomination: "LA POSTE", Tva: "FR39356000000"}, nil
+		}
+		return danone(ctx, numid, fields)
+	})
+
+	body := `{"ids":["552 032 534","356000000","552032535","732829320"]}`
+	w := serve(entrepriseBatchHandler, http.MethodPost, "/api/entreprise/batch?format=csv", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s)", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="entreprises.csv"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV illisible: %v", err)
+	}
+	want := [][]string{
+		{"siren", "denomination", "ville", "code_postal", "tva", "error"},
+		{"552032534", "DANONE", "PARIS", "75009", "FR27552032534", ""},
+		{"356000000", "LA POSTE", "", "", "FR39356000000", ""},
+		{"552032535", "", "", "", "", "SIREN/SIRET invalide (clé de contrôle incorrecte)"},
+		{"732829320", "", "", "", "", "Entreprise inconnue"},
+	}
+	if !slices.EqualFunc(records, want, slices.Equal) {
+		t.Errorf("CSV =\n%q\nattendu\n%q", records, want)
+	}
+}
+
+func TestEntrepriseBatchJSON(t *testing.T) {
+	useStubProvider(t, danone)
+
+	w := serve(entrepriseBatchHandler, http.MethodPost, "/api/entreprise/batch", `{"ids":["552032534","552032535"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s)", w.Code, w.Body)
+	}
+	var resp EntrepriseBatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("réponse illisible: %v", err)
+	}
+	if len(resp.Results) != 2 || resp.Results[0].Entreprise == nil || resp.Results[1].Error == "" {
+		t.Errorf("résultats = %+v, attendu une entreprise puis une erreur", resp.Results)
+	}
+
+	for body, code := range map[string]string{
+		`{"ids":[]}`:   "MISSING_IDS",
+		batchBody(101): "TOO_MANY_IDS",
+		`{"ids":`:      "INVALID_JSON",
+	} {
+		w := serve(entrepriseBatchHandler, http.MethodPost, "/api/entreprise/batch", body)
+		if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != code {
+			t.Errorf("statut = %d (%s), attendu 400 %s", w.Code, w.Body, code)
+		}
+	}
+	if w := serve(entrepriseBatchHandler, http.MethodPost, "/api/entreprise/batch?format=xml", `{"ids":["552032534"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("format=xml : statut = %d, attendu 400", w.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// --- DISJONCTEUR (CIRCUIT BREAKER) ---
+
+// États du disjoncteur
+const (
+	breakerClosed   = "closed"    // appels normaux
+	breakerOpen     = "open"      // fournisseur considéré en panne : échec immédiat
+	breakerHalfOpen = "half-open" // un seul appel de test autorisé
+)
+
+// circuitOpenError : appel refusé sans contacter le fournisseur, retryAfter
+// indique la fin du délai de refroidissement
+type circuitOpenError struct {
+	provider   string
+	retryAfter time.Duration
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("API %s indisponible (disjoncteur ouvert, réessayer dans %s)", e.provider, e.retryAfter.Round(time.Second))
+}
+
+// circuitBreaker s'ouvre après threshold échecs consécutifs : les appels
+// échouent alors immédiatement pendant cooldown, au lieu d'attendre le
+// timeout du fournisseur. Un appel de test (half-open) décide ensuite de la
+// fermeture ou d'une nouvelle ouverture.
+type circuitBreaker struct {
+	provider  string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(provider string, threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		provider:  provider,
+		threshold: max(threshold, 1),
+		cooldown:  cooldown,
+		state:     breakerClosed,
+	}
+}
+
+var societeBreaker = newCircuitBreaker(
+	"societe.com",
+	envInt("CIRCUIT_BREAKER_THRESHOLD", 5),
+	envDuration("CIRCUIT_BREAKER_COOLDOWN", 30*time.Second),
+)
+
+// allow indique si un appel peut partir, ou retourne *circuitOpenError
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		remaining := b.cooldown - time.Since(b.openedAt)
+		if remaining > 0 {
+			return &circuitOpenError{provider: b.provider, retryAfter: remaining}
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		// Un appel de test est déjà en cours
+		if b.probing {
+			return &circuitOpenError{provider: b.provider, retryAfter: time.Second}
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record comptabilise le résultat d'un appel autorisé par allow
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	// Client déconnecté : résultat inconnu, l'état ne change pas
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if !isBreakerFailure(err) {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.setState(breakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+// setState change l'état (verrou tenu par l'appelant) et journalise la transition
+func (b *circuitBreaker) setState(state string) {
+	slog.Warn("disjoncteur fournisseur", "provider", b.provider, "from", b.state, "to", state, "failures", b.failures)
+	b.state = state
+}
+
+// isBreakerFailure : seules les pannes du fournisseur (5xx, réseau, timeout)
+// ouvrent le disjoncteur. Une entreprise introuvable, un quota dépassé ou la
+// déconnexion du client ne comptent pas comme des échecs.
+func isBreakerFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusErr *upstreamStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status >= 500
+	}
+	return isRetryableUpstreamError(err) || isUpstreamTimeout(err)
+}
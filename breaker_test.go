@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errUpstreamDown = &upstreamStatusError{status: http.StatusServiceUnavailable}
+
+// breakerOpenFor vérifie que allow refuse l'appel avec *circuitOpenError
+func breakerOpenFor(t *testing.T, b *circuitBreaker) {
+	t.Helper()
+	var openErr *circuitOpenError
+	if err := b.allow(); !errors.As(err, &openErr) {
+		t.Fatalf("allow() = %v, attendu *circuitOpenError (état %s)", err, b.state)
+	}
+}
+
+func TestCircuitBreakerStates(t *testing.T) {
+	b := newCircuitBreaker("test", 3, 20*time.Millisecond)
+
+	// Fermé : les échecs sous le seuil laissent passer les appels
+	for range 2 {
+		if err := b.allow(); err != nil {
+			t.Fatalf("allow() = %v, attendu nil (fermé)", err)
+		}
+		b.record(errUpstreamDown)
+	}
+	if b.state != breakerClosed {
+		t.Fatalf("état = %s après 2 échecs, attendu closed", b.state)
+	}
+
+	// Seuil atteint : ouvert, échec immédiat
+	b.allow()
+	b.record(errUpstreamDown)
+	if b.state != breakerOpen {
+		t.Fatalf("état = %s après 3 échecs, attendu open", b.state)
+	}
+	breakerOpenFor(t, b)
+
+	// Fin du refroidissement : un seul appel de test (half-open)
+	time.Sleep(25 * time.Millisecond)
+	if err := b.allow(); err != nil || b.state != breakerHalfOpen {
+		t.Fatalf("allow() = %v, état = %s, attendu l'appel de test en half-open", err, b.state)
+	}
+	breakerOpenFor(t, b)
+
+	// Appel de test en échec : nouvelle ouverture sans attendre le seuil
+	b.record(errUpstreamDown)
+	if b.state != breakerOpen {
+		t.Fatalf("état = %s après l'échec de l'appel de test, attendu open", b.state)
+	}
+
+	// Appel de test réussi : fermeture et compteur remis à zéro
+	time.Sleep(25 * time.Millisecond)
+	b.allow()
+	b.record(nil)
+	if b.state != breakerClosed || b.failures != 0 {
+		t.Fatalf("état = %s, échecs = %d, attendu closed sans échec", b.state, b.failures)
+	}
+	b.record(errUpstreamDown)
+	if b.state != breakerClosed {
+		t.Errorf("état = %s après un seul échec, attendu closed", b.state)
+	}
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	b := newCircuitBreaker("test", 1, time.Minute)
+	for _, err := range []error{
+		&upstreamStatusError{status: http.StatusNotFound},
+		&upstreamRateLimitError{},
+		context.Canceled,
+		fmt.Errorf("lecture : %w", context.Canceled),
+	} {
+		b.allow()
+		b.record(err)
+		if b.state != breakerClosed {
+			t.Fatalf("%v : état = %s, attendu closed (pas une panne du fournisseur)", err, b.state)
+		}
+	}
+
+	b.allow()
+	b.record(context.DeadlineExceeded)
+	if b.state != breakerOpen {
+		t.Errorf("timeout : état = %s, attendu open", b.state)
+	}
+}
+
+func TestEntrepriseCircuitOpen(t *testing.T) {
+	useSocieteProvider(t)
+	useFreshCompanyCache(t)
+	var calls atomic.Int64
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	societeBreaker = newCircuitBreaker("societe.com", 2, time.Minute)
+
+	for range 2 {
+		if w := serve(entrepriseHandler, http.MethodGet, "/api/entreprise/552032534", ""); w.Code == http.StatusOK {
+			t.Fatalf("fournisseur en panne : statut 200")
+		}
+	}
+	before := calls.Load()
+
+	w := serve(entrepriseHandler, http.MethodGet, "/api/entreprise/552032534", "")
+	if w.Code != http.StatusServiceUnavailable || decodeAPIError(t, w).Code != "UPSTREAM_UNAVAILABLE" {
+		t.Fatalf("disjoncteur ouvert : statut = %d (%s), attendu 503 UPSTREAM_UNAVAILABLE", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, attendu 60 (fin du refroidissement)", got)
+	}
+	if n := calls.Load(); n != before {
+		t.Errorf("%d appels au fournisseur avec le disjoncteur ouvert, attendu 0", n-before)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// --- CACHE ENTREPRISES (TTL en mémoire) ---
+//
+// Les entrées sont indexées par numid et données demandées (?fields). Une
+// entrée expirée depuis moins de COMPANY_CACHE_STALE est encore servie
+// immédiatement pendant qu'elle est rafraîchie en arrière-plan
+// (stale-while-revalidate).
+
+// Délai maximal d'un appel partagé au fournisseur (indépendant des clients
+// qui l'attendent)
+const cacheFetchTimeout = 30 * time.Second
+
+// companyCacheEntry stocke soit un résultat, soit une erreur "introuvable"
+// (cache négatif) jusqu'à son expiration
+type companyCacheEntry struct {
+	data      *EntrepriseResponse
+	err       error
+	expiresAt time.Time
+}
+
+type companyCache struct {
+	mu          sync.RWMutex
+	entries     map[string]companyCacheEntry
+	ttl         time.Duration
+	negativeTTL time.Duration
+	staleTTL    time.Duration
+	maxEntries  int // 0 = illimité
+
+	// Un seul appel au fournisseur en cours par clé
+	flights singleflight.Group
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func newCompanyCache(ttl, negativeTTL, staleTTL time.Duration, maxEntries int) *companyCache {
+	c := &companyCache{
+		entries:     make(map[string]companyCacheEntry),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		staleTTL:    staleTTL,
+		maxEntries:  maxEntries,
+	}
+	go c.cleanup()
+	return c
+}
+
+// Cache global utilisé par entrepriseHandler
+var entrepriseCache = newCompanyCache(
+	envDuration("COMPANY_CACHE_TTL", time.Hour),
+	envDuration("COMPANY_CACHE_NEGATIVE_TTL", 5*time.Minute),
+	envDuration("COMPANY_CACHE_STALE", 10*time.Minute),
+	envInt("COMPANY_CACHE_MAX_ENTRIES", 10000),
+)
+
+// cleanup oublie périodiquement les entrées qui ne peuvent plus être servies
+func (c *companyCache) cleanup() {
+	for range time.Tick(time.Minute) {
+		c.sweep(time.Now())
+	}
+}
+
+// sweep supprime les entrées expirées, fenêtre COMPANY_CACHE_STALE comprise
+// (le cache négatif n'en bénéficie pas)
+func (c *companyCache) sweep(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweepLocked(now)
+}
+
+func (c *companyCache) sweepLocked(now time.Time) {
+	for key, e := range c.entries {
+		limit := e.expiresAt
+		if e.err == nil {
+			limit = limit.Add(c.staleTTL)
+		}
+		if !now.Before(limit) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// get retourne l'entrée valide pour key. stale indique une entrée expirée
+// mais encore servable (résultats trouvés uniquement, pas le cache négatif).
+func (c *companyCache) get(key string) (entry companyCacheEntry, stale, ok bool) {
+	c.mu.RLock()
+	entry, ok = c.entries[key]
+	c.mu.RUnlock()
+
+	now := time.Now()
+	switch {
+	case !ok:
+		return companyCacheEntry{}, false, false
+	case now.Before(entry.expiresAt):
+		return entry, false, true
+	case entry.err == nil && now.Before(entry.expiresAt.Add(c.staleTTL)):
+		return entry, true, true
+	default:
+		return companyCacheEntry{}, false, false
+	}
+}
+
+// set mémorise un résultat ; seules les erreurs "introuvable" sont mises en
+// cache (les erreurs techniques doivent pouvoir être retentées)
+func (c *companyCache) set(key string, data *EntrepriseResponse, err error) {
+	ttl := c.ttl
+	if err != nil {
+		if !errors.Is(err, errEntrepriseIntrouvable) {
+			return
+		}
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Cache plein (COMPANY_CACHE_MAX_ENTRIES) : on libère d'abord les entrées
+	// expirées, puis des entrées quelconques si cela ne suffit pas
+	if _, exists := c.entries[key]; !exists && c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.sweepLocked(time.Now())
+		for k := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = companyCacheEntry{data: data, err: err, expiresAt: time.Now().Add(ttl)}
+}
+
+// lookup retourne l'entrée en cache si elle est valide, sinon appelle fetch
+// et mémorise son résultat. Une entrée périmée est retournée telle quelle et
+// rafraîchie en arrière-plan.
+func (c *companyCache) lookup(ctx context.Context, key string, fetch func(ctx context.Context) (*EntrepriseResponse, error)) (*EntrepriseResponse, error) {
+	if entry, stale, ok := c.get(key); ok {
+		c.hits.Add(1)
+		if stale {
+			c.refreshInBackground(key, fetch)
+		}
+		if entry.data == nil {
+			return nil, entry.err
+		}
+		// Copie : l'entrée en cache reste partagée
+		cached := *entry.data
+		cached.Fresh = false
+		return &cached, entry.err
+	}
+	c.misses.Add(1)
+
+	// Chaque appelant n'attend que le temps de sa propre requête
+	ch := c.fetchShared(ctx, key, fetch)
+	select {
+	case res := <-ch:
+		data, _ := res.Val.(*EntrepriseResponse)
+		return data, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetchShared appelle fetch et mémorise son résultat. Les appels simultanés
+// pour une même clé (requêtes identiques, rafraîchissement) partagent un
+// seul appel au fournisseur, qui n'est pas annulé si le premier client se
+// déconnecte.
+func (c *companyCache) fetchShared(ctx context.Context, key string, fetch func(ctx context.Context) (*EntrepriseResponse, error)) <-chan singleflight.Result {
+	return c.flights.DoChan(key, func() (any, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheFetchTimeout)
+		defer cancel()
+
+		data, err := fetch(fetchCtx)
+		if data != nil {
+			data.CachedAt, data.Fresh = time.Now(), true
+		}
+		c.set(key, data, err)
+		return data, err
+	})
+}
+
+// refreshInBackground relance fetch pour key sans bloquer l'appelant
+func (c *companyCache) refreshInBackground(key string, fetch func(ctx context.Context) (*EntrepriseResponse, error)) {
+	ch := c.fetchShared(context.Background(), key, fetch)
+	go func() {
+		// En cas d'échec, l'entrée périmée reste servie jusqu'à la fin de la fenêtre
+		if res := <-ch; res.Err != nil && !errors.Is(res.Err, errEntrepriseIntrouvable) {
+			slog.Warn("rafraîchissement du cache entreprise impossible", "key", key, "error", res.Err)
+		}
+	}()
+}
+
+// stats expose les compteurs du cache pour /info
+func (c *companyCache) stats() map[string]int64 {
+	c.mu.RLock()
+	size := len(c.entries)
+	c.mu.RUnlock()
+
+	return map[string]int64{
+		"hits":    c.hits.Load(),
+		"misses":  c.misses.Load(),
+		"entries": int64(size),
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fetchReturning retourne une fonction fetch qui compte ses appels
+func fetchReturning(calls *atomic.Int64, data *EntrepriseResponse, err error) func(context.Context) (*EntrepriseResponse, error) {
+	return func(context.Context) (*EntrepriseResponse, error) {
+		calls.Add(1)
+		if data == nil {
+			return nil, err
+		}
+		copied := *data
+		return &copied, err
+	}
+}
+
+func TestCompanyCacheHitAndExpiry(t *testing.T) {
+	c := newCompanyCache(50*time.Millisecond, time.Minute, 0, 0)
+	var calls atomic.Int64
+	fetch := fetchReturning(&calls, &EntrepriseResponse{Siren: "552032534"}, nil)
+
+	for range 3 {
+		if _, err := c.lookup(context.Background(), "552032534", fetch); err != nil {
+			t.Fatalf("lookup: %v", err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("fetch appelé %d fois, attendu 1 (entrée en cache)", calls.Load())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.lookup(context.Background(), "552032534", fetch); err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("fetch appelé %d fois, attendu 2 (entrée expirée)", calls.Load())
+	}
+
+	stats := c.stats()
+	if stats["hits"] != 2 || stats["misses"] != 2 {
+		t.Errorf("stats = %v, attendu 2 hits et 2 misses", stats)
+	}
+}
+
+func TestCompanyCacheNegativeAndErrors(t *testing.T) {
+	c := newCompanyCache(time.Hour, time.Hour, 0, 0)
+
+	// Entreprise introuvable : mise en cache (cache négatif)
+	var notFound atomic.Int64
+	fetch := fetchReturning(&notFound, nil, errEntrepriseIntrouvable)
+	for range 2 {
+		if _, err := c.lookup(context.Background(), "a", fetch); !errors.Is(err, errEntrepriseIntrouvable) {
+			t.Fatalf("err = %v, attendu errEntrepriseIntrouvable", err)
+		}
+	}
+	if notFound.Load() != 1 {
+		t.Errorf("fetch appelé %d fois pour une entreprise introuvable, attendu 1", notFound.Load())
+	}
+
+	// Erreur technique : jamais mise en cache
+	var failing atomic.Int64
+	fetch = fetchReturning(&failing, nil, errors.New("panne"))
+	for range 2 {
+		c.lookup(context.Background(), "b", fetch)
+	}
+	if failing.Load() != 2 {
+		t.Errorf("fetch appelé %d fois après une erreur technique, attendu 2", failing.Load())
+	}
+}
+
+func TestCompanyCacheSweep(t *testing.T) {
+	c := newCompanyCache(time.Minute, time.Minute, 10*time.Minute, 0)
+	c.set("trouvee", &EntrepriseResponse{}, nil)
+	c.set("introuvable", nil, errEntrepriseIntrouvable)
+
+	// Après le TTL : l'entrée trouvée reste servable (fenêtre stale), pas
+	// l'entrée négative
+	c.sweep(time.Now().Add(2 * time.Minute))
+	if _, ok := c.entries["trouvee"]; !ok {
+		t.Error("entrée trouvée supprimée pendant la fenêtre COMPANY_CACHE_STALE")
+	}
+	if _, ok := c.entries["introuvable"]; ok {
+		t.Error("entrée négative expirée non supprimée")
+	}
+
+	c.sweep(time.Now().Add(20 * time.Minute))
+	if len(c.entries) != 0 {
+		t.Errorf("%d entrées après expiration complète, attendu 0", len(c.entries))
+	}
+}
+
+func TestCompanyCacheMaxEntries(t *testing.T) {
+	c := newCompanyCache(time.Hour, time.Hour, 0, 3)
+	for i := range 10 {
+		c.set(fmt.Sprint(i), &EntrepriseResponse{}, nil)
+	}
+	if n := len(c.entries); n != 3 {
+		t.Errorf("%d entrées, attendu 3 (COMPANY_CACHE_MAX_ENTRIES)", n)
+	}
+	if _, ok := c.entries["9"]; !ok {
+		t.Error("la dernière entrée ajoutée doit être conservée")
+	}
+}
+
+func TestCompanyCacheConcurrentAccess(t *testing.T) {
+	c := newCompanyCache(time.Hour, time.Hour, 0, 50)
+	var calls atomic.Int64
+
+	var wg sync.WaitGroup
+	for i := range 100 {
+		wg.Go(func() {
+			key := fmt.Sprint(i % 20)
+			fetch := fetchReturning(&calls, &EntrepriseResponse{Siren: key}, nil)
+			got, err := c.lookup(context.Background(), key, fetch)
+			if err != nil || got.Siren != key {
+				t.Errorf("lookup(%s) = %+v, %v", key, got, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n < 20 || n > 100 {
+		t.Errorf("fetch appelé %d fois, attendu entre 20 et 100", n)
+	}
+}
+
+func TestCompanyCacheStaleWhileRevalidate(t *testing.T) {
+	c := newCompanyCache(20*time.Millisecond, time.Minute, time.Hour, 0)
+	var calls atomic.Int64
+	started, release := make(chan struct{}, 10), make(chan struct{})
+	denomination := "DANONE"
+	fetch := func(context.Context) (*EntrepriseResponse, error) {
+		if calls.Add(1) > 1 {
+			started <- struct{}{}
+			<-release // rafraîchissement lent
+		}
+		return &EntrepriseResponse{Siren: "552032534", Denomination: denomination}, nil
+	}
+
+	if _, err := c.lookup(context.Background(), "552032534", fetch); err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	denomination = "DANONE SA"
+
+	// Entrée périmée : servie sans attendre le fournisseur, rafraîchie une
+	// seule fois malgré les lectures simultanées
+	for range 5 {
+		start := time.Now()
+		data, err := c.lookup(context.Background(), "552032534", fetch)
+		if err != nil || data.Denomination != "DANONE" || data.Fresh {
+			t.Fatalf("lecture périmée = %+v, %v, attendu l'ancienne entrée (fresh=false)", data, err)
+		}
+		if d := time.Since(start); d > 10*time.Millisecond {
+			t.Errorf("lecture périmée en %s, attendu immédiate", d)
+		}
+	}
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("aucun rafraîchissement en arrière-plan")
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("fetch appelé %d fois, attendu 2 (un seul rafraîchissement)", n)
+	}
+
+	// Fin du rafraîchissement : nouvelle valeur servie depuis le cache
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		data, _ := c.lookup(context.Background(), "552032534", fetch)
+		if data.Denomination == "DANONE SA" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("entrée jamais rafraîchie")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("fetch appelé %d fois après rafraîchissement, attendu 2", n)
+	}
+}
+
+func TestCompanyCacheStaleLimits(t *testing.T) {
+	ctx := context.Background()
+
+	// Au-delà de COMPANY_CACHE_STALE : appel bloquant au fournisseur
+	c := newCompanyCache(10*time.Millisecond, time.Minute, 10*time.Millisecond, 0)
+	var calls atomic.Int64
+	fetch := fetchReturning(&calls, &EntrepriseResponse{Siren: "552032534"}, nil)
+	c.lookup(ctx, "552032534", fetch)
+	time.Sleep(30 * time.Millisecond)
+	if data, _ := c.lookup(ctx, "552032534", fetch); data == nil || !data.Fresh || calls.Load() != 2 {
+		t.Errorf("hors fenêtre : %+v, %d appels, attendu une réponse fraîche", data, calls.Load())
+	}
+
+	// Cache négatif : jamais servi périmé
+	c = newCompanyCache(time.Minute, 10*time.Millisecond, time.Hour, 0)
+	var notFound atomic.Int64
+	missing := fetchReturning(&notFound, nil, errEntrepriseIntrouvable)
+	c.lookup(ctx, "a", missing)
+	time.Sleep(20 * time.Millisecond)
+	c.lookup(ctx, "a", missing)
+	if n := notFound.Load(); n != 2 {
+		t.Errorf("cache négatif : fetch appelé %d fois, attendu 2", n)
+	}
+
+	// Rafraîchissement en échec : l'entrée périmée reste servie
+	c = newCompanyCache(10*time.Millisecond, time.Minute, time.Hour, 0)
+	c.lookup(ctx, "552032534", fetch)
+	time.Sleep(20 * time.Millisecond)
+	var failures atomic.Int64
+	failing := fetchReturning(&failures, nil, errors.New("panne"))
+	for range 3 {
+		if data, err := c.lookup(ctx, "552032534", failing); err != nil || data == nil {
+			t.Fatalf("rafraîchissement en échec : %v, attendu l'entrée périmée", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if failures.Load() == 0 {
+		t.Error("aucune tentative de rafraîchissement")
+	}
+}
+
+func TestCompanyCacheSingleflight(t *testing.T) {
+	c := newCompanyCache(time.Hour, time.Hour, 0, 0)
+	var calls atomic.Int64
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (*EntrepriseResponse, error) {
+		calls.Add(1)
+		<-release
+		return &EntrepriseResponse{Siren: "552032534"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			if data, err := c.lookup(context.Background(), "552032534", fetch); err != nil || data.Siren != "552032534" {
+				t.Errorf("lookup = %+v, %v", data, err)
+			}
+		})
+	}
+	// Laisse toutes les lectures rejoindre l'appel en cours
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fetch appelé %d fois pour 10 lectures simultanées, attendu 1", n)
+	}
+}
+
+func TestEntrepriseConcurrentLookupsShareUpstreamCall(t *testing.T) {
+	useSocieteProvider(t)
+	useFreshCompanyCache(t)
+	var calls atomic.Int64
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/entreprise/552032534/exist" {
+			http.NotFound(w, r)
+			return
+		}
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"common":{"siren":"552032534","deno":"DANONE","numtva":"FR27552032534","status":"Actif"}}`))
+	})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			w := serve(entrepriseHandler, http.MethodGet, "/api/entreprise/552032534?fields=tva", "")
+			if w.Code != http.StatusOK {
+				t.Errorf("statut = %d (%s)", w.Code, w.Body)
+			}
+		})
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("%d appels à societe.com pour 10 requêtes simultanées, attendu 1", n)
+	}
+}
+
+func TestEntrepriseFreshAndCachedResponses(t *testing.T) {
+	useStubProvider(t, danone)
+
+	before := time.Now()
+	w := serve(entrepriseHandler, http.MethodGet, "/api/entreprise/552032534", "")
+	live := decodeEntreprise(t, w)
+	if !live.Fresh || live.CachedAt.Before(before) || live.CachedAt.After(time.Now()) {
+		t.Errorf("réponse du fournisseur : fresh = %v, cached_at = %v, attendu fresh et l'heure de l'appel", live.Fresh, live.CachedAt)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	cached := decodeEntreprise(t, serve(entrepriseHandler, http.MethodGet, "/api/entreprise/552032534", ""))
+	if cached.Fresh {
+		t.Error("réponse en cache : fresh = true, attendu false")
+	}
+	if !cached.CachedAt.Equal(live.CachedAt) {
+		t.Errorf("réponse en cache : cached_at = %v, attendu la date de récupération %v", cached.CachedAt, live.CachedAt)
+	}
+	if cached.Denomination != live.Denomination {
+		t.Errorf("denomination = %q, attendu %q", cached.Denomination, live.Denomination)
+	}
+}
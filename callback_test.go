@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// callbackReceiver enregistre les notifications reçues ; les failFirst
+// premières reçoivent une réponse 500
+type callbackReceiver struct {
+	mu        sync.Mutex
+	failFirst int
+	calls     int
+	jobs      []EmailJob
+	received  chan EmailJob
+}
+
+func newCallbackReceiver(t *testing.T, failFirst int) (*callbackReceiver, string) {
+	t.Helper()
+	rcv := &callbackReceiver{failFirst: failFirst, received: make(chan EmailJob, 10)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rcv.mu.Lock()
+		rcv.calls++
+		fail := rcv.calls <= rcv.failFirst
+		rcv.mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var job EmailJob
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&job) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rcv.received <- job
+	}))
+	t.Cleanup(srv.Close)
+	return rcv, srv.URL + "/callback"
+}
+
+func (rcv *callbackReceiver) wait(t *testing.T) EmailJob {
+	t.Helper()
+	select {
+	case job := <-rcv.received:
+		return job
+	case <-time.After(5 * time.Second):
+		t.Fatal("aucun callback reçu après 5s")
+		return EmailJob{}
+	}
+}
+
+func (rcv *callbackReceiver) attempts() int {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return rcv.calls
+}
+
+func TestSendEmailCallback(t *testing.T) {
+	s := useFakeSMTP(t)
+	s.reject("inconnu@exemple.fr")
+	useEmailQueue(t, 10).startWorkers(1)
+	// Récepteur local (127.0.0.1) : autorisé pour le test uniquement
+	t.Setenv("CALLBACK_ALLOW_PRIVATE", "1")
+	rcv, callbackURL := newCallbackReceiver(t, 0)
+
+	tests := []struct {
+		to         string
+		wantStatus string
+	}{
+		{"client@exemple.fr", jobSent},
+		{"inconnu@exemple.fr", jobFailed},
+	}
+	for _, tt := range tests {
+		body := emailJSON(t, map[string]any{"to": tt.to, "subject": "Devis", "body": "Bonjour", "async": true, "callback_url": callbackURL})
+		w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("%s : statut = %d (%s), attendu 202", tt.to, w.Code, w.Body)
+		}
+		var queued EmailJob
+		json.NewDecoder(w.Body).Decode(&queued)
+
+		job := rcv.wait(t)
+		if job.ID != queued.ID || job.Status != tt.wantStatus {
+			t.Errorf("%s : callback = %+v, attendu job %s en statut %s", tt.to, job, queued.ID, tt.wantStatus)
+		}
+		if tt.wantStatus == jobFailed && job.Error == "" {
+			t.Errorf("%s : erreur absente du callback", tt.to)
+		}
+	}
+}
+
+func TestNotifyCallbackRetries(t *testing.T) {
+	t.Setenv("CALLBACK_ALLOW_PRIVATE", "1")
+	rcv, callbackURL := newCallbackReceiver(t, 1)
+
+	notifyCallback(callbackURL, EmailJob{ID: "job-1", Status: jobSent}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if job := rcv.wait(t); job.ID != "job-1" {
+		t.Errorf("callback = %+v", job)
+	}
+	if n := rcv.attempts(); n != 2 {
+		t.Errorf("%d essais, attendu 2 (une réponse 500 puis un succès)", n)
+	}
+}
+
+func TestSlowCallbackDoesNotBlockWorker(t *testing.T) {
+	useFakeSMTP(t)
+	q := useEmailQueue(t, 10)
+	q.startWorkers(1)
+	t.Setenv("CALLBACK_ALLOW_PRIVATE", "1")
+
+	// Destinataire qui ne répond qu'une fois libéré
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+
+	send := func(callbackURL string) EmailJob {
+		req := map[string]any{"to": "client@exemple.fr", "subject": "Devis", "body": "Bonjour", "async": true}
+		if callbackURL != "" {
+			req["callback_url"] = callbackURL
+		}
+		w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", emailJSON(t, req))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("statut = %d (%s), attendu 202", w.Code, w.Body)
+		}
+		var job EmailJob
+		json.NewDecoder(w.Body).Decode(&job)
+		return job
+	}
+
+	first := send(slow.URL)
+	waitForJob(t, first.ID)
+	// Le seul worker doit traiter l'envoi suivant sans attendre le callback
+	second := send("")
+	if job := waitForJob(t, second.ID); job.Status != jobSent {
+		t.Errorf("second envoi = %+v, attendu sent", job)
+	}
+}
+
+func TestSendEmailCallbackValidation(t *testing.T) {
+	useFakeSMTP(t)
+	useEmailQueue(t, 10)
+
+	tests := []struct {
+		name  string
+		url   string
+		async bool
+	}{
+		{"sans async", "https://exemple.fr/callback", false},
+		{"schéma ftp", "ftp://exemple.fr/callback", true},
+		{"URL relative", "/callback", true},
+		{"boucle locale", "http://127.0.0.1:8080/callback", true},
+		{"localhost", "http://localhost/callback", true},
+		{"réseau privé", "http://10.0.0.5/callback", true},
+		{"métadonnées cloud", "http://169.254.169.254/latest/meta-data", true},
+		{"IPv6 locale", "http://[::1]/callback", true},
+	}
+	for _, tt := range tests {
+		body := emailJSON(t, map[string]any{"to": "client@exemple.fr", "subject": "Devis", "body": "Bonjour", "async": tt.async, "callback_url": tt.url})
+		w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body)
+		if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != "INVALID_CALLBACK_URL" {
+			t.Errorf("%s : statut = %d (%s), attendu 400 INVALID_CALLBACK_URL", tt.name, w.Code, w.Body)
+		}
+	}
+}
+
+func TestCheckCallbackIP(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0", "0.1.2.3", "100.64.0.1", "100.127.255.254", "::1", "fe80::1", "fd00::1", "224.0.0.1"} {
+		if err := checkCallbackIP(net.ParseIP(ip)); !errors.Is(err, errCallbackAddress) {
+			t.Errorf("checkCallbackIP(%s) = %v, attendu errCallbackAddress", ip, err)
+		}
+	}
+	for _, ip := range []string{"93.184.216.34", "100.63.255.255", "100.128.0.1", "2606:4700::1111"} {
+		if err := checkCallbackIP(net.ParseIP(ip)); err != nil {
+			t.Errorf("checkCallbackIP(%s) = %v, attendu nil", ip, err)
+		}
+	}
+
+	t.Setenv("CALLBACK_ALLOW_PRIVATE", "1")
+	if err := checkCallbackIP(net.ParseIP("127.0.0.1")); err != nil {
+		t.Errorf("CALLBACK_ALLOW_PRIVATE=1 : checkCallbackIP(127.0.0.1) = %v, attendu nil", err)
+	}
+}
+
+func TestCallbackClientRefusesInternalAddress(t *testing.T) {
+	// URL validée, puis adresse devenue interne (DNS modifié, redirection) :
+	// la connexion est refusée par le client lui-même
+	rcv, callbackURL := newCallbackReceiver(t, 0)
+
+	err := postCallback(callbackURL, []byte(`{}`))
+	if !errors.Is(err, errCallbackAddress) {
+		t.Errorf("postCallback vers 127.0.0.1 : err = %v, attendu errCallbackAddress", err)
+	}
+	if n := rcv.attempts(); n != 0 {
+		t.Errorf("%d requêtes reçues, attendu 0", n)
+	}
+
+	// Redirection d'une adresse autorisée vers une adresse interne
+	t.Setenv("CALLBACK_ALLOW_PRIVATE", "1")
+	redirect := httptest.NewServer(http.RedirectHandler(callbackURL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+	if err := validateCallbackURL(context.Background(), redirect.URL); err != nil {
+		t.Fatalf("validateCallbackURL: %v", err)
+	}
+	t.Setenv("CALLBACK_ALLOW_PRIVATE", "")
+	if err := postCallback(redirect.URL, []byte(`{}`)); !errors.Is(err, errCallbackAddress) {
+		t.Errorf("postCallback : err = %v, attendu errCallbackAddress", err)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+)
+
+// --- FICHIER DE CONFIGURATION ---
+
+// Le fichier CONFIG_FILE (JSON ou YAML selon l'extension) reprend les noms
+// des variables d'environnement, pour éviter d'en exporter des dizaines en
+// local :
+//
+//	SMTP_HOST: smtp.exemple.fr
+//	SMTP_PORT: 587
+//	LOG_LEVEL: debug
+//
+// Une variable d'environnement définie reste prioritaire sur le fichier.
+
+// Valeurs lues depuis CONFIG_FILE ; initialisée avant toute variable du
+// package qui lit la configuration (dépendance via getenv)
+var fileConfig, fileConfigErr = loadConfigFile(os.Getenv("CONFIG_FILE"))
+
+// getenv retourne la variable d'environnement key si elle est définie et non
+// vide, sinon sa valeur dans CONFIG_FILE
+func getenv(key string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fileConfig[key]
+}
+
+// loadConfigFile lit et valide le fichier de configuration (aucun si path
+// est vide)
+func loadConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("lecture de CONFIG_FILE : %w", err)
+	}
+
+	raw := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("CONFIG_FILE %q : extension non prise en charge (.json, .yaml ou .yml)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("CONFIG_FILE %q illisible : %w", path, err)
+	}
+
+	config := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if key == "" || strings.ToUpper(key) != key {
+			return nil, fmt.Errorf("CONFIG_FILE : clé %q invalide (nom de variable d'environnement attendu, ex: SMTP_HOST)", key)
+		}
+		switch v := value.(type) {
+		case string:
+			config[key] = v
+		case bool, int, int64, uint64:
+			config[key] = fmt.Sprint(v)
+		case float64:
+			// Pas de notation exponentielle (1.048576e+07) que envInt refuserait
+			config[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case nil:
+		default:
+			return nil, fmt.Errorf("CONFIG_FILE : la valeur de %s doit être une chaîne, un nombre ou un booléen", key)
+		}
+	}
+
+	if err := validateFileConfig(config); err != nil {
+		return nil, fmt.Errorf("CONFIG_FILE : %w", err)
+	}
+	return config, nil
+}
+
+// validateFileConfig vérifie les valeurs dont une erreur empêcherait le
+// service de démarrer ou d'envoyer des emails (ports)
+func validateFileConfig(config map[string]string) error {
+	for _, key := range []string{"PORT", "SMTP_PORT"} {
+		v, ok := config[key]
+		if !ok {
+			continue
+		}
+		if port, err := strconv.Atoi(v); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("%s doit être un port valide (1-65535) : %q", key, v)
+		}
+	}
+	return nil
+}
+
+// --- CONFIGURATION EFFECTIVE ---
+
+// Valeur affichée à la place d'un secret défini
+const redacted = "***"
+
+// redact masque un secret : "***" s'il est défini, vide sinon (pour savoir
+// s'il a bien été chargé sans l'exposer)
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
+
+// configHandler : GET /api/config, configuration réellement chargée (variables
+// d'environnement, CONFIG_FILE et valeurs par défaut), mots de passe, jetons
+// et clés masqués. Sans API_KEY, authMiddleware laisserait passer tout le
+// monde : la route est alors désactivée.
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	if getenv("API_KEY") == "" {
+		writeError(w, http.StatusForbidden, "CONFIG_ENDPOINT_DISABLED", "Route désactivée : définir API_KEY pour consulter la configuration")
+		return
+	}
+
+	// Valeurs lues par chaque module (et non recalculées ici) : elles ne
+	// peuvent pas diverger de la configuration réellement appliquée
+	_, port, _ := net.SplitHostPort(listenAddr())
+	srv := newServer("", nil)
+	var ratePerMinute any // nil : pas de limite (rate.Inf, non représentable en JSON)
+	if emailRateLimiter.limit != rate.Inf {
+		ratePerMinute = math.Round(float64(emailRateLimiter.limit) * 60)
+	}
+	providerName := ""
+	if companyProvider != nil {
+		providerName = companyProvider.Name()
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"config_file": os.Getenv("CONFIG_FILE"),
+		"server": map[string]any{
+			"port":                port,
+			"bind_addr":           getenv("BIND_ADDR"),
+			"tls":                 getenv("TLS_CERT_FILE") != "",
+			"read_header_timeout": srv.ReadHeaderTimeout.String(),
+			"read_timeout":        srv.ReadTimeout.String(),
+			"write_timeout":       srv.WriteTimeout.String(),
+			"idle_timeout":        srv.IdleTimeout.String(),
+			"trusted_proxies":     trustedProxies,
+			"api_key":             redact(getenv("API_KEY")),
+		},
+		"smtp": map[string]any{
+			"host":           getenv("SMTP_HOST"),
+			"port":           getenv("SMTP_PORT"),
+			"user":           getenv("SMTP_ADMIN_EMAIL"),
+			"password":       redact(getenv("SMTP_PASS")),
+			"auth":           getenv("SMTP_AUTH"),
+			"from_address":   getenv("SMTP_FROM_ADDRESS"),
+			"from_name":      getenv("SMTP_FROM_NAME"),
+			"allow_insecure": getenv("SMTP_ALLOW_INSECURE") == "1",
+			"timeout":        smtpTimeout().String(),
+			"max_retries":    smtpMaxAttempts(),
+			"max_concurrent": cap(smtpSlots),
+			"slot_timeout":   smtpSlotTimeout().String(),
+		},
+		"queue": map[string]any{
+			"size":    cap(emailQueue.queue),
+			"workers": emailQueue.workers,
+			"job_ttl": emailQueue.ttl.String(),
+		},
+		"cors": map[string]any{
+			"allowed_origins": corsAllowedOrigins.list(),
+			"allowed_methods": corsAllowedMethods,
+			"allowed_headers": corsAllowedHeaders,
+			"max_age":         corsMaxAge.String(),
+		},
+		"limits": map[string]any{
+			"max_body_bytes":             maxBodyBytes,
+			"max_attachments":            maxAttachments(),
+			"max_attachment_bytes":       maxAttachmentBytes(),
+			"max_total_attachment_bytes": maxTotalAttachmentBytes(),
+			"max_subject_length":         maxSubjectLength(),
+			"rate_limit_per_minute":      ratePerMinute,
+			"rate_limit_burst":           emailRateLimiter.burst,
+		},
+		"company": map[string]any{
+			"provider":            providerName,
+			"api_timeout":         upstreamHTTPClient.Timeout.String(),
+			"cache_ttl":           entrepriseCache.ttl.String(),
+			"societe_api_token":   redact(getenv("SOCIETE_API_TOKEN")),
+			"insee_client_id":     getenv("INSEE_CLIENT_ID"),
+			"insee_client_secret": redact(getenv("INSEE_CLIENT_SECRET")),
+		},
+	})
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile écrit content dans un fichier temporaire nommé name
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// useConfigFile charge path comme CONFIG_FILE (lu au démarrage) le temps du test
+func useConfigFile(t *testing.T, path string) {
+	t.Helper()
+	config, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	previous := fileConfig
+	fileConfig = config
+	t.Cleanup(func() { fileConfig = previous })
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "SMTP_HOST: smtp.exemple.fr\nSMTP_PORT: 587\nSMTP_ALLOW_INSECURE: true\nLOG_LEVEL:\nMAX_ATTACHMENT_BYTES: 10485760\n",
+		"config.json": `{"SMTP_HOST":"smtp.exemple.fr","SMTP_PORT":587,"SMTP_ALLOW_INSECURE":true,"LOG_LEVEL":null,"MAX_ATTACHMENT_BYTES":10485760}`,
+	}
+	for name, content := range files {
+		config, err := loadConfigFile(writeConfigFile(t, name, content))
+		if err != nil {
+			t.Fatalf("%s : %v", name, err)
+		}
+		want := map[string]string{"SMTP_HOST": "smtp.exemple.fr", "SMTP_PORT": "587", "SMTP_ALLOW_INSECURE": "true", "MAX_ATTACHMENT_BYTES": "10485760"}
+		if len(config) != len(want) {
+			t.Errorf("%s : %v, attendu %v", name, config, want)
+		}
+		for key, value := range want {
+			if config[key] != value {
+				t.Errorf("%s : %s = %q, attendu %q", name, key, config[key], value)
+			}
+		}
+	}
+
+	if config, err := loadConfigFile(""); config != nil || err != nil {
+		t.Errorf("sans CONFIG_FILE : %v, %v, attendu aucune valeur", config, err)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := map[string]struct {
+		name, content string
+		want          string
+	}{
+		"fichier absent":     {"", "", "lecture de CONFIG_FILE"},
+		"extension inconnue": {"config.toml", "SMTP_HOST = 'x'", "extension non prise en charge"},
+		"YAML invalide":      {"config.yml", "SMTP_HOST: [", "illisible"},
+		"clé en minuscules":  {"config.yaml", "smtp_host: smtp.exemple.fr", "clé \"smtp_host\" invalide"},
+		"valeur imbriquée":   {"config.yaml", "SMTP_HOST:\n  nom: smtp", "SMTP_HOST doit être"},
+		"port invalide":      {"config.json", `{"SMTP_PORT":"587a"}`, "SMTP_PORT doit être un port valide"},
+		"port hors limites":  {"config.json", `{"PORT":70000}`, "PORT doit être un port valide"},
+	}
+	for label, tt := range tests {
+		path := filepath.Join(t.TempDir(), "absent.yaml")
+		if tt.name != "" {
+			path = writeConfigFile(t, tt.name, tt.content)
+		}
+		if _, err := loadConfigFile(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s : erreur = %v, attendu %q", label, err, tt.want)
+		}
+	}
+}
+
+func TestConfigFileLargeNumber(t *testing.T) {
+	// Nombre JSON ≥ 1e6 : décodé en float64, il doit rester lisible par envInt
+	useConfigFile(t, writeConfigFile(t, "config.json", `{"MAX_ATTACHMENT_BYTES":10485760}`))
+	t.Setenv("MAX_ATTACHMENT_BYTES", "")
+	if got := maxAttachmentBytes(); got != 10485760 {
+		t.Errorf("maxAttachmentBytes() = %d, attendu 10485760", got)
+	}
+}
+
+func TestConfigFileEnvPrecedence(t *testing.T) {
+	useConfigFile(t, writeConfigFile(t, "config.yaml", "SMTP_HOST: smtp.fichier.fr\nSMTP_PORT: 2525\nSMTP_ADMIN_EMAIL: fichier@exemple.fr\nSMTP_PASS: secret\n"))
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("SMTP_PORT", "")
+	t.Setenv("SMTP_ADMIN_EMAIL", "")
+	t.Setenv("SMTP_PASS", "")
+
+	cfg := loadSMTPConfig()
+	if cfg.host != "smtp.fichier.fr" || cfg.port != "2525" || cfg.user != "fichier@exemple.fr" || !cfg.complete() {
+		t.Errorf("configuration SMTP = %+v, attendu les valeurs du fichier", cfg)
+	}
+
+	// Variable d'environnement définie : prioritaire sur le fichier
+	t.Setenv("SMTP_HOST", "smtp.env.fr")
+	if cfg := loadSMTPConfig(); cfg.host != "smtp.env.fr" || cfg.port != "2525" {
+		t.Errorf("configuration SMTP = %+v, attendu SMTP_HOST de l'environnement", cfg)
+	}
+}
+
+func TestConfigEndpoint(t *testing.T) {
+	handler := newTestHandler(t)
+	t.Setenv("API_KEY", "cle-secrete")
+	t.Setenv("SMTP_HOST", "smtp.exemple.fr")
+	t.Setenv("SMTP_PORT", "587")
+	t.Setenv("SMTP_PASS", "mot-de-passe-smtp")
+	t.Setenv("SOCIETE_API_TOKEN", "jeton-societe")
+	t.Setenv("INSEE_CLIENT_SECRET", "")
+
+	get := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("cle-secrete")
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	body := w.Body.String()
+	for _, secret := range []string{"cle-secrete", "mot-de-passe-smtp", "jeton-societe"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("secret %q exposé : %s", secret, body)
+		}
+	}
+
+	var config map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &config); err != nil {
+		t.Fatalf("réponse illisible: %v", err)
+	}
+	checks := []struct {
+		section, key string
+		want         any
+	}{
+		{"smtp", "password", "***"},
+		{"smtp", "host", "smtp.exemple.fr"},
+		{"smtp", "port", "587"},
+		{"server", "api_key", "***"},
+		{"company", "societe_api_token", "***"},
+		{"company", "insee_client_secret", ""}, // non défini : vide, pas masqué
+		{"limits", "max_subject_length", float64(255)},
+	}
+	for _, c := range checks {
+		section, _ := config[c.section].(map[string]any)
+		if got := section[c.key]; got != c.want {
+			t.Errorf("%s.%s = %v, attendu %v", c.section, c.key, got, c.want)
+		}
+	}
+
+	// Valeurs réellement chargées par chaque module, et non des valeurs par
+	// défaut recopiées
+	useEmailQueue(t, 7).startWorkers(3)
+	t.Setenv("HTTP_WRITE_TIMEOUT", "45s")
+	t.Setenv("SMTP_MAX_RETRIES", "0")
+	config = nil
+	if err := json.Unmarshal(get("cle-secrete").Body.Bytes(), &config); err != nil {
+		t.Fatalf("réponse illisible: %v", err)
+	}
+	checks = []struct {
+		section, key string
+		want         any
+	}{
+		{"queue", "size", float64(7)},
+		{"queue", "workers", float64(3)},
+		{"queue", "job_ttl", "1h0m0s"},
+		{"server", "write_timeout", "45s"},
+		{"smtp", "max_retries", float64(1)},      // au moins un essai
+		{"limits", "rate_limit_per_minute", nil}, // limiteur sans limite (newTestHandler)
+		{"company", "cache_ttl", entrepriseCache.ttl.String()},
+	}
+	for _, c := range checks {
+		section, _ := config[c.section].(map[string]any)
+		if got := section[c.key]; got != c.want {
+			t.Errorf("%s.%s = %v, attendu %v", c.section, c.key, got, c.want)
+		}
+	}
+
+	cors, _ := config["cors"].(map[string]any)
+	origins, _ := json.Marshal(cors["allowed_origins"])
+	if want, _ := json.Marshal(corsAllowedOrigins.list()); string(origins) != string(want) {
+		t.Errorf("cors.allowed_origins = %s, attendu %s", origins, want)
+	}
+
+	// Clé API requise, et route désactivée sans API_KEY
+	if w := get(""); w.Code != http.StatusUnauthorized {
+		t.Errorf("sans clé : statut = %d, attendu 401", w.Code)
+	}
+	t.Setenv("API_KEY", "")
+	w = get("")
+	if w.Code != http.StatusForbidden || decodeAPIError(t, w).Code != "CONFIG_ENDPOINT_DISABLED" {
+		t.Errorf("sans API_KEY : statut = %d (%s), attendu 403 CONFIG_ENDPOINT_DISABLED", w.Code, w.Body)
+	}
+}
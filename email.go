@@ -0,0 +1,699 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+func init() {
+	// L'image Docker (alpine) n'a pas de /etc/mime.types : on complète la
+	// table intégrée de Go avec les formats courants absents
+	extraTypes := map[string]string{
+		".csv":  "text/csv",
+		".txt":  "text/plain",
+		".doc":  "application/msword",
+		".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		".xls":  "application/vnd.ms-excel",
+		".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		".zip":  "application/zip",
+	}
+	for ext, typ := range extraTypes {
+		if mime.TypeByExtension(ext) == "" {
+			mime.AddExtensionType(ext, typ)
+		}
+	}
+}
+
+// --- CONSTRUCTION DES EMAILS (MIME) ---
+
+// mailNow fournit la date de l'en-tête Date (remplaçable pour obtenir un
+// message déterministe)
+var mailNow = time.Now
+
+// buildEmailMessage assemble le message MIME complet (en-têtes + parties)
+// prêt à être transmis au serveur SMTP
+func buildEmailMessage(req EmailRequest, from string) string {
+	boundary := req.newBoundary()
+
+	// En-têtes (les en-têtes additionnels ne peuvent pas écraser les en-têtes
+	// gérés par le service, voir validateCustomHeaders), indexés par nom
+	// canonique : "message-id" et "Message-ID" ne produisent qu'un en-tête
+	header := make(map[string]string) // nom canonique -> ligne "Nom: valeur"
+	setHeader := func(name, value string) {
+		header[textproto.CanonicalMIMEHeaderKey(name)] = name + ": " + value
+	}
+	for k, v := range req.Headers {
+		setHeader(k, encodeHeader(v))
+	}
+	setHeader("Date", mailNow().Format(time.RFC1123Z))
+	setHeader("From", from)
+	setHeader("To", formatAddress(string(req.To)))
+	if req.Cc != "" {
+		setHeader("Cc", formatAddress(string(req.Cc)))
+	}
+	setHeader("Subject", encodeHeader(req.Subject))
+	if req.ReplyTo != "" {
+		setHeader("Reply-To", formatAddress(req.ReplyTo))
+	}
+	if req.RequestMDN {
+		setHeader("Disposition-Notification-To", formatAddress(req.mdnAddress(from)))
+	}
+	if req.MessageID != "" {
+		setHeader("Message-ID", req.MessageID)
+	}
+	setHeader("MIME-Version", "1.0")
+	setHeader("Content-Type", "multipart/mixed; boundary="+boundary)
+
+	message := ""
+	for _, line := range header {
+		message += line + "\r\n"
+	}
+	message += "\r\n"
+
+	// PARTIE 1 : Corps du texte (+ alternatives HTML et invitation calendrier
+	// si fournies)
+	message += fmt.Sprintf("--%s\r\n", boundary)
+	alternatives := []string{textPart("text/plain", req.Body)}
+	if req.BodyHTML != "" {
+		htmlPart := textPart("text/html", req.BodyHTML)
+		if len(req.InlineImages) > 0 {
+			// Le HTML et ses images forment un tout (multipart/related)
+			htmlPart = buildRelatedPart(htmlPart, req.InlineImages, req.newBoundary())
+		}
+		alternatives = append(alternatives, htmlPart)
+	}
+	if req.ICS != "" {
+		alternatives = append(alternatives, calendarPart(req.ICS))
+	}
+	if len(alternatives) > 1 {
+		message += buildAlternativePart(alternatives, req.newBoundary())
+	} else {
+		message += alternatives[0]
+	}
+
+	// PARTIE 2 : Pièces jointes (une partie par fichier)
+	for _, a := range req.allAttachments() {
+		// Nettoyage nom de fichier
+		cleanName := sanitizeFilename(a.Name)
+
+		contentType := attachmentContentType(cleanName, a.ContentType)
+
+		message += fmt.Sprintf("--%s\r\n", boundary)
+		message += fmt.Sprintf("Content-Type: %s\r\n", contentType)
+		message += "Content-Transfer-Encoding: base64\r\n"
+		message += fmt.Sprintf("Content-Disposition: %s\r\n", contentDisposition("attachment", cleanName))
+		message += "\r\n"
+		// IMPORTANT : Découpage du Base64
+		message += splitLines(a.Data) + "\r\n"
+	}
+
+	message += fmt.Sprintf("--%s--\r\n", boundary)
+
+	return message
+}
+
+// fromHeader construit l'en-tête From depuis SMTP_FROM_NAME et
+// SMTP_FROM_ADDRESS (adresse authentifiée par défaut), ex:
+// "Vintage Standards <contact@vintagestandards.fr>". Le nom affiché est
+// encodé en RFC 2047 si besoin. L'expéditeur de l'enveloppe SMTP reste
+// l'adresse authentifiée.
+func fromHeader(smtpUser string) string {
+	address := getenv("SMTP_FROM_ADDRESS")
+	if address == "" {
+		address = smtpUser
+	}
+	from := mail.Address{Name: getenv("SMTP_FROM_NAME"), Address: address}
+	return from.String()
+}
+
+// mdnAddress retourne l'adresse à laquelle envoyer l'accusé de lecture :
+// notify_address, sinon reply_to, sinon l'expéditeur
+func (req EmailRequest) mdnAddress(from string) string {
+	if req.NotifyAddress != "" {
+		return req.NotifyAddress
+	}
+	if req.ReplyTo != "" {
+		return req.ReplyTo
+	}
+	return from
+}
+
+// newMessageID génère un Message-ID unique (RFC 5322) à partir d'un jeton
+// aléatoire et du domaine de l'expéditeur, ex: <3f2a...@vintagestandards.fr>
+func newMessageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil && addressDomain(addr.Address) != "" {
+		domain = addressDomain(addr.Address)
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+// normalizeMessageID valide un Message-ID fourni par l'appelant
+// ("id@domaine", chevrons facultatifs) et le retourne entre chevrons
+func normalizeMessageID(id string) (string, error) {
+	id = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(id), "<"), ">")
+	left, right, ok := strings.Cut(id, "@")
+	if !ok || !validMessageIDPart(left) || !validMessageIDPart(right) || len(id) > 250 {
+		return "", fmt.Errorf("Message-ID invalide (format attendu : <identifiant@domaine>) : %q", id)
+	}
+	return "<" + id + ">", nil
+}
+
+// validMessageIDPart vérifie une partie de Message-ID : caractères ASCII
+// visibles, hors séparateurs (espaces, chevrons, @, guillemets...)
+func validMessageIDPart(part string) bool {
+	if part == "" {
+		return false
+	}
+	for i := 0; i < len(part); i++ {
+		c := part[i]
+		if c < 0x21 || c > 0x7e || strings.IndexByte(`<>@"(),:;[\]`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// newBoundary génère une frontière MIME aléatoire, régénérée tant qu'elle
+// apparaît dans l'un des contenus du message
+func (req EmailRequest) newBoundary() string {
+	for {
+		b := make([]byte, 16)
+		rand.Read(b) // ne retourne jamais d'erreur depuis Go 1.24
+		boundary := "Boundary_" + hex.EncodeToString(b)
+		if !req.contains(boundary) {
+			return boundary
+		}
+	}
+}
+
+// contains indique si l'un des contenus du message contient s
+func (req EmailRequest) contains(s string) bool {
+	if strings.Contains(req.Body, s) || strings.Contains(req.BodyHTML, s) || strings.Contains(req.ICS, s) {
+		return true
+	}
+	for _, a := range req.allAttachments() {
+		if strings.Contains(a.Data, s) {
+			return true
+		}
+	}
+	for _, img := range req.InlineImages {
+		if strings.Contains(img.Data, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// allAttachments retourne les pièces jointes de la requête, en y ajoutant
+// l'ancien couple attachment_name/attachment_data (rétrocompatibilité)
+func (req EmailRequest) allAttachments() []Attachment {
+	var attachments []Attachment
+	if req.AttachmentData != "" && req.AttachmentName != "" {
+		attachments = append(attachments, Attachment{
+			Name:        req.AttachmentName,
+			Data:        req.AttachmentData,
+			ContentType: req.AttachmentType,
+		})
+	}
+	for _, a := range req.Attachments {
+		if a.Data != "" && a.Name != "" {
+			attachments = append(attachments, a)
+		}
+	}
+	return attachments
+}
+
+// sanitizeFilename ne garde que le dernier segment du nom (pas de chemin),
+// sans caractères de contrôle, guillemets ni barres obliques. Un nom vide
+// après nettoyage devient "attachment".
+func sanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, "/\\"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' || r == '\\' || r == '/' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return "attachment"
+	}
+	return name
+}
+
+// contentDisposition construit la valeur de Content-Disposition ; un nom non
+// ASCII est encodé en RFC 2231 (filename*=utf-8”...)
+func contentDisposition(disposition, filename string) string {
+	if v := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); v != "" {
+		return v
+	}
+	return disposition + "; filename=\"attachment\""
+}
+
+// attachmentContentType retourne le type MIME explicite s'il est fourni,
+// sinon celui déduit de l'extension du fichier (application/octet-stream
+// si inconnue)
+func attachmentContentType(filename, override string) string {
+	if override != "" {
+		return override
+	}
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Types de pièces jointes acceptés par défaut (ALLOWED_ATTACHMENT_TYPES)
+const defaultAllowedAttachmentTypes = "application/pdf, image/png, image/jpeg, text/csv"
+
+// allowedAttachmentType indique si un type MIME (paramètres ignorés) fait
+// partie de ALLOWED_ATTACHMENT_TYPES ; "*" autorise tous les types
+func allowedAttachmentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, allowed := range strings.Split(envList("ALLOWED_ATTACHMENT_TYPES", defaultAllowedAttachmentTypes), ",") {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == "*" || allowed == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAttachmentTypes refuse les pièces jointes dont le type déclaré ou
+// déduit de l'extension n'est pas autorisé (ex: virus.exe déclaré en PDF),
+// ainsi que les images intégrées qui ne sont pas des images
+func (req EmailRequest) checkAttachmentTypes() error {
+	for _, a := range req.allAttachments() {
+		if t := attachmentContentType(a.Name, a.ContentType); !allowedAttachmentType(t) {
+			return fmt.Errorf("pièce jointe '%s' : type %q non autorisé", a.Name, t)
+		}
+		if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(a.Name))); t != "" && !allowedAttachmentType(t) {
+			return fmt.Errorf("pièce jointe '%s' : extension de type %q non autorisée", a.Name, t)
+		}
+	}
+
+	// Les images intégrées ne peuvent être que des images (image/*), quel
+	// que soit ALLOWED_ATTACHMENT_TYPES
+	for _, img := range req.InlineImages {
+		name := img.Cid
+		if img.Name != "" {
+			name = img.Name
+		}
+		if t := attachmentContentType(name, img.ContentType); !isImageType(t) {
+			return fmt.Errorf("image intégrée '%s' : type %q non autorisé (image/* attendu)", img.Cid, t)
+		}
+		if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(img.Name))); t != "" && !isImageType(t) {
+			return fmt.Errorf("image intégrée '%s' : extension de type %q non autorisée", img.Cid, t)
+		}
+	}
+	return nil
+}
+
+// isImageType indique si un type MIME (paramètres ignorés) est une image
+func isImageType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(mediaType)), "image/")
+}
+
+// encodeHeader encode une valeur d'en-tête en RFC 2047 (=?utf-8?q?...?=)
+// si elle contient des caractères non ASCII (ex: "Devis été 2024"). Les mots
+// encodés (75 caractères au plus) sont repliés sur plusieurs lignes : un
+// sujet accentué de 255 caractères dépasserait sinon la limite de 998
+// octets par ligne (RFC 5322 §2.1.1).
+func encodeHeader(value string) string {
+	encoded := mime.QEncoding.Encode("utf-8", value)
+	if encoded == value {
+		return value
+	}
+	return strings.ReplaceAll(encoded, "?= =?", "?=\r\n =?")
+}
+
+// applySubjectPrefix préfixe le sujet par SUBJECT_PREFIX (ex: "[Vintage
+// Standards]"), sauf s'il le porte déjà (réponse à un email du service)
+func applySubjectPrefix(subject string) string {
+	prefix := strings.TrimSpace(getenv("SUBJECT_PREFIX"))
+	if prefix == "" || strings.HasPrefix(subject, prefix) {
+		return subject
+	}
+	return prefix + " " + subject
+}
+
+// limitSubject applique MAX_SUBJECT_LENGTH (en caractères, 255 par défaut) :
+// un sujet trop long est tronqué avec des points de suspension, ou refusé si
+// SUBJECT_TOO_LONG=reject. Appliqué avant l'encodage RFC 2047.
+func limitSubject(subject string) (string, error) {
+	limit := maxSubjectLength()
+	runes := []rune(subject)
+	if limit < 1 || len(runes) <= limit {
+		return subject, nil
+	}
+	if strings.ToLower(getenv("SUBJECT_TOO_LONG")) == "reject" {
+		return "", fmt.Errorf("sujet trop long (%d caractères, maximum %d)", len(runes), limit)
+	}
+	return strings.TrimRightFunc(string(runes[:limit-1]), unicode.IsSpace) + "…", nil
+}
+
+// Recipients est une liste de destinataires, conservée sous forme d'une liste
+// d'adresses RFC 5322 séparées par des virgules. En JSON, elle accepte une
+// chaîne ("a@x.fr, Bob <b@y.fr>"), un objet {"name", "address"} ou un
+// tableau mêlant chaînes et objets.
+type Recipients string
+
+// Destinataire sous forme d'objet
+type namedRecipient struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+func (r *Recipients) UnmarshalJSON(data []byte) error {
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		list = []json.RawMessage{data}
+	}
+
+	parts := make([]string, 0, len(list))
+	for _, item := range list {
+		var s string
+		if err := json.Unmarshal(item, &s); err == nil {
+			if s = strings.TrimSpace(s); s != "" {
+				parts = append(parts, s)
+			}
+			continue
+		}
+		var nr namedRecipient
+		if err := json.Unmarshal(item, &nr); err != nil {
+			return fmt.Errorf("destinataire invalide : chaîne ou objet {name, address} attendu")
+		}
+		if strings.TrimSpace(nr.Address) == "" {
+			return fmt.Errorf("destinataire invalide : le champ 'address' est requis")
+		}
+		// Le nom est échappé (guillemets) ou encodé en RFC 2047 par String()
+		parts = append(parts, (&mail.Address{Name: nr.Name, Address: strings.TrimSpace(nr.Address)}).String())
+	}
+	*r = Recipients(strings.Join(parts, ", "))
+	return nil
+}
+
+// formatAddress normalise une adresse (nom affiché encodé en RFC 2047 si
+// besoin). Une adresse non analysable est retournée telle quelle.
+func formatAddress(value string) string {
+	addrs, err := mail.ParseAddressList(value)
+	if err != nil {
+		return value
+	}
+	formatted := make([]string, len(addrs))
+	for i, addr := range addrs {
+		formatted[i] = addr.String()
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// envelopeRecipients retourne toutes les adresses nues de l'enveloppe SMTP
+// (To, Cc et Bcc ; Bcc n'apparaît dans aucun en-tête)
+func (req EmailRequest) envelopeRecipients() []string {
+	var all []string
+	for _, list := range []Recipients{req.To, req.Cc, req.Bcc} {
+		all = append(all, recipientAddresses(string(list))...)
+	}
+	return all
+}
+
+// recipientAddresses retourne les adresses nues (sans nom affiché) d'une liste
+// de destinataires séparés par des virgules, pour l'enveloppe SMTP
+func recipientAddresses(value string) []string {
+	addrs, _ := mail.ParseAddressList(value)
+	bare := make([]string, len(addrs))
+	for i, addr := range addrs {
+		bare[i] = addr.Address
+	}
+	return bare
+}
+
+// dedupRecipients supprime les destinataires en double de l'enveloppe
+// selon RECIPIENT_DEDUP, pour ne pas livrer plusieurs fois le même message :
+//   - off (défaut) : aucune déduplication
+//   - exact : adresses identiques à la casse près
+//   - plus : ignore aussi le sous-adressage (a+tag@x.fr = a@x.fr)
+//
+// La première occurrence de chaque adresse est conservée, dans l'ordre.
+func dedupRecipients(to []string) []string {
+	policy := strings.ToLower(getenv("RECIPIENT_DEDUP"))
+	if policy != "exact" && policy != "plus" {
+		return to
+	}
+
+	seen := make(map[string]bool, len(to))
+	unique := make([]string, 0, len(to))
+	for _, addr := range to {
+		key := strings.ToLower(addr)
+		if policy == "plus" {
+			if local, domain, ok := strings.Cut(key, "@"); ok {
+				local, _, _ = strings.Cut(local, "+")
+				key = local + "@" + domain
+			}
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, addr)
+	}
+	return unique
+}
+
+// normalizeAttachments regroupe toutes les pièces jointes dans Attachments
+// et vérifie que leur contenu est du Base64 valide. Le contenu est réencodé
+// proprement (sans espaces ni retours à la ligne envoyés par le client).
+func (req *EmailRequest) normalizeAttachments() error {
+	attachments := req.allAttachments()
+	for i, a := range attachments {
+		cleaned := strings.Join(strings.Fields(a.Data), "")
+		decoded, err := base64.StdEncoding.DecodeString(cleaned)
+		if err != nil {
+			return fmt.Errorf("pièce jointe '%s' : contenu Base64 invalide", a.Name)
+		}
+		attachments[i].Data = base64.StdEncoding.EncodeToString(decoded)
+	}
+
+	req.Attachments = attachments
+	req.AttachmentName, req.AttachmentData, req.AttachmentType = "", "", ""
+	return nil
+}
+
+// normalizeInlineImages vérifie les images intégrées (corps HTML requis,
+// cid unique et valide, Base64 valide) et réencode leur contenu
+func (req *EmailRequest) normalizeInlineImages() error {
+	if len(req.InlineImages) > 0 && req.BodyHTML == "" {
+		return fmt.Errorf("les images intégrées nécessitent un corps HTML (body_html)")
+	}
+
+	seen := make(map[string]bool)
+	for i, img := range req.InlineImages {
+		if !validContentID(img.Cid) {
+			return fmt.Errorf("image intégrée : cid invalide %q", img.Cid)
+		}
+		if seen[img.Cid] {
+			return fmt.Errorf("image intégrée : cid %q en double", img.Cid)
+		}
+		seen[img.Cid] = true
+
+		cleaned := strings.Join(strings.Fields(img.Data), "")
+		decoded, err := base64.StdEncoding.DecodeString(cleaned)
+		if err != nil || len(decoded) == 0 {
+			return fmt.Errorf("image intégrée '%s' : contenu Base64 invalide", img.Cid)
+		}
+		req.InlineImages[i].Data = base64.StdEncoding.EncodeToString(decoded)
+	}
+	return nil
+}
+
+// validContentID accepte un identifiant ASCII imprimable sans espace ni
+// chevrons (il est placé entre <> dans l'en-tête Content-ID)
+func validContentID(cid string) bool {
+	if cid == "" || len(cid) > 128 {
+		return false
+	}
+	for _, c := range cid {
+		if c < 0x21 || c > 0x7e || c == '<' || c == '>' || c == '"' {
+			return false
+		}
+	}
+	return true
+}
+
+// En-têtes gérés par le service, que les en-têtes additionnels ne peuvent pas
+// remplacer (forme canonique)
+var protectedHeaders = map[string]bool{
+	"Date":                        true,
+	"From":                        true,
+	"To":                          true,
+	"Cc":                          true,
+	"Bcc":                         true,
+	"Subject":                     true,
+	"Reply-To":                    true,
+	"Disposition-Notification-To": true,
+	"Message-Id":                  true,
+	"Sender":                      true,
+	"Return-Path":                 true,
+	"Mime-Version":                true,
+	"Content-Type":                true,
+	"Content-Transfer-Encoding":   true,
+	"Content-Disposition":         true,
+}
+
+// validateCustomHeaders vérifie les en-têtes additionnels : nom conforme à
+// la RFC 5322, en-tête non protégé, et aucune valeur contenant CR ou LF
+// (injection d'en-têtes)
+func validateCustomHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if !validHeaderName(name) {
+			return fmt.Errorf("nom d'en-tête invalide : %q", name)
+		}
+		if protectedHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			return fmt.Errorf("l'en-tête '%s' ne peut pas être modifié", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("l'en-tête '%s' contient un retour à la ligne", name)
+		}
+	}
+	return nil
+}
+
+// validHeaderName : caractères ASCII imprimables hors ':' (RFC 5322 §2.2)
+func validHeaderName(name string) bool {
+	if name == "" || len(name) > 76 {
+		return false
+	}
+	for _, c := range name {
+		if c < 0x21 || c > 0x7e || c == ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// maxSubjectLength retourne la longueur maximale du sujet en caractères
+// (MAX_SUBJECT_LENGTH, 0 ou moins pour ne pas limiter)
+func maxSubjectLength() int {
+	return envInt("MAX_SUBJECT_LENGTH", 255)
+}
+
+// maxAttachmentBytes retourne la taille maximale (décodée) d'une pièce jointe
+func maxAttachmentBytes() int64 {
+	return int64(envInt("MAX_ATTACHMENT_BYTES", 10<<20))
+}
+
+// maxAttachments retourne le nombre maximal de pièces jointes et images
+// intégrées par email (MAX_ATTACHMENTS)
+func maxAttachments() int {
+	return envInt("MAX_ATTACHMENTS", 10)
+}
+
+// maxTotalAttachmentBytes retourne la taille décodée cumulée maximale des
+// pièces jointes et images intégrées (MAX_TOTAL_ATTACHMENT_BYTES)
+func maxTotalAttachmentBytes() int64 {
+	return int64(envInt("MAX_TOTAL_ATTACHMENT_BYTES", 25<<20))
+}
+
+// decodedBase64Size estime la taille décodée d'un contenu Base64
+// (4 caractères encodés = 3 octets, moins le padding)
+func decodedBase64Size(data string) int64 {
+	n := int64(len(data)) * 3 / 4
+	return n - int64(strings.Count(data[max(0, len(data)-2):], "="))
+}
+
+// textPart construit une partie texte (en-têtes + contenu). Le contenu est
+// encodé en quoted-printable : le 7bit est interdit dès qu'il y a des accents
+// et les lignes sont limitées à 76 caractères
+func textPart(contentType, body string) string {
+	part := fmt.Sprintf("Content-Type: %s; charset=\"utf-8\"\r\n", contentType)
+	part += "Content-Transfer-Encoding: quoted-printable\r\n"
+	part += "\r\n"
+	part += encodeQuotedPrintable(body) + "\r\n"
+	return part
+}
+
+// encodeQuotedPrintable encode un texte UTF-8 en quoted-printable
+func encodeQuotedPrintable(s string) string {
+	var buf bytes.Buffer
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(s))
+	qp.Close()
+	return buf.String()
+}
+
+// buildAlternativePart construit une partie multipart/alternative à partir
+// des parties déjà construites (texte brut, puis HTML, puis calendrier) : les
+// clients mail affichent la dernière version qu'ils savent interpréter
+func buildAlternativePart(parts []string, boundary string) string {
+	part := "Content-Type: multipart/alternative; boundary=" + boundary + "\r\n"
+	part += "\r\n"
+	for _, p := range parts {
+		part += fmt.Sprintf("--%s\r\n", boundary)
+		part += p
+	}
+	part += fmt.Sprintf("--%s--\r\n", boundary)
+	return part
+}
+
+// calendarPart construit la partie text/calendar d'une invitation : les
+// clients mail proposent alors de l'ajouter à l'agenda
+func calendarPart(ics string) string {
+	part := "Content-Type: text/calendar; charset=\"utf-8\"; method=REQUEST\r\n"
+	part += "Content-Transfer-Encoding: quoted-printable\r\n"
+	part += "\r\n"
+	part += encodeQuotedPrintable(ics) + "\r\n"
+	return part
+}
+
+// validateICS vérifie que le champ ics contient bien un calendrier iCalendar
+func validateICS(ics string) error {
+	ics = strings.TrimPrefix(strings.TrimSpace(ics), "\ufeff")
+	if !strings.HasPrefix(strings.ToUpper(ics), "BEGIN:VCALENDAR") {
+		return fmt.Errorf("le champ 'ics' doit commencer par BEGIN:VCALENDAR")
+	}
+	return nil
+}
+
+// buildRelatedPart construit une partie multipart/related : la partie HTML
+// suivie des images qu'elle référence via "cid:<identifiant>"
+func buildRelatedPart(htmlPart string, images []InlineImage, boundary string) string {
+	part := "Content-Type: multipart/related; boundary=" + boundary + "; type=\"text/html\"\r\n"
+	part += "\r\n"
+	part += fmt.Sprintf("--%s\r\n", boundary)
+	part += htmlPart
+	for _, img := range images {
+		name := img.Cid
+		if img.Name != "" {
+			name = sanitizeFilename(img.Name)
+		}
+
+		part += fmt.Sprintf("--%s\r\n", boundary)
+		part += fmt.Sprintf("Content-Type: %s\r\n", attachmentContentType(name, img.ContentType))
+		part += "Content-Transfer-Encoding: base64\r\n"
+		part += fmt.Sprintf("Content-ID: <%s>\r\n", img.Cid)
+		part += fmt.Sprintf("Content-Disposition: %s\r\n", contentDisposition("inline", name))
+		part += "\r\n"
+		part += splitLines(img.Data) + "\r\n"
+	}
+	part += fmt.Sprintf("--%s--\r\n", boundary)
+	return part
+}
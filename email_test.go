@@ -0,0 +1,1040 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mimePart : partie MIME décodée (quoted-printable compris)
+type mimePart struct {
+	header textproto.MIMEHeader
+	body   string
+}
+
+// parseEmail analyse un message construit par buildEmailMessage
+func parseEmail(t *testing.T, message string) *mail.Message {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("message illisible : %v\n%s", err, message)
+	}
+	return msg
+}
+
+// readParts retourne les parties d'un corps multipart de type contentType
+func readParts(t *testing.T, contentType string, body io.Reader) []mimePart {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		t.Fatalf("Content-Type %q : multipart attendu (%v)", contentType, err)
+	}
+
+	var parts []mimePart
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("partie MIME illisible : %v", err)
+		}
+		data, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatalf("partie MIME illisible : %v", err)
+		}
+		parts = append(parts, mimePart{header: p.Header, body: string(data)})
+	}
+}
+
+// mediaType retourne le type MIME d'une partie, sans paramètres
+func (p mimePart) mediaType() string {
+	mt, _, _ := mime.ParseMediaType(p.header.Get("Content-Type"))
+	return mt
+}
+
+// subParts retourne les parties d'une partie multipart imbriquée
+func (p mimePart) subParts(t *testing.T) []mimePart {
+	t.Helper()
+	return readParts(t, p.header.Get("Content-Type"), strings.NewReader(p.body))
+}
+
+// bodyParts retourne les parties de premier niveau d'un message
+func bodyParts(t *testing.T, message string) []mimePart {
+	t.Helper()
+	msg := parseEmail(t, message)
+	return readParts(t, msg.Header.Get("Content-Type"), msg.Body)
+}
+
+func TestBuildEmailMessageTextOnly(t *testing.T) {
+	req := EmailRequest{To: "client@exemple.fr", Subject: "Devis", Body: "Bonjour"}
+	parts := bodyParts(t, buildEmailMessage(req, "contact@vintagestandards.fr"))
+
+	if len(parts) != 1 || parts[0].mediaType() != "text/plain" {
+		t.Fatalf("attendu une seule partie text/plain, obtenu %d parties", len(parts))
+	}
+	if got := strings.TrimSpace(parts[0].body); got != "Bonjour" {
+		t.Errorf("corps = %q, attendu %q", got, "Bonjour")
+	}
+}
+
+func TestBuildEmailMessageHTMLAlternative(t *testing.T) {
+	req := EmailRequest{
+		To:       "client@exemple.fr",
+		Subject:  "Devis",
+		Body:     "Bonjour (texte)",
+		BodyHTML: "<p>Bonjour (HTML)</p>",
+	}
+	parts := bodyParts(t, buildEmailMessage(req, "contact@vintagestandards.fr"))
+
+	if len(parts) != 1 || parts[0].mediaType() != "multipart/alternative" {
+		t.Fatalf("attendu une partie multipart/alternative, obtenu %d parties", len(parts))
+	}
+	alternatives := readParts(t, parts[0].header.Get("Content-Type"), strings.NewReader(parts[0].body))
+	if len(alternatives) != 2 {
+		t.Fatalf("%d alternatives, attendu 2", len(alternatives))
+	}
+
+	// Texte brut d'abord, HTML ensuite (version préférée en dernier)
+	if alternatives[0].mediaType() != "text/plain" || strings.TrimSpace(alternatives[0].body) != "Bonjour (texte)" {
+		t.Errorf("première alternative = %s %q, attendu le texte brut", alternatives[0].mediaType(), alternatives[0].body)
+	}
+	if alternatives[1].mediaType() != "text/html" || strings.TrimSpace(alternatives[1].body) != "<p>Bonjour (HTML)</p>" {
+		t.Errorf("seconde alternative = %s %q, attendu le HTML", alternatives[1].mediaType(), alternatives[1].body)
+	}
+}
+
+func TestBuildEmailMessageMultipleAttachments(t *testing.T) {
+	pdf := strings.Repeat("%PDF-1.4 devis ", 20) // plus de 76 caractères encodés
+	req := EmailRequest{
+		To:      "client@exemple.fr",
+		Subject: "Documents",
+		Body:    "Ci-joint",
+		Attachments: []Attachment{
+			{Name: "devis.pdf", Data: base64.StdEncoding.EncodeToString([]byte(pdf))},
+			{Name: "export.csv", Data: base64.StdEncoding.EncodeToString([]byte("a;b\n1;2\n"))},
+		},
+	}
+	message := buildEmailMessage(req, "contact@vintagestandards.fr")
+	msg := parseEmail(t, message)
+
+	_, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	boundary := params["boundary"]
+	if boundary == "" || strings.Count(message, "--"+boundary+"\r\n") != 3 || !strings.Contains(message, "--"+boundary+"--\r\n") {
+		t.Fatalf("frontière %q : attendu 3 parties (corps + 2 pièces jointes) et une fermeture", boundary)
+	}
+
+	parts := readParts(t, msg.Header.Get("Content-Type"), msg.Body)
+	if len(parts) != 3 {
+		t.Fatalf("%d parties, attendu 3", len(parts))
+	}
+
+	want := []struct{ filename, content string }{
+		{"devis.pdf", pdf},
+		{"export.csv", "a;b\n1;2\n"},
+	}
+	for i, w := range want {
+		p := parts[i+1]
+		if p.header.Get("Content-Transfer-Encoding") != "base64" {
+			t.Errorf("%s : Content-Transfer-Encoding = %q, attendu base64", w.filename, p.header.Get("Content-Transfer-Encoding"))
+		}
+		disposition, dparams, err := mime.ParseMediaType(p.header.Get("Content-Disposition"))
+		if err != nil || disposition != "attachment" || dparams["filename"] != w.filename {
+			t.Errorf("Content-Disposition = %q, attendu attachment; filename=%s", p.header.Get("Content-Disposition"), w.filename)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(p.body), "\r\n") {
+			if len(line) > 76 {
+				t.Errorf("%s : ligne Base64 de %d caractères (maximum 76)", w.filename, len(line))
+			}
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(p.body), ""))
+		if err != nil || string(decoded) != w.content {
+			t.Errorf("%s : contenu décodé = %q (%v), attendu %q", w.filename, decoded, err, w.content)
+		}
+	}
+}
+
+func TestAllAttachmentsKeepsLegacyFields(t *testing.T) {
+	req := EmailRequest{
+		AttachmentName: "ancien.pdf",
+		AttachmentData: "QUJD",
+		Attachments:    []Attachment{{Name: "nouveau.pdf", Data: "REVG"}, {Name: "vide.pdf"}},
+	}
+	got := req.allAttachments()
+	if len(got) != 2 || got[0].Name != "ancien.pdf" || got[1].Name != "nouveau.pdf" {
+		t.Errorf("allAttachments = %+v, attendu ancien.pdf puis nouveau.pdf", got)
+	}
+}
+
+func TestAttachmentContentType(t *testing.T) {
+	tests := []struct {
+		filename, override, want string
+	}{
+		{"devis.pdf", "", "application/pdf"},
+		{"LOGO.PNG", "", "image/png"},
+		{"export.csv", "", "text/csv"},
+		{"archive.inconnue", "", "application/octet-stream"},
+		{"sans-extension", "", "application/octet-stream"},
+		{"devis.pdf", "application/x-custom", "application/x-custom"},
+	}
+	for _, tt := range tests {
+		got := attachmentContentType(tt.filename, tt.override)
+		if mediaType, _, _ := mime.ParseMediaType(got); mediaType != tt.want {
+			t.Errorf("attachmentContentType(%q, %q) = %q, attendu %q", tt.filename, tt.override, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeHeader(t *testing.T) {
+	if got := encodeHeader("Devis 2024"); got != "Devis 2024" {
+		t.Errorf("sujet ASCII modifié : %q", got)
+	}
+
+	subject := "Devis été 2024 – n°42"
+	encoded := encodeHeader(subject)
+	if !strings.HasPrefix(encoded, "=?utf-8?q?") {
+		t.Fatalf("encodeHeader(%q) = %q, attendu un encodage RFC 2047", subject, encoded)
+	}
+	for _, c := range encoded {
+		if c > 0x7e {
+			t.Fatalf("sujet encodé non ASCII : %q", encoded)
+		}
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(encoded)
+	if err != nil || decoded != subject {
+		t.Errorf("décodage = %q (%v), attendu %q", decoded, err, subject)
+	}
+}
+
+func TestBuildEmailMessageEncodedSubject(t *testing.T) {
+	req := EmailRequest{To: "client@exemple.fr", Subject: "Facture réglée", Body: "Merci"}
+	msg := parseEmail(t, buildEmailMessage(req, "contact@vintagestandards.fr"))
+
+	decoded, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || decoded != req.Subject {
+		t.Errorf("Subject décodé = %q (%v), attendu %q", decoded, err, req.Subject)
+	}
+}
+
+func TestEncodeQuotedPrintableRoundTrip(t *testing.T) {
+	body := "Bonjour Élodie,\r\n\r\nVotre commande à 42 € est expédiée. " +
+		strings.Repeat("Une ligne très longue qui dépasse largement la limite. ", 5) +
+		"\r\nÉgalité = ok\r\n"
+
+	encoded := encodeQuotedPrintable(body)
+	for _, line := range strings.Split(encoded, "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("ligne encodée de %d caractères (maximum 76) : %q", len(line), line)
+		}
+		for _, c := range line {
+			if c > 0x7e {
+				t.Fatalf("caractère non ASCII dans le corps encodé : %q", line)
+			}
+		}
+	}
+
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(encoded)))
+	if err != nil || string(decoded) != body {
+		t.Errorf("décodage = %q (%v), attendu %q", decoded, err, body)
+	}
+}
+
+func TestNewBoundaryUnique(t *testing.T) {
+	req := EmailRequest{Body: "Bonjour"}
+	seen := make(map[string]bool)
+	for range 1000 {
+		b := req.newBoundary()
+		if seen[b] {
+			t.Fatalf("frontière %q générée deux fois", b)
+		}
+		seen[b] = true
+	}
+}
+
+func TestNewBoundaryAbsentFromContent(t *testing.T) {
+	req := EmailRequest{To: "client@exemple.fr", Subject: "Test", Body: "Bonjour", BodyHTML: "<p>Bonjour</p>"}
+	message := buildEmailMessage(req, "contact@vintagestandards.fr")
+	msg := parseEmail(t, message)
+
+	_, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	outer := params["boundary"]
+	parts := readParts(t, msg.Header.Get("Content-Type"), msg.Body)
+	_, params, _ = mime.ParseMediaType(parts[0].header.Get("Content-Type"))
+	inner := params["boundary"]
+
+	if outer == "" || inner == "" || outer == inner {
+		t.Errorf("frontières %q et %q : attendu deux frontières distinctes", outer, inner)
+	}
+	if req.contains(outer) || req.contains(inner) {
+		t.Error("une frontière apparaît dans le contenu du message")
+	}
+}
+
+func TestBuildEmailMessageReplyTo(t *testing.T) {
+	req := EmailRequest{To: "client@exemple.fr", Subject: "Devis", Body: "Bonjour"}
+	msg := parseEmail(t, buildEmailMessage(req, "contact@vintagestandards.fr"))
+	if _, ok := msg.Header["Reply-To"]; ok {
+		t.Error("en-tête Reply-To présent sans reply_to")
+	}
+
+	req.ReplyTo = "commercial@vintagestandards.fr"
+	msg = parseEmail(t, buildEmailMessage(req, "contact@vintagestandards.fr"))
+	addr, err := msg.Header.AddressList("Reply-To")
+	if err != nil || len(addr) != 1 || addr[0].Address != req.ReplyTo {
+		t.Errorf("Reply-To = %q, attendu %q", msg.Header.Get("Reply-To"), req.ReplyTo)
+	}
+}
+
+func TestReplyToValidation(t *testing.T) {
+	req := EmailRequest{To: "client@exemple.fr", Subject: "Devis", Body: "Bonjour", ReplyTo: "pas une adresse"}
+	errs := validateStruct(req)
+	if len(errs) != 1 || errs[0].Field != "reply_to" || errs[0].Code != "INVALID_EMAIL_ADDRESS" {
+		t.Errorf("erreurs = %+v, attendu reply_to invalide", errs)
+	}
+}
+
+func TestDecodedBase64Size(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 1000, 1001} {
+		data := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xff}, n))
+		if got := decodedBase64Size(data); got != int64(n) {
+			t.Errorf("decodedBase64Size(%d octets encodés) = %d", n, got)
+		}
+	}
+}
+
+func TestNormalizeAttachments(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+		wantErr          bool
+	}{
+		{"valide", "QmFzZTY0", "QmFzZTY0", false},
+		{"avec padding", "ZGV2aXM=", "ZGV2aXM=", false},
+		{"double padding", "ZGU=", "ZGU=", false},
+		{"espaces et retours à la ligne", "ZGV2\r\naXM=\n", "ZGV2aXM=", false},
+		{"caractère invalide", "ZGV2*XM=", "", true},
+		{"padding manquant", "ZGV2aXM", "", true},
+		{"longueur invalide", "ZGV2a", "", true},
+	}
+	for _, tt := range tests {
+		req := EmailRequest{AttachmentName: "devis.pdf", AttachmentData: tt.data}
+		err := req.normalizeAttachments()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s : err = %v, attendu erreur = %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (len(req.Attachments) != 1 || req.Attachments[0].Data != tt.want) {
+			t.Errorf("%s : pièces jointes = %+v, attendu %q", tt.name, req.Attachments, tt.want)
+		}
+	}
+}
+
+func TestBuildEmailMessageInlineImages(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n"))
+	req := EmailRequest{
+		To:           "client@exemple.fr",
+		Subject:      "Devis",
+		Body:         "Bonjour",
+		BodyHTML:     `<p><img src="cid:logo"> Bonjour</p>`,
+		InlineImages: []InlineImage{{Cid: "logo", Name: "logo.png", Data: png}},
+		Attachments:  []Attachment{{Name: "devis.pdf", Data: "JVBERi0="}},
+	}
+	if err := req.normalizeInlineImages(); err != nil {
+		t.Fatalf("normalizeInlineImages: %v", err)
+	}
+	parts := bodyParts(t, buildEmailMessage(req, "contact@vintagestandards.fr"))
+
+	// multipart/mixed : le corps puis la pièce jointe ordinaire
+	if len(parts) != 2 || parts[0].mediaType() != "multipart/alternative" || parts[1].mediaType() != "application/pdf" {
+		t.Fatalf("parties de premier niveau inattendues (%d)", len(parts))
+	}
+	alternatives := parts[0].subParts(t)
+	if len(alternatives) != 2 || alternatives[1].mediaType() != "multipart/related" {
+		t.Fatalf("attendu text/plain puis multipart/related, obtenu %d alternatives", len(alternatives))
+	}
+	if _, params, _ := mime.ParseMediaType(alternatives[1].header.Get("Content-Type")); params["type"] != "text/html" {
+		t.Errorf("multipart/related sans type=\"text/html\" : %q", alternatives[1].header.Get("Content-Type"))
+	}
+
+	// multipart/related : le HTML, puis l'image qu'il référence
+	related := alternatives[1].subParts(t)
+	if len(related) != 2 || related[0].mediaType() != "text/html" || related[1].mediaType() != "image/png" {
+		t.Fatalf("contenu de multipart/related inattendu (%d parties)", len(related))
+	}
+	img := related[1]
+	if got := img.header.Get("Content-ID"); got != "<logo>" {
+		t.Errorf("Content-ID = %q, attendu <logo>", got)
+	}
+	if disp, _, _ := mime.ParseMediaType(img.header.Get("Content-Disposition")); disp != "inline" {
+		t.Errorf("Content-Disposition = %q, attendu inline", img.header.Get("Content-Disposition"))
+	}
+	if data, _ := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(img.body), "")); string(data) != "\x89PNG\r\n\x1a\n" {
+		t.Errorf("contenu de l'image altéré : %q", data)
+	}
+}
+
+func TestNormalizeInlineImagesErrors(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString([]byte("png"))
+	tests := []struct {
+		name string
+		req  EmailRequest
+	}{
+		{"sans HTML", EmailRequest{InlineImages: []InlineImage{{Cid: "logo", Data: png}}}},
+		{"cid vide", EmailRequest{BodyHTML: "<p/>", InlineImages: []InlineImage{{Data: png}}}},
+		{"cid avec chevrons", EmailRequest{BodyHTML: "<p/>", InlineImages: []InlineImage{{Cid: "<logo>", Data: png}}}},
+		{"cid en double", EmailRequest{BodyHTML: "<p/>", InlineImages: []InlineImage{{Cid: "logo", Data: png}, {Cid: "logo", Data: png}}}},
+		{"Base64 invalide", EmailRequest{BodyHTML: "<p/>", InlineImages: []InlineImage{{Cid: "logo", Data: "***"}}}},
+	}
+	for _, tt := range tests {
+		if err := tt.req.normalizeInlineImages(); err == nil {
+			t.Errorf("%s : erreur attendue", tt.name)
+		}
+	}
+}
+
+func TestBuildEmailMessageCustomHeaders(t *testing.T) {
+	req := EmailRequest{
+		To:      "client@exemple.fr",
+		Subject: "Devis",
+		Body:    "Bonjour",
+		Headers: map[string]string{
+			"X-Campaign-ID":    "printemps-2026",
+			"List-Unsubscribe": "<mailto:desinscription@vintagestandards.fr>",
+			"x-commentaire":    "Envoyé depuis l'espace client",
+		},
+	}
+	if err := validateCustomHeaders(req.Headers); err != nil {
+		t.Fatalf("validateCustomHeaders: %v", err)
+	}
+	msg := parseEmail(t, buildEmailMessage(req, "contact@vintagestandards.fr"))
+
+	if got := msg.Header.Get("X-Campaign-ID"); got != "printemps-2026" {
+		t.Errorf("X-Campaign-ID = %q", got)
+	}
+	if got := msg.Header.Get("List-Unsubscribe"); got != "<mailto:desinscription@vintagestandards.fr>" {
+		t.Errorf("List-Unsubscribe = %q", got)
+	}
+	// Valeur non ASCII encodée en RFC 2047
+	raw := msg.Header.Get("X-Commentaire")
+	decoded, err := new(mime.WordDecoder).DecodeHeader(raw)
+	if err != nil || decoded != "Envoyé depuis l'espace client" || raw == decoded {
+		t.Errorf("X-Commentaire = %q (décodé %q), attendu un encodage RFC 2047", raw, decoded)
+	}
+}
+
+func TestValidateCustomHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantErr bool
+	}{
+		{"en-tête valide", map[string]string{"X-Campaign-ID": "42"}, false},
+		{"injection CRLF", map[string]string{"X-Campaign-ID": "42\r\nBcc: victime@exemple.fr"}, true},
+		{"injection LF", map[string]string{"X-Campaign-ID": "42\nBcc: victime@exemple.fr"}, true},
+		{"From protégé", map[string]string{"From": "pirate@exemple.fr"}, true},
+		{"to protégé (casse)", map[string]string{"to": "pirate@exemple.fr"}, true},
+		{"Content-Type protégé", map[string]string{"content-type": "text/html"}, true},
+		{"MIME-Version protégé", map[string]string{"Mime-Version": "2.0"}, true},
+		{"nom avec deux-points", map[string]string{"X-A:B": "1"}, true},
+		{"nom avec espace", map[string]string{"X Campaign": "1"}, true},
+		{"nom vide", map[string]string{"": "1"}, true},
+	}
+	for _, tt := range tests {
+		if err := validateCustomHeaders(tt.headers); (err != nil) != tt.wantErr {
+			t.Errorf("%s : err = %v, attendu erreur = %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := map[string]string{
+		"devis.pdf":                 "devis.pdf",
+		"Facture été 2026.pdf":      "Facture été 2026.pdf",
+		`devis "final".pdf`:         "devis final.pdf",
+		"devis\r\nBcc: x@y.fr.pdf":  "devisBcc: x@y.fr.pdf",
+		"../../etc/passwd":          "passwd",
+		`C:\Users\client\devis.pdf`: "devis.pdf",
+		"dossier/":                  "attachment",
+		"..":                        "attachment",
+		"":                          "attachment",
+		"\r\n":                      "attachment",
+	}
+	for name, want := range tests {
+		if got := sanitizeFilename(name); got != want {
+			t.Errorf("sanitizeFilename(%q) = %q, attendu %q", name, got, want)
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"devis.pdf", "attachment; filename=devis.pdf"},
+		{"devis final.pdf", `attachment; filename="devis final.pdf"`},
+		{"Facture été.pdf", "attachment; filename*=utf-8''Facture%20%C3%A9t%C3%A9.pdf"},
+	}
+	for _, tt := range tests {
+		got := contentDisposition("attachment", tt.filename)
+		if got != tt.want {
+			t.Errorf("contentDisposition(%q) = %q, attendu %q", tt.filename, got, tt.want)
+		}
+		// Le nom d'origine est restitué par un lecteur conforme
+		if _, params, err := mime.ParseMediaType(got); err != nil || params["filename"] != tt.filename {
+			t.Errorf("contentDisposition(%q) relu = %q (%v)", tt.filename, params["filename"], err)
+		}
+	}
+}
+
+func TestFromHeader(t *testing.T) {
+	tests := []struct {
+		name, fromName, fromAddress string
+		want                        string
+	}{
+		{"adresse authentifiée seule", "", "", "<contact@vintagestandards.fr>"},
+		{"nom affiché", "Vintage Standards", "", `"Vintage Standards" <contact@vintagestandards.fr>`},
+		{"adresse distincte", "Vintage Standards", "devis@vintagestandards.fr", `"Vintage Standards" <devis@vintagestandards.fr>`},
+		{"nom accentué", "Éditions Vintage", "", "=?utf-8?q?=C3=89ditions_Vintage?= <contact@vintagestandards.fr>"},
+	}
+	for _, tt := range tests {
+		t.Setenv("SMTP_FROM_NAME", tt.fromName)
+		t.Setenv("SMTP_FROM_ADDRESS", tt.fromAddress)
+		got := fromHeader("contact@vintagestandards.fr")
+		if got != tt.want {
+			t.Errorf("%s : From = %q, attendu %q", tt.name, got, tt.want)
+		}
+		// Relu par un client : nom décodé, adresse intacte
+		addr, err := mail.ParseAddress(got)
+		if err != nil || addr.Name != tt.fromName {
+			t.Errorf("%s : relu = %+v (%v), attendu le nom %q", tt.name, addr, err, tt.fromName)
+		}
+	}
+}
+
+func TestSendEmailFromAndEnvelopeSender(t *testing.T) {
+	s := useFakeSMTP(t)
+	t.Setenv("SMTP_FROM_NAME", "Vintage Standards")
+	t.Setenv("SMTP_FROM_ADDRESS", "devis@vintagestandards.fr")
+
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s)", w.Code, w.Body)
+	}
+	got := s.received()
+	if len(got) != 1 {
+		t.Fatalf("%d messages reçus, attendu 1", len(got))
+	}
+	if got[0].from != "contact@vintagestandards.fr" {
+		t.Errorf("MAIL FROM = %q, attendu l'adresse authentifiée", got[0].from)
+	}
+	if from := parseEmail(t, got[0].data).Header.Get("From"); from != `"Vintage Standards" <devis@vintagestandards.fr>` {
+		t.Errorf("From = %q", from)
+	}
+}
+
+func TestApplySubjectPrefix(t *testing.T) {
+	t.Setenv("SUBJECT_PREFIX", " [Vintage Standards] ")
+	tests := map[string]string{
+		"Devis":                         "[Vintage Standards] Devis",
+		"[Vintage Standards] Re: Devis": "[Vintage Standards] Re: Devis",
+		"Facture réglée":                "[Vintage Standards] Facture réglée",
+	}
+	for subject, want := range tests {
+		if got := applySubjectPrefix(subject); got != want {
+			t.Errorf("applySubjectPrefix(%q) = %q, attendu %q", subject, got, want)
+		}
+	}
+
+	t.Setenv("SUBJECT_PREFIX", "")
+	if got := applySubjectPrefix("Devis"); got != "Devis" {
+		t.Errorf("sans SUBJECT_PREFIX : %q, attendu Devis", got)
+	}
+}
+
+func TestSendEmailSubjectPrefix(t *testing.T) {
+	s := useFakeSMTP(t)
+	t.Setenv("SUBJECT_PREFIX", "[Vintage Standards]")
+
+	subjects := []struct {
+		body string
+		want string
+	}{
+		{`{"to":"client@exemple.fr","subject":"Devis été","body":"Bonjour"}`, "[Vintage Standards] Devis été"},
+		{`{"to":"client@exemple.fr","subject":"Devis été","body":"Bonjour","no_subject_prefix":true}`, "Devis été"},
+	}
+	for i, tt := range subjects {
+		if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", tt.body); w.Code != http.StatusOK {
+			t.Fatalf("statut = %d (%s)", w.Code, w.Body)
+		}
+		raw := parseEmail(t, s.received()[i].data).Header.Get("Subject")
+		// Préfixe et sujet encodés ensemble : le préfixe reste lisible une fois décodé
+		if !strings.HasPrefix(raw, "=?utf-8?q?") {
+			t.Errorf("Subject = %q, attendu un encodage RFC 2047", raw)
+		}
+		decoded, err := new(mime.WordDecoder).DecodeHeader(raw)
+		if err != nil || decoded != tt.want {
+			t.Errorf("Subject décodé = %q (%v), attendu %q", decoded, err, tt.want)
+		}
+	}
+}
+
+func TestAllowedAttachmentType(t *testing.T) {
+	t.Setenv("ALLOWED_ATTACHMENT_TYPES", "")
+	for contentType, want := range map[string]bool{
+		"application/pdf":          true,
+		"Image/PNG":                true,
+		"text/csv; charset=utf-8":  true,
+		"application/octet-stream": false,
+		"application/x-msdownload": false,
+		"application/vnd.ms-excel": false,
+	} {
+		if got := allowedAttachmentType(contentType); got != want {
+			t.Errorf("allowedAttachmentType(%q) = %v, attendu %v", contentType, got, want)
+		}
+	}
+
+	t.Setenv("ALLOWED_ATTACHMENT_TYPES", "application/zip")
+	if allowedAttachmentType("application/pdf") || !allowedAttachmentType("application/zip") {
+		t.Error("ALLOWED_ATTACHMENT_TYPES=application/zip non appliqué")
+	}
+	t.Setenv("ALLOWED_ATTACHMENT_TYPES", "*")
+	if !allowedAttachmentType("application/octet-stream") {
+		t.Error("ALLOWED_ATTACHMENT_TYPES=* : type refusé")
+	}
+}
+
+func TestSendEmailAttachmentTypes(t *testing.T) {
+	s := useFakeSMTP(t)
+	t.Setenv("ALLOWED_ATTACHMENT_TYPES", "")
+
+	send := func(attachment string) *httptest.ResponseRecorder {
+		return serve(sendEmailHandler, http.MethodPost, "/api/send-email",
+			`{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour","body_html":"<img src=\"cid:logo\">",`+attachment+`}`)
+	}
+
+	if w := send(`"attachments":[{"name":"devis.pdf","data":"JVBERi0xLjQ="}]`); w.Code != http.StatusOK {
+		t.Fatalf("devis.pdf : statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+
+	for name, attachment := range map[string]string{
+		"exécutable":            `"attachments":[{"name":"setup.exe","data":"TVqQAA=="}]`,
+		"exécutable en PDF":     `"attachments":[{"name":"setup.exe","data":"TVqQAA==","content_type":"application/pdf"}]`,
+		"champs historiques":    `"attachment_name":"setup.exe","attachment_data":"TVqQAA=="`,
+		"image intégrée en PDF": `"inline_images":[{"cid":"logo","name":"logo.pdf","data":"JVBERi0xLjQ="}]`,
+	} {
+		w := send(attachment)
+		if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != "ATTACHMENT_TYPE_NOT_ALLOWED" {
+			t.Errorf("%s : statut = %d (%s), attendu 400 ATTACHMENT_TYPE_NOT_ALLOWED", name, w.Code, w.Body)
+		}
+	}
+	if n := len(s.received()); n != 1 {
+		t.Errorf("%d messages envoyés, attendu 1 (seul le PDF)", n)
+	}
+}
+
+func TestEmailPreview(t *testing.T) {
+	s := useFakeSMTP(t)
+
+	body := `{"to":"client@exemple.fr","subject":"Devis été 2024","body":"Bonjour","attachments":[{"name":"devis.pdf","data":"JVBERi0xLjQ="}]}`
+	w := serve(emailPreviewHandler, http.MethodPost, "/api/email/preview", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q, attendu text/plain", ct)
+	}
+
+	raw := w.Body.String()
+	msg := parseEmail(t, raw)
+	if subject := msg.Header.Get("Subject"); !strings.HasPrefix(subject, "=?utf-8?q?") {
+		t.Errorf("Subject = %q, attendu un encodage RFC 2047", subject)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		t.Fatalf("Content-Type = %q, attendu un multipart avec boundary", msg.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(raw, "\r\n--"+params["boundary"]+"\r\n") || !strings.Contains(raw, "--"+params["boundary"]+"--") {
+		t.Errorf("boundary %q absente du corps", params["boundary"])
+	}
+	if !strings.Contains(raw, "JVBERi0xLjQ=") {
+		t.Error("pièce jointe absente de l'aperçu")
+	}
+	if n := s.connCount(); n != 0 {
+		t.Errorf("%d connexions SMTP pour un aperçu", n)
+	}
+
+	// Aperçu possible sans configuration SMTP ; requête invalide : erreur JSON
+	t.Setenv("SMTP_HOST", "")
+	if w := serve(emailPreviewHandler, http.MethodPost, "/api/email/preview", body); w.Code != http.StatusOK {
+		t.Errorf("sans SMTP_HOST : statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	w = serve(emailPreviewHandler, http.MethodPost, "/api/email/preview", `{"to":"client@exemple.fr"}`)
+	if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != "VALIDATION_FAILED" {
+		t.Errorf("requête invalide : statut = %d (%s), attendu 400 VALIDATION_FAILED", w.Code, w.Body)
+	}
+}
+
+func TestRecipientsUnmarshalJSON(t *testing.T) {
+	tests := map[string]string{
+		`"client@exemple.fr"`:                                              "client@exemple.fr",
+		`["a@exemple.fr", " ", "Bob <b@exemple.fr>"]`:                      "a@exemple.fr, Bob <b@exemple.fr>",
+		`{"name":"Élodie Martin","address":"elodie@exemple.fr"}`:           "=?utf-8?q?=C3=89lodie_Martin?= <elodie@exemple.fr>",
+		`[{"name":"Martin, Paul","address":" paul@exemple.fr "},"c@x.fr"]`: `"Martin, Paul" <paul@exemple.fr>, c@x.fr`,
+	}
+	for input, want := range tests {
+		var r Recipients
+		if err := json.Unmarshal([]byte(input), &r); err != nil || string(r) != want {
+			t.Errorf("Unmarshal(%s) = %q, %v, attendu %q", input, r, err, want)
+		}
+	}
+
+	for _, input := range []string{`[{"name":"Élodie"}]`, `[42]`} {
+		var r Recipients
+		if err := json.Unmarshal([]byte(input), &r); err == nil {
+			t.Errorf("Unmarshal(%s) : erreur attendue", input)
+		}
+	}
+}
+
+func TestSendEmailNamedRecipients(t *testing.T) {
+	s := useFakeSMTP(t)
+
+	body := `{
+		"to": [{"name": "Élodie Martin", "address": "elodie@exemple.fr"}, "paul@exemple.fr"],
+		"cc": {"name": "Service comptabilité", "address": "compta@exemple.fr"},
+		"bcc": [{"name": "Archive", "address": "archive@exemple.fr"}],
+		"subject": "Devis",
+		"body": "Bonjour"
+	}`
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body); w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s)", w.Code, w.Body)
+	}
+	mails := s.received()
+	if len(mails) != 1 {
+		t.Fatalf("%d messages reçus, attendu 1", len(mails))
+	}
+
+	// Enveloppe : adresses nues uniquement
+	want := []string{"elodie@exemple.fr", "paul@exemple.fr", "compta@exemple.fr", "archive@exemple.fr"}
+	if !slices.Equal(mails[0].to, want) {
+		t.Errorf("RCPT TO = %v, attendu %v", mails[0].to, want)
+	}
+
+	msg := parseEmail(t, mails[0].data)
+	raw := msg.Header.Get("To")
+	if !strings.Contains(raw, "=?utf-8?q?=C3=89lodie_Martin?= <elodie@exemple.fr>") {
+		t.Errorf("To = %q, attendu le nom encodé en RFC 2047", raw)
+	}
+	to, err := msg.Header.AddressList("To")
+	if err != nil || len(to) != 2 || to[0].Name != "Élodie Martin" || to[1].Address != "paul@exemple.fr" {
+		t.Errorf("To décodé = %v (%v)", to, err)
+	}
+	cc, err := msg.Header.AddressList("Cc")
+	if err != nil || len(cc) != 1 || cc[0].Name != "Service comptabilité" || cc[0].Address != "compta@exemple.fr" {
+		t.Errorf("Cc décodé = %v (%v)", cc, err)
+	}
+	if bcc := msg.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("Bcc = %q, attendu absent des en-têtes", bcc)
+	}
+}
+
+func TestDedupRecipients(t *testing.T) {
+	to := []string{"a@exemple.fr", "A@Exemple.fr", "a+devis@exemple.fr", "b@exemple.fr", "a@exemple.fr", "b+x@autre.fr"}
+	tests := map[string][]string{
+		"":      to,
+		"off":   to,
+		"exact": {"a@exemple.fr", "a+devis@exemple.fr", "b@exemple.fr", "b+x@autre.fr"},
+		"Plus":  {"a@exemple.fr", "b@exemple.fr", "b+x@autre.fr"},
+	}
+	for policy, want := range tests {
+		t.Setenv("RECIPIENT_DEDUP", policy)
+		if got := dedupRecipients(slices.Clone(to)); !slices.Equal(got, want) {
+			t.Errorf("RECIPIENT_DEDUP=%q : %v, attendu %v", policy, got, want)
+		}
+	}
+}
+
+func TestSendEmailDedupRecipients(t *testing.T) {
+	s := useFakeSMTP(t)
+	t.Setenv("RECIPIENT_DEDUP", "plus")
+
+	body := `{"to":["client@exemple.fr","Client+devis@exemple.fr"],"cc":"client@exemple.fr","bcc":"compta@exemple.fr","subject":"Devis","body":"Bonjour"}`
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body); w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s)", w.Code, w.Body)
+	}
+	mails := s.received()
+	if len(mails) != 1 {
+		t.Fatalf("%d messages reçus, attendu 1", len(mails))
+	}
+	if want := []string{"client@exemple.fr", "compta@exemple.fr"}; !slices.Equal(mails[0].to, want) {
+		t.Errorf("RCPT TO = %v, attendu %v (un seul envoi par boîte)", mails[0].to, want)
+	}
+	// En-têtes inchangés : seule l'enveloppe est dédupliquée
+	if to := parseEmail(t, mails[0].data).Header.Get("To"); !strings.Contains(to, "Client+devis@exemple.fr") {
+		t.Errorf("To = %q, attendu les destinataires tels que fournis", to)
+	}
+}
+
+func TestLimitSubject(t *testing.T) {
+	t.Setenv("MAX_SUBJECT_LENGTH", "10")
+	t.Setenv("SUBJECT_TOO_LONG", "")
+
+	tests := map[string]string{
+		"Devis":             "Devis",
+		"Devis 2024":        "Devis 2024", // exactement la limite
+		"Devis été 2024":    "Devis été…",
+		"Facture    n° 42":  "Facture…",   // espaces avant l'ellipse supprimés
+		"ééééééééééééééééé": "ééééééééé…", // en caractères, pas en octets
+	}
+	for subject, want := range tests {
+		got, err := limitSubject(subject)
+		if err != nil || got != want {
+			t.Errorf("limitSubject(%q) = %q, %v, attendu %q", subject, got, err, want)
+		}
+		if n := len([]rune(got)); n > 10 {
+			t.Errorf("limitSubject(%q) : %d caractères, maximum 10", subject, n)
+		}
+	}
+
+	t.Setenv("SUBJECT_TOO_LONG", "reject")
+	if _, err := limitSubject("Devis été 2024"); err == nil {
+		t.Error("SUBJECT_TOO_LONG=reject : sujet trop long accepté")
+	}
+	if got, err := limitSubject("Devis"); err != nil || got != "Devis" {
+		t.Errorf("SUBJECT_TOO_LONG=reject : limitSubject(Devis) = %q, %v", got, err)
+	}
+
+	t.Setenv("MAX_SUBJECT_LENGTH", "0")
+	if got, _ := limitSubject(strings.Repeat("a", 1000)); len(got) != 1000 {
+		t.Errorf("MAX_SUBJECT_LENGTH=0 : sujet tronqué à %d caractères", len(got))
+	}
+}
+
+func TestSendEmailSubjectLength(t *testing.T) {
+	s := useFakeSMTP(t)
+	t.Setenv("MAX_SUBJECT_LENGTH", "20")
+	t.Setenv("SUBJECT_PREFIX", "[VS]")
+	subject := "Votre devis pour l'été 2024"
+
+	// Troncature, préfixe compris, avant l'encodage RFC 2047
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"`+subject+`","body":"Bonjour"}`); w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s)", w.Code, w.Body)
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(parseEmail(t, s.received()[0].data).Header.Get("Subject"))
+	if err != nil || decoded != "[VS] Votre devis po…" {
+		t.Errorf("Subject décodé = %q (%v), attendu le sujet tronqué", decoded, err)
+	}
+
+	t.Setenv("SUBJECT_TOO_LONG", "reject")
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"`+subject+`","body":"Bonjour"}`)
+	if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != "SUBJECT_TOO_LONG" {
+		t.Errorf("mode reject : statut = %d (%s), attendu 400 SUBJECT_TOO_LONG", w.Code, w.Body)
+	}
+	if n := len(s.received()); n != 1 {
+		t.Errorf("%d messages reçus, attendu 1", n)
+	}
+}
+
+func TestSendEmailLongAccentedSubjectFolded(t *testing.T) {
+	s := useFakeSMTP(t)
+	t.Setenv("MAX_SUBJECT_LENGTH", "")
+	t.Setenv("SUBJECT_PREFIX", "")
+	// Sujet accentué à la longueur maximale (255 caractères) : ~1 500 octets
+	// une fois encodé, à replier en lignes de 998 octets au plus
+	subject := strings.Repeat("é", 255)
+
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"`+subject+`","body":"Bonjour"}`); w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s)", w.Code, w.Body)
+	}
+	data := s.received()[0].data
+	// Fins de ligne CRLF rendues en LF par le serveur de test
+	header, _, _ := strings.Cut(strings.ReplaceAll(data, "\r\n", "\n"), "\n\n")
+	for _, line := range strings.Split(header, "\n") {
+		if len(line) > 998 {
+			t.Errorf("ligne d'en-tête de %d octets, maximum 998 : %.40q…", len(line), line)
+		}
+		// Mots encodés repliés un par ligne (75 caractères au plus)
+		if word := strings.TrimSpace(strings.TrimPrefix(line, "Subject:")); strings.HasPrefix(word, "=?") && len(word) > 75 {
+			t.Errorf("mot encodé de %d caractères, maximum 75 : %q", len(word), word)
+		}
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(parseEmail(t, data).Header.Get("Subject"))
+	if err != nil || decoded != subject {
+		t.Errorf("Subject décodé = %q (%v), attendu le sujet complet", decoded, err)
+	}
+}
+
+// testICS : invitation minimale, lignes terminées par CRLF (RFC 5545)
+const testICS = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nMETHOD:REQUEST\r\nBEGIN:VEVENT\r\nUID:rdv-42@vintagestandards.fr\r\nDTSTART:20260115T100000Z\r\nSUMMARY:Rendez-vous atelier été\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func TestBuildEmailMessageCalendarInvite(t *testing.T) {
+	req := EmailRequest{To: "client@exemple.fr", Subject: "Rendez-vous", Body: "Bonjour", BodyHTML: "<p>Bonjour</p>", ICS: testICS}
+	parts := bodyParts(t, buildEmailMessage(req, "contact@vintagestandards.fr"))
+	if len(parts) != 1 || parts[0].mediaType() != "multipart/alternative" {
+		t.Fatalf("parties = %d, attendu une partie multipart/alternative", len(parts))
+	}
+
+	alternatives := parts[0].subParts(t)
+	var types []string
+	for _, p := range alternatives {
+		types = append(types, p.mediaType())
+	}
+	if want := []string{"text/plain", "text/html", "text/calendar"}; !slices.Equal(types, want) {
+		t.Fatalf("alternatives = %v, attendu %v", types, want)
+	}
+
+	calendar := alternatives[2]
+	_, params, _ := mime.ParseMediaType(calendar.header.Get("Content-Type"))
+	if params["method"] != "REQUEST" || params["charset"] != "utf-8" {
+		t.Errorf("Content-Type = %q, attendu method=REQUEST et charset utf-8", calendar.header.Get("Content-Type"))
+	}
+	if calendar.body != testICS {
+		t.Errorf("invitation décodée = %q, attendu %q", calendar.body, testICS)
+	}
+}
+
+func TestValidateICS(t *testing.T) {
+	for ics, valid := range map[string]bool{
+		testICS:                      true,
+		"\ufeffBEGIN:VCALENDAR\r\n":  true,
+		"  begin:vcalendar\r\n":      true,
+		"BEGIN:VEVENT\r\nEND:VEVENT": false,
+		"Rendez-vous le 15 janvier":  false,
+	} {
+		if err := validateICS(ics); (err == nil) != valid {
+			t.Errorf("validateICS(%q) = %v, attendu valide = %v", ics, err, valid)
+		}
+	}
+
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Rendez-vous","body":"Bonjour","ics":"SUMMARY:rdv","dry_run":true}`)
+	if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != "INVALID_ICS" {
+		t.Errorf("ics invalide : statut = %d (%s), attendu 400 INVALID_ICS", w.Code, w.Body)
+	}
+}
+
+// messageIDPattern : <jeton hexadécimal de 16 octets@domaine>
+var messageIDPattern = regexp.MustCompile(`^<[0-9a-f]{32}@[a-z0-9.-]+>$`)
+
+func TestNewMessageID(t *testing.T) {
+	tests := map[string]string{
+		"contact@vintagestandards.fr":                     "@vintagestandards.fr>",
+		`"Vintage Standards" <devis@vintagestandards.fr>`: "@vintagestandards.fr>",
+		"pas une adresse":                                 "@localhost>",
+	}
+	for from, suffix := range tests {
+		id := newMessageID(from)
+		if !messageIDPattern.MatchString(id) || !strings.HasSuffix(id, suffix) {
+			t.Errorf("newMessageID(%q) = %q, attendu <jeton%s", from, id, suffix)
+		}
+	}
+	if newMessageID("contact@vintagestandards.fr") == newMessageID("contact@vintagestandards.fr") {
+		t.Error("deux Message-ID identiques")
+	}
+}
+
+func TestNormalizeMessageID(t *testing.T) {
+	valid := map[string]string{
+		"devis-42@vintagestandards.fr":     "<devis-42@vintagestandards.fr>",
+		" <devis-42@vintagestandards.fr> ": "<devis-42@vintagestandards.fr>",
+	}
+	for input, want := range valid {
+		if got, err := normalizeMessageID(input); err != nil || got != want {
+			t.Errorf("normalizeMessageID(%q) = %q, %v, attendu %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"devis-42", "@vintagestandards.fr", "devis 42@exemple.fr", "a@b@c", "dévis@exemple.fr", strings.Repeat("a", 250) + "@exemple.fr"} {
+		if _, err := normalizeMessageID(input); err == nil {
+			t.Errorf("normalizeMessageID(%q) : erreur attendue", input)
+		}
+	}
+}
+
+func TestSendEmailMessageID(t *testing.T) {
+	s := useFakeSMTP(t)
+	t.Setenv("SMTP_FROM_ADDRESS", "devis@vintagestandards.fr")
+
+	send := func(extra string) (string, string) {
+		t.Helper()
+		w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"`+extra+`}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("statut = %d (%s)", w.Code, w.Body)
+		}
+		var resp map[string]string
+		json.NewDecoder(w.Body).Decode(&resp)
+		mails := s.received()
+		return resp["message_id"], parseEmail(t, mails[len(mails)-1].data).Header.Get("Message-ID")
+	}
+
+	// Généré depuis le domaine de l'expéditeur, et retourné au client
+	returned, header := send("")
+	if !messageIDPattern.MatchString(header) || !strings.HasSuffix(header, "@vintagestandards.fr>") || returned != header {
+		t.Errorf("Message-ID = %q, réponse = %q, attendu un identifiant généré identique", header, returned)
+	}
+
+	// Fourni par l'appelant : conservé (entre chevrons)
+	returned, header = send(`,"message_id":"devis-42@vintagestandards.fr"`)
+	if header != "<devis-42@vintagestandards.fr>" || returned != header {
+		t.Errorf("Message-ID = %q, réponse = %q, attendu <devis-42@vintagestandards.fr>", header, returned)
+	}
+
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour","message_id":"devis 42"}`)
+	if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != "INVALID_MESSAGE_ID" {
+		t.Errorf("Message-ID invalide : statut = %d (%s), attendu 400 INVALID_MESSAGE_ID", w.Code, w.Body)
+	}
+}
+
+// useMailNow fige la date des messages construits le temps du test
+func useMailNow(t *testing.T, now time.Time) {
+	t.Helper()
+	previous := mailNow
+	mailNow = func() time.Time { return now }
+	t.Cleanup(func() { mailNow = previous })
+}
+
+func TestBuildEmailMessageDate(t *testing.T) {
+	now := time.Date(2026, time.January, 15, 10, 30, 0, 0, time.FixedZone("CET", 3600))
+	useMailNow(t, now)
+
+	req := EmailRequest{To: "client@exemple.fr", Subject: "Devis", Body: "Bonjour", Headers: map[string]string{"date": "Thu, 01 Jan 1970 00:00:00 +0000"}}
+	msg := parseEmail(t, buildEmailMessage(req, "contact@vintagestandards.fr"))
+	if got := msg.Header["Date"]; len(got) != 1 || got[0] != "Thu, 15 Jan 2026 10:30:00 +0100" {
+		t.Errorf("Date = %q, attendu un seul en-tête au format RFC 1123Z", got)
+	}
+	date, err := msg.Header.Date()
+	if err != nil || !date.Equal(now) {
+		t.Errorf("Date relue = %v (%v), attendu %v", date, err, now)
+	}
+
+	// Renvoi : Resent-Date à l'heure du renvoi
+	resent := parseEmail(t, string(resentMessage([]byte("Subject: Devis\r\n\r\nBonjour\r\n"), "contact@vintagestandards.fr", []string{"client@exemple.fr"}, mailNow())))
+	if got := resent.Header.Get("Resent-Date"); got != "Thu, 15 Jan 2026 10:30:00 +0100" {
+		t.Errorf("Resent-Date = %q", got)
+	}
+}
+
+func TestSendEmailDateHeader(t *testing.T) {
+	s := useFakeSMTP(t)
+
+	before := time.Now().Truncate(time.Second)
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`); w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s)", w.Code, w.Body)
+	}
+	date, err := parseEmail(t, s.received()[0].data).Header.Date()
+	if err != nil || date.Before(before) || date.After(time.Now()) {
+		t.Errorf("Date = %v (%v), attendu l'heure de l'envoi", date, err)
+	}
+}
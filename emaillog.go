@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- JOURNAL DES ENVOIS D'EMAIL ---
+
+const (
+	defaultEmailLogLimit = 50
+	maxEmailLogLimit     = 500
+)
+
+// EmailLogEntry trace un envoi (réussi ou non) pour l'audit
+type EmailLogEntry struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	To        []string  `json:"to"`
+	Subject   string    `json:"subject"`
+	Size      int       `json:"size"`   // Taille du message MIME en octets
+	Status    string    `json:"status"` // "sent" ou "failed"
+	Error     string    `json:"error,omitempty"`
+	Message   []byte    `json:"-"` // Message MIME complet, conservé si EMAIL_LOG_KEEP_CONTENT=1
+}
+
+type EmailLogResponse struct {
+	Results []EmailLogEntry `json:"results"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+	Total   int             `json:"total"`
+}
+
+// emailLogFilter : critères de GET /api/emails
+type emailLogFilter struct {
+	Status string // vide = tous
+	Limit  int
+	Offset int
+}
+
+// EmailLogStore enregistre les envois : en mémoire par défaut, dans SQLite
+// si DB_PATH est défini
+type EmailLogStore interface {
+	Add(entry EmailLogEntry) error
+	// List retourne les entrées filtrées, de la plus récente à la plus
+	// ancienne, ainsi que leur nombre total avant pagination
+	List(f emailLogFilter) ([]EmailLogEntry, int, error)
+	// Get retourne une entrée avec son message s'il a été conservé
+	// (errEmailLogEntryNotFound si elle n'existe pas ou plus)
+	Get(id int64) (EmailLogEntry, error)
+}
+
+var errEmailLogEntryNotFound = errors.New("envoi absent du journal")
+
+// Journal utilisé par les handlers, choisi au démarrage (voir DB_PATH)
+var sentEmails EmailLogStore = newMemoryEmailLog(envInt("EMAIL_LOG_SIZE", 1000))
+
+// keepEmailContent indique si le message complet est conservé dans le
+// journal, ce qui permet de le renvoyer (POST /api/emails/{id}/resend)
+func keepEmailContent() bool {
+	return getenv("EMAIL_LOG_KEEP_CONTENT") == "1"
+}
+
+// recordEmail ajoute une entrée au journal ; un échec n'empêche pas l'envoi
+func recordEmail(entry EmailLogEntry) {
+	if err := sentEmails.Add(entry); err != nil {
+		slog.Error("échec de l'enregistrement dans le journal des envois", "error", err)
+	}
+}
+
+// memoryEmailLog conserve les derniers envois en mémoire (EMAIL_LOG_SIZE, les
+// plus anciens sont oubliés au-delà)
+type memoryEmailLog struct {
+	mu      sync.Mutex
+	entries []EmailLogEntry
+	nextID  int64
+	size    int
+}
+
+// Une taille négative équivaut à 0 (aucun envoi conservé)
+func newMemoryEmailLog(size int) *memoryEmailLog {
+	return &memoryEmailLog{size: max(size, 0)}
+}
+
+func (l *memoryEmailLog) Add(entry EmailLogEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.nextID++
+	entry.ID = l.nextID
+	l.entries = append(l.entries, entry)
+	if over := len(l.entries) - l.size; over > 0 {
+		l.entries = append([]EmailLogEntry(nil), l.entries[over:]...)
+	}
+	return nil
+}
+
+func (l *memoryEmailLog) List(f emailLogFilter) ([]EmailLogEntry, int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	results := []EmailLogEntry{}
+	total := 0
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		e := l.entries[i]
+		if f.Status != "" && e.Status != f.Status {
+			continue
+		}
+		if total >= f.Offset && len(results) < f.Limit {
+			results = append(results, e)
+		}
+		total++
+	}
+	return results, total, nil
+}
+
+func (l *memoryEmailLog) Get(id int64) (EmailLogEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, e := range l.entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return EmailLogEntry{}, errEmailLogEntryNotFound
+}
+
+// emailLogHandler : GET /api/emails?status=failed&limit=50&offset=0
+func emailLogHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != "sent" && status != "failed" {
+		writeError(w, http.StatusBadRequest, "INVALID_STATUS", "Le paramètre 'status' doit valoir 'sent' ou 'failed'")
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultEmailLogLimit)
+	if err != nil || limit < 1 || limit > maxEmailLogLimit {
+		writeError(w, http.StatusBadRequest, "INVALID_PAGINATION",
+			fmt.Sprintf("Le paramètre 'limit' doit être compris entre 1 et %d", maxEmailLogLimit))
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "INVALID_PAGINATION", "Le paramètre 'offset' doit être un entier positif ou nul")
+		return
+	}
+
+	results, total, err := sentEmails.List(emailLogFilter{Status: status, Limit: limit, Offset: offset})
+	if err != nil {
+		loggerFromContext(r.Context()).Error("lecture du journal des envois impossible", "error", err)
+		writeError(w, http.StatusInternalServerError, "EMAIL_LOG_UNAVAILABLE", "Journal des envois indisponible")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(EmailLogResponse{
+		Results: results,
+		Limit:   limit,
+		Offset:  offset,
+		Total:   total,
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // Pilote SQLite pur Go (compatible CGO_ENABLED=0)
+)
+
+// --- JOURNAL DES ENVOIS (SQLite) ---
+
+// Migrations appliquées au démarrage, dans l'ordre
+var emailLogMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS email_log (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp  TEXT    NOT NULL,
+		recipients TEXT    NOT NULL,
+		subject    TEXT    NOT NULL,
+		size       INTEGER NOT NULL,
+		status     TEXT    NOT NULL,
+		error      TEXT    NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS email_log_status ON email_log (status, id)`,
+	// Messages conservés (EMAIL_LOG_KEEP_CONTENT=1), séparés pour garder la
+	// liste légère
+	`CREATE TABLE IF NOT EXISTS email_content (
+		id      INTEGER PRIMARY KEY REFERENCES email_log (id),
+		message BLOB    NOT NULL
+	)`,
+}
+
+// sqliteEmailLog persiste le journal des envois (survit aux redémarrages)
+type sqliteEmailLog struct {
+	db *sql.DB
+}
+
+// openSQLiteEmailLog ouvre (ou crée) la base DB_PATH et applique les migrations
+func openSQLiteEmailLog(path string) (*sqliteEmailLog, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite n'accepte qu'un écrivain à la fois
+	db.SetMaxOpenConns(1)
+
+	for _, m := range emailLogMigrations {
+		if _, err := db.Exec(m); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("migration du journal des envois : %v", err)
+		}
+	}
+	return &sqliteEmailLog{db: db}, nil
+}
+
+func (l *sqliteEmailLog) Close() error {
+	return l.db.Close()
+}
+
+func (l *sqliteEmailLog) Add(entry EmailLogEntry) error {
+	recipients, err := json.Marshal(entry.To)
+	if err != nil {
+		return err
+	}
+
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`INSERT INTO email_log (timestamp, recipients, subject, size, status, error) VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano), string(recipients), entry.Subject, entry.Size, entry.Status, entry.Error,
+	)
+	if err != nil {
+		return err
+	}
+	if entry.Message != nil {
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO email_content (id, message) VALUES (?, ?)`, id, entry.Message); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (l *sqliteEmailLog) Get(id int64) (EmailLogEntry, error) {
+	var (
+		e                     EmailLogEntry
+		timestamp, recipients string
+	)
+	err := l.db.QueryRow(
+		`SELECT l.id, l.timestamp, l.recipients, l.subject, l.size, l.status, l.error, c.message
+		FROM email_log l LEFT JOIN email_content c ON c.id = l.id WHERE l.id = ?`, id,
+	).Scan(&e.ID, &timestamp, &recipients, &e.Subject, &e.Size, &e.Status, &e.Error, &e.Message)
+	if errors.Is(err, sql.ErrNoRows) {
+		return EmailLogEntry{}, errEmailLogEntryNotFound
+	}
+	if err != nil {
+		return EmailLogEntry{}, err
+	}
+	e.Timestamp, _ = time.Parse(time.RFC3339Nano, timestamp)
+	json.Unmarshal([]byte(recipients), &e.To)
+	return e, nil
+}
+
+func (l *sqliteEmailLog) List(f emailLogFilter) ([]EmailLogEntry, int, error) {
+	where, args := "", []any{}
+	if f.Status != "" {
+		where, args = " WHERE status = ?", append(args, f.Status)
+	}
+
+	var total int
+	if err := l.db.QueryRow(`SELECT COUNT(*) FROM email_log`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := l.db.Query(
+		`SELECT id, timestamp, recipients, subject, size, status, error FROM email_log`+where+` ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(args, f.Limit, f.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results := []EmailLogEntry{}
+	for rows.Next() {
+		var (
+			e                     EmailLogEntry
+			timestamp, recipients string
+		)
+		if err := rows.Scan(&e.ID, &timestamp, &recipients, &e.Subject, &e.Size, &e.Status, &e.Error); err != nil {
+			return nil, 0, err
+		}
+		e.Timestamp, _ = time.Parse(time.RFC3339Nano, timestamp)
+		json.Unmarshal([]byte(recipients), &e.To)
+		results = append(results, e)
+	}
+	return results, total, rows.Err()
+}
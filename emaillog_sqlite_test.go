@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestEmailLog ouvre une base SQLite temporaire
+func openTestEmailLog(t *testing.T, path string) *sqliteEmailLog {
+	t.Helper()
+	store, err := openSQLiteEmailLog(path)
+	if err != nil {
+		t.Fatalf("openSQLiteEmailLog: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLiteEmailLogRecordsSends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "emails.db")
+	useEmailLog(t, openTestEmailLog(t, path))
+	s := useFakeSMTP(t)
+	s.reject("inconnu@exemple.fr")
+
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`); w.Code != http.StatusOK {
+		t.Fatalf("envoi : statut = %d (%s)", w.Code, w.Body)
+	}
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"inconnu@exemple.fr","subject":"Relance","body":"Bonjour"}`); w.Code < 400 {
+		t.Fatalf("envoi refusé : statut = %d, attendu une erreur", w.Code)
+	}
+
+	// Relu depuis une nouvelle connexion : les lignes survivent au redémarrage
+	results, total, err := openTestEmailLog(t, path).List(emailLogFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 2 {
+		t.Fatalf("%d lignes, attendu 2", total)
+	}
+	failed, sent := results[0], results[1]
+	if sent.Status != "sent" || sent.Subject != "Devis" || len(sent.To) != 1 || sent.To[0] != "client@exemple.fr" || sent.Size == 0 || sent.Error != "" {
+		t.Errorf("envoi réussi = %+v", sent)
+	}
+	if failed.Status != "failed" || failed.Subject != "Relance" || !strings.Contains(failed.Error, "550") {
+		t.Errorf("envoi refusé = %+v, attendu status failed et l'erreur 550", failed)
+	}
+	if sent.Timestamp.IsZero() || time.Since(sent.Timestamp) > time.Minute {
+		t.Errorf("horodatage = %v", sent.Timestamp)
+	}
+}
+
+func TestSQLiteEmailLogListAndGet(t *testing.T) {
+	store := openTestEmailLog(t, filepath.Join(t.TempDir(), "emails.db"))
+	fillEmailLog(t, store, 10)
+	if err := store.Add(EmailLogEntry{Timestamp: time.Now(), To: []string{"a@exemple.fr", "b@exemple.fr"}, Subject: "Contenu", Status: "sent", Message: []byte("Subject: Contenu\r\n\r\nBonjour\r\n")}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	results, total, err := store.List(emailLogFilter{Status: "failed", Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 3 || len(results) != 2 || results[0].Subject != "Devis 6" || results[1].Subject != "Devis 3" {
+		t.Errorf("status=failed, limit=2, offset=1 : total = %d, résultats = %+v", total, results)
+	}
+
+	e, err := store.Get(11)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(e.To) != 2 || !strings.Contains(string(e.Message), "Bonjour") {
+		t.Errorf("entrée = %+v, attendu deux destinataires et le message conservé", e)
+	}
+	if e, _ := store.Get(1); e.Message != nil {
+		t.Error("message présent alors qu'il n'a pas été conservé")
+	}
+	if _, err := store.Get(99); !errors.Is(err, errEmailLogEntryNotFound) {
+		t.Errorf("Get(99) = %v, attendu errEmailLogEntryNotFound", err)
+	}
+}
+
+func TestSQLiteEmailLogMigrationsIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "emails.db")
+	fillEmailLog(t, openTestEmailLog(t, path), 2)
+
+	// Les migrations sont rejouées à chaque démarrage sans perte de données
+	_, total, err := openTestEmailLog(t, path).List(emailLogFilter{Limit: 10})
+	if err != nil || total != 2 {
+		t.Errorf("après réouverture : total = %d, err = %v, attendu 2", total, err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// useEmailLog remplace le journal des envois le temps du test
+func useEmailLog(t *testing.T, store EmailLogStore) {
+	t.Helper()
+	previous := sentEmails
+	sentEmails = store
+	t.Cleanup(func() { sentEmails = previous })
+}
+
+// fillEmailLog ajoute n envois, un échec tous les trois
+func fillEmailLog(t *testing.T, store EmailLogStore, n int) {
+	t.Helper()
+	for i := 1; i <= n; i++ {
+		entry := EmailLogEntry{
+			Timestamp: time.Now(),
+			To:        []string{fmt.Sprintf("client%d@exemple.fr", i)},
+			Subject:   fmt.Sprintf("Devis %d", i),
+			Status:    "sent",
+		}
+		if i%3 == 0 {
+			entry.Status, entry.Error = "failed", "550 destinataire inconnu"
+		}
+		if err := store.Add(entry); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+}
+
+func decodeEmailLog(t *testing.T, target string) EmailLogResponse {
+	t.Helper()
+	w := serve(emailLogHandler, http.MethodGet, target, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s : statut = %d (%s)", target, w.Code, w.Body)
+	}
+	var resp EmailLogResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("réponse illisible: %v", err)
+	}
+	return resp
+}
+
+func TestEmailLogFilterAndLimit(t *testing.T) {
+	store := newMemoryEmailLog(100)
+	useEmailLog(t, store)
+	fillEmailLog(t, store, 10)
+
+	// Échecs uniquement (envois 3, 6 et 9), du plus récent au plus ancien
+	resp := decodeEmailLog(t, "/api/emails?status=failed")
+	if resp.Total != 3 || len(resp.Results) != 3 {
+		t.Fatalf("status=failed : total = %d, %d résultats, attendu 3", resp.Total, len(resp.Results))
+	}
+	for i, want := range []string{"Devis 9", "Devis 6", "Devis 3"} {
+		if e := resp.Results[i]; e.Subject != want || e.Status != "failed" || e.Error == "" {
+			t.Errorf("résultat %d = %+v, attendu l'échec %q", i, e, want)
+		}
+	}
+
+	resp = decodeEmailLog(t, "/api/emails?limit=4")
+	if resp.Total != 10 || len(resp.Results) != 4 || resp.Limit != 4 || resp.Results[0].Subject != "Devis 10" {
+		t.Errorf("limit=4 : total = %d, %d résultats, premier = %q", resp.Total, len(resp.Results), resp.Results[0].Subject)
+	}
+
+	resp = decodeEmailLog(t, "/api/emails?status=sent&limit=2&offset=2")
+	if resp.Total != 7 || len(resp.Results) != 2 || resp.Results[0].Subject != "Devis 7" || resp.Results[1].Subject != "Devis 5" {
+		t.Errorf("status=sent&limit=2&offset=2 : %+v", resp)
+	}
+
+	if resp := decodeEmailLog(t, "/api/emails"); resp.Limit != defaultEmailLogLimit || len(resp.Results) != 10 {
+		t.Errorf("limite par défaut = %d, %d résultats", resp.Limit, len(resp.Results))
+	}
+}
+
+func TestEmailLogInvalidParams(t *testing.T) {
+	useEmailLog(t, newMemoryEmailLog(10))
+
+	tests := map[string]string{
+		"/api/emails?status=pending": "INVALID_STATUS",
+		"/api/emails?limit=0":        "INVALID_PAGINATION",
+		"/api/emails?limit=501":      "INVALID_PAGINATION",
+		"/api/emails?limit=abc":      "INVALID_PAGINATION",
+		"/api/emails?offset=-1":      "INVALID_PAGINATION",
+	}
+	for target, code := range tests {
+		w := serve(emailLogHandler, http.MethodGet, target, "")
+		if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != code {
+			t.Errorf("GET %s : statut = %d, attendu 400 %s", target, w.Code, code)
+		}
+	}
+}
+
+func TestMemoryEmailLogSize(t *testing.T) {
+	// Au-delà de la taille, les plus anciens envois sont oubliés
+	store := newMemoryEmailLog(3)
+	fillEmailLog(t, store, 5)
+	results, total, _ := store.List(emailLogFilter{Limit: 10})
+	if total != 3 || results[0].Subject != "Devis 5" || results[2].Subject != "Devis 3" {
+		t.Errorf("total = %d, résultats = %+v, attendu les envois 5 à 3", total, results)
+	}
+	if _, err := store.Get(1); !errors.Is(err, errEmailLogEntryNotFound) {
+		t.Errorf("Get(1) = %v, attendu errEmailLogEntryNotFound", err)
+	}
+
+	// Taille négative (EMAIL_LOG_SIZE=-1) : rien n'est conservé, sans panique
+	store = newMemoryEmailLog(-1)
+	fillEmailLog(t, store, 2)
+	if _, total, _ := store.List(emailLogFilter{Limit: 10}); total != 0 {
+		t.Errorf("taille négative : %d entrées conservées, attendu 0", total)
+	}
+}
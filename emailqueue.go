@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// --- ENVOI ASYNCHRONE (FILE D'ATTENTE) ---
+
+var errQueueFull = errors.New("file d'envoi pleine")
+
+// outgoingEmail : message prêt à être transmis au serveur SMTP
+type outgoingEmail struct {
+	addr    string
+	auth    smtp.Auth
+	from    string
+	to      []string
+	subject string
+	msg     []byte
+	dsn     bool // Demande d'avis de remise (request_dsn)
+}
+
+// send envoie le message puis l'enregistre dans les métriques et le journal.
+// Le résultat par destinataire permet de signaler un envoi partiel.
+func (m outgoingEmail) send(logger *slog.Logger) ([]RecipientResult, error) {
+	m.to = dedupRecipients(m.to)
+	results, err := sendMailWithRetry(m.addr, m.auth, m.from, m.to, m.msg, m.dsn)
+
+	entry := EmailLogEntry{
+		Timestamp: time.Now(),
+		To:        m.to,
+		Subject:   m.subject,
+		Size:      len(m.msg),
+		Status:    "sent",
+	}
+	if keepEmailContent() {
+		entry.Message = m.msg
+	}
+	if err != nil {
+		logger.Error("échec de l'envoi SMTP", "to", m.to, "error", err)
+		emailsTotal.WithLabelValues("failed").Inc()
+		entry.Status, entry.Error = "failed", err.Error()
+		recordEmail(entry)
+		return results, err
+	}
+
+	if rejected := rejectedRecipients(results); len(rejected) > 0 {
+		logger.Warn("email envoyé partiellement", "to", m.to, "rejected", rejected)
+		entry.Error = "destinataires refusés : " + strings.Join(rejected, ", ")
+	} else {
+		logger.Info("email envoyé", "to", m.to)
+	}
+	emailsTotal.WithLabelValues("sent").Inc()
+	recordEmail(entry)
+	return results, nil
+}
+
+// rejectedRecipients liste les adresses refusées par le serveur SMTP
+func rejectedRecipients(results []RecipientResult) []string {
+	var rejected []string
+	for _, r := range results {
+		if !r.Accepted {
+			rejected = append(rejected, r.Address)
+		}
+	}
+	return rejected
+}
+
+// Statuts d'un envoi asynchrone
+const (
+	jobQueued  = "queued"
+	jobSending = "sending"
+	jobSent    = "sent"
+	jobFailed  = "failed"
+)
+
+// EmailJob : état d'un envoi asynchrone (GET /api/emails/{job_id})
+type EmailJob struct {
+	ID         string            `json:"job_id"`
+	Status     string            `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	Recipients []RecipientResult `json:"recipients,omitempty"` // Résultat par destinataire, une fois l'envoi terminé
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+type queuedEmail struct {
+	id          string
+	email       outgoingEmail
+	callbackURL string
+	logger      *slog.Logger
+}
+
+// emailJobQueue : file bornée (EMAIL_QUEUE_SIZE) traitée par EMAIL_WORKERS
+// goroutines. Les statuts terminés sont conservés EMAIL_JOB_TTL.
+type emailJobQueue struct {
+	queue     chan queuedEmail
+	workers   int
+	wg        sync.WaitGroup
+	callbacks sync.WaitGroup // Notifications en cours, hors des workers
+
+	mu   sync.Mutex
+	jobs map[string]*EmailJob
+	ttl  time.Duration
+}
+
+var emailQueue = newEmailJobQueue(
+	envInt("EMAIL_QUEUE_SIZE", 100),
+	envInt("EMAIL_WORKERS", 2),
+	envDuration("EMAIL_JOB_TTL", time.Hour),
+)
+
+func newEmailJobQueue(size, workers int, ttl time.Duration) *emailJobQueue {
+	q := &emailJobQueue{
+		queue:   make(chan queuedEmail, max(size, 0)),
+		workers: max(workers, 1),
+		jobs:    make(map[string]*EmailJob),
+		ttl:     ttl,
+	}
+	for range q.workers {
+		q.wg.Go(q.worker)
+	}
+	go q.cleanup()
+	return q
+}
+
+// enqueue ajoute un envoi à la file, ou retourne errQueueFull sans attendre.
+// callbackURL (optionnel) est notifié à la fin de l'envoi.
+func (q *emailJobQueue) enqueue(email outgoingEmail, callbackURL string, logger *slog.Logger) (EmailJob, error) {
+	now := time.Now()
+	job := EmailJob{ID: newRequestID(), Status: jobQueued, CreatedAt: now, UpdatedAt: now}
+
+	// Le worker peut modifier l'entrée suivie dès qu'elle est en file : la
+	// réponse repose sur une copie distincte
+	tracked := job
+	q.mu.Lock()
+	q.jobs[job.ID] = &tracked
+	q.mu.Unlock()
+
+	select {
+	case q.queue <- queuedEmail{id: job.ID, email: email, callbackURL: callbackURL, logger: logger.With("job_id", job.ID)}:
+		return job, nil
+	default:
+		q.mu.Lock()
+		delete(q.jobs, job.ID)
+		q.mu.Unlock()
+		return EmailJob{}, errQueueFull
+	}
+}
+
+func (q *emailJobQueue) worker() {
+	for item := range q.queue {
+		// Pas de délai ici : le job patiente dans la file jusqu'à une place libre
+		acquireSMTPSlot(context.Background())
+		q.update(item.id, jobSending, nil, nil)
+		results, err := item.email.send(item.logger)
+		releaseSMTPSlot()
+		status := jobSent
+		if err != nil {
+			status = jobFailed
+		}
+		job := q.update(item.id, status, err, results)
+
+		// Notification dans sa propre goroutine : les essais d'un destinataire
+		// lent (jusqu'à ~18s) n'immobilisent pas le worker
+		if item.callbackURL != "" {
+			q.callbacks.Go(func() { notifyCallback(item.callbackURL, job, item.logger) })
+		}
+	}
+}
+
+// update change le statut d'un envoi (et le résultat par destinataire s'il
+// est connu) et retourne son nouvel état
+func (q *emailJobQueue) update(id, status string, err error, recipients []RecipientResult) EmailJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return EmailJob{ID: id, Status: status}
+	}
+	job.Status = status
+	job.UpdatedAt = time.Now()
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if recipients != nil {
+		job.Recipients = recipients
+	}
+	return *job
+}
+
+// get retourne une copie de l'état d'un envoi
+func (q *emailJobQueue) get(id string) (EmailJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return EmailJob{}, false
+	}
+	return *job, true
+}
+
+// cleanup oublie périodiquement les envois terminés depuis plus de ttl
+func (q *emailJobQueue) cleanup() {
+	for range time.Tick(time.Minute) {
+		q.mu.Lock()
+		for id, job := range q.jobs {
+			done := job.Status == jobSent || job.Status == jobFailed
+			if done && time.Since(job.UpdatedAt) > q.ttl {
+				delete(q.jobs, id)
+			}
+		}
+		q.mu.Unlock()
+	}
+}
+
+// shutdown ferme la file et attend que les envois en attente soient traités
+// et leurs callbacks notifiés (dans la limite de ctx)
+func (q *emailJobQueue) shutdown(ctx context.Context) error {
+	close(q.queue)
+
+	done := make(chan struct{})
+	go func() {
+		// Plus aucun callback ne peut démarrer une fois les workers terminés
+		q.wg.Wait()
+		q.callbacks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Client dédié aux callbacks : délai court, un destinataire lent ne doit pas
+// bloquer les workers. Les adresses internes sont refusées à la connexion
+// (redirections et changement de DNS depuis la validation compris), et
+// aucun proxy n'est utilisé pour que ce contrôle porte sur le destinataire.
+var callbackHTTPClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				return checkCallbackIP(net.ParseIP(host))
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// Nombre d'essais de notification et délai initial entre deux essais
+const (
+	callbackMaxAttempts = 3
+	callbackRetryDelay  = time.Second
+)
+
+var errCallbackAddress = errors.New("callback_url invalide : adresse interne refusée (boucle locale, réseau privé ou partagé, lien local)")
+
+// Plages non publiques que net.IP ne sait pas reconnaître : « ce réseau »
+// (0.0.0.0/8) et l'espace partagé des opérateurs (CGNAT, RFC 6598)
+var callbackBlockedNets = []*net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+}
+
+// validateCallbackURL n'accepte que des URL absolues http(s) dont l'hôte ne
+// désigne que des adresses publiques : le service ne doit pas pouvoir être
+// utilisé pour joindre son propre réseau (métadonnées cloud, services
+// internes). CALLBACK_ALLOW_PRIVATE=1 lève cette restriction (développement).
+func validateCallbackURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback_url invalide : une URL http(s) absolue est attendue")
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("callback_url invalide : hôte %q introuvable", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if err := checkCallbackIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCallbackIP refuse les adresses non publiques, sauf avec
+// CALLBACK_ALLOW_PRIVATE=1
+func checkCallbackIP(ip net.IP) error {
+	if getenv("CALLBACK_ALLOW_PRIVATE") == "1" {
+		return nil
+	}
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return errCallbackAddress
+	}
+	for _, blocked := range callbackBlockedNets {
+		if blocked.Contains(ip) {
+			return errCallbackAddress
+		}
+	}
+	return nil
+}
+
+// notifyCallback envoie l'état final de l'envoi (POST JSON) à callbackURL,
+// en retentant les erreurs réseau et les réponses hors 2xx
+func notifyCallback(callbackURL string, job EmailJob, logger *slog.Logger) {
+	payload, _ := json.Marshal(job)
+
+	delay := callbackRetryDelay
+	for attempt := 1; attempt <= callbackMaxAttempts; attempt++ {
+		err := postCallback(callbackURL, payload)
+		if err == nil {
+			logger.Info("callback notifié", "callback_url", callbackURL, "status", job.Status)
+			return
+		}
+		if attempt == callbackMaxAttempts {
+			logger.Error("échec du callback", "callback_url", callbackURL, "attempts", attempt, "error", err)
+			return
+		}
+		logger.Warn("échec du callback, nouvel essai", "callback_url", callbackURL, "attempt", attempt, "error", err, "retry_in", delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func postCallback(callbackURL string, payload []byte) error {
+	resp, err := callbackHTTPClient.Post(callbackURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("réponse HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// emailJobHandler : GET /api/emails/{job_id}
+func emailJobHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Sous-ressource : POST /api/emails/{id}/resend (identifiant du journal)
+	if id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/emails/"), "/resend"); ok {
+		emailResendHandler(w, r, id)
+		return
+	}
+
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/emails/")
+	job, ok := emailQueue.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "JOB_NOT_FOUND", "Envoi inconnu ou expiré")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
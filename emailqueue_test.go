@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useEmailQueue remplace la file d'envoi par une file de size places, sans
+// worker : startWorkers les démarre quand le test le décide
+func useEmailQueue(t *testing.T, size int) *emailJobQueue {
+	t.Helper()
+	q := &emailJobQueue{
+		queue: make(chan queuedEmail, size),
+		jobs:  make(map[string]*EmailJob),
+		ttl:   time.Hour,
+	}
+	previous := emailQueue
+	emailQueue = q
+	t.Cleanup(func() {
+		emailQueue = previous
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		q.shutdown(ctx)
+	})
+	return q
+}
+
+func (q *emailJobQueue) startWorkers(n int) {
+	q.workers += n
+	for range n {
+		q.wg.Go(q.worker)
+	}
+}
+
+// waitForJob attend la fin d'un envoi asynchrone
+func waitForJob(t *testing.T, id string) EmailJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := emailQueue.get(id); ok && (job.Status == jobSent || job.Status == jobFailed) {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	job, _ := emailQueue.get(id)
+	t.Fatalf("envoi %s toujours %q après 5s", id, job.Status)
+	return job
+}
+
+// getJob interroge GET /api/emails/{job_id}
+func getJob(t *testing.T, id string) EmailJob {
+	t.Helper()
+	w := serve(emailJobHandler, http.MethodGet, "/api/emails/"+id, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/emails/%s : statut = %d (%s)", id, w.Code, w.Body)
+	}
+	var job EmailJob
+	if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+		t.Fatalf("réponse illisible: %v", err)
+	}
+	return job
+}
+
+// enqueueEmail envoie une requête async=true et retourne la réponse 202
+func enqueueEmail(t *testing.T, to string) EmailJob {
+	t.Helper()
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email?async=true", `{"to":"`+to+`","subject":"Devis","body":"Bonjour"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("statut = %d (%s), attendu 202", w.Code, w.Body)
+	}
+	var job EmailJob
+	if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+		t.Fatalf("réponse illisible: %v", err)
+	}
+	return job
+}
+
+func TestSendEmailAsyncStatusTransitions(t *testing.T) {
+	s := useFakeSMTP(t)
+	s.reject("inconnu@exemple.fr")
+	q := useEmailQueue(t, 10)
+
+	job := enqueueEmail(t, "client@exemple.fr")
+	if job.ID == "" || job.Status != jobQueued {
+		t.Fatalf("réponse = %+v, attendu un job_id en statut queued", job)
+	}
+	failing := enqueueEmail(t, "inconnu@exemple.fr")
+
+	// Aucun worker : les envois restent en file
+	if got := getJob(t, job.ID); got.Status != jobQueued {
+		t.Errorf("avant traitement : statut = %q, attendu queued", got.Status)
+	}
+	if len(s.received()) != 0 {
+		t.Fatal("email envoyé avant le démarrage des workers")
+	}
+
+	q.startWorkers(1)
+	waitForJob(t, job.ID)
+	waitForJob(t, failing.ID)
+
+	if got := getJob(t, job.ID); got.Status != jobSent || got.Error != "" || len(got.Recipients) != 1 || got.UpdatedAt.Before(got.CreatedAt) {
+		t.Errorf("envoi réussi = %+v, attendu sent", got)
+	}
+	if got := getJob(t, failing.ID); got.Status != jobFailed || !strings.Contains(got.Error, "550") {
+		t.Errorf("envoi refusé = %+v, attendu failed avec l'erreur 550", got)
+	}
+	if n := len(s.received()); n != 1 {
+		t.Errorf("%d emails reçus, attendu 1", n)
+	}
+}
+
+func TestSendEmailAsyncQueueFull(t *testing.T) {
+	useFakeSMTP(t)
+	useEmailQueue(t, 1)
+
+	enqueueEmail(t, "client@exemple.fr")
+
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour","async":true}`)
+	if w.Code != http.StatusServiceUnavailable || decodeAPIError(t, w).Code != "QUEUE_FULL" {
+		t.Fatalf("file pleine : statut = %d (%s), attendu 503 QUEUE_FULL", w.Code, w.Body)
+	}
+	// L'envoi refusé n'est pas suivi
+	if n := len(emailQueue.jobs); n != 1 {
+		t.Errorf("%d envois suivis, attendu 1", n)
+	}
+}
+
+func TestEmailJobNotFound(t *testing.T) {
+	useEmailQueue(t, 1)
+
+	w := httptest.NewRecorder()
+	emailJobHandler(w, httptest.NewRequest(http.MethodGet, "/api/emails/inconnu", nil))
+	if w.Code != http.StatusNotFound || decodeAPIError(t, w).Code != "JOB_NOT_FOUND" {
+		t.Errorf("statut = %d (%s), attendu 404 JOB_NOT_FOUND", w.Code, w.Body)
+	}
+}
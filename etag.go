@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- CACHE HTTP (ETAG / CACHE-CONTROL) ---
+
+// Durée pendant laquelle navigateurs et CDN peuvent réutiliser une réponse
+// entreprise sans revalidation (COMPANY_HTTP_MAX_AGE, 0 pour désactiver).
+// Avec API_KEY, seul le cache du client est autorisé (private).
+var companyHTTPMaxAge = envDuration("COMPANY_HTTP_MAX_AGE", time.Hour)
+
+// writeCacheable écrit une réponse 200 accompagnée d'un ETag et d'un
+// Cache-Control, ou 304 si le client possède déjà cette version
+// (If-None-Match). L'ETag est calculé sur version, ou sur le corps si
+// version est nil.
+func writeCacheable(w http.ResponseWriter, r *http.Request, body, version []byte) {
+	if version == nil {
+		version = body
+	}
+	sum := sha256.Sum256(version)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	cacheControl := "no-cache"
+	if companyHTTPMaxAge > 0 {
+		cacheControl = fmt.Sprintf("max-age=%d", int(companyHTTPMaxAge.Seconds()))
+	}
+	// Réponse réservée aux détenteurs de la clé API : un cache partagé (CDN,
+	// proxy) ne doit pas la resservir à un client non authentifié
+	if getenv("API_KEY") != "" {
+		cacheControl = "private, " + cacheControl
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// companyVersion identifie une version des données d'une entreprise dans un
+// format donné, sans cached_at ni fresh : ces champs varient entre la
+// première réponse et les suivantes (servies depuis le cache) sans que
+// l'entreprise ait changé, ce qui empêcherait toute réponse 304
+func companyVersion(e EntrepriseResponse, format string) []byte {
+	e.CachedAt, e.Fresh = time.Time{}, false
+	version, _ := json.Marshal(e)
+	return append(version, format...)
+}
+
+// etagMatches indique si l'en-tête If-None-Match désigne etag (comparaison
+// faible : le préfixe W/ est ignoré)
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
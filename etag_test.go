@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// useCompanyHTTPMaxAge applique COMPANY_HTTP_MAX_AGE (lu au démarrage) le temps du test
+func useCompanyHTTPMaxAge(t *testing.T, d time.Duration) {
+	t.Helper()
+	previous := companyHTTPMaxAge
+	companyHTTPMaxAge = d
+	t.Cleanup(func() { companyHTTPMaxAge = previous })
+}
+
+// conditionalGet interroge target avec If-None-Match
+func conditionalGet(target, ifNoneMatch string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if ifNoneMatch != "" {
+		r.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	w := httptest.NewRecorder()
+	entrepriseHandler(w, r)
+	return w
+}
+
+func TestEntrepriseNotModified(t *testing.T) {
+	useStubProvider(t, danone)
+	useCompanyHTTPMaxAge(t, 30*time.Minute)
+	t.Setenv("API_KEY", "")
+
+	first := conditionalGet("/api/entreprise/552032534", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("statut = %d, ETag = %q, attendu 200 avec un ETag", first.Code, etag)
+	}
+	if got := first.Header().Get("Cache-Control"); got != "max-age=1800" {
+		t.Errorf("Cache-Control = %q, attendu max-age=1800", got)
+	}
+
+	// Seconde réponse servie depuis le cache (fresh et cached_at différents) :
+	// même ETag, donc 304 sans corps
+	for _, header := range []string{etag, "W/" + etag, `"autre", ` + etag, "*"} {
+		w := conditionalGet("/api/entreprise/552032534", header)
+		if w.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %s : statut = %d, attendu 304", header, w.Code)
+			continue
+		}
+		if w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+			t.Errorf("If-None-Match %s : corps = %q, ETag = %q", header, w.Body, w.Header().Get("ETag"))
+		}
+	}
+
+	// ETag différent : réponse complète
+	if w := conditionalGet("/api/entreprise/552032534", `"perime"`); w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Errorf("ETag périmé : statut = %d, attendu 200 avec le corps", w.Code)
+	}
+	// Autres champs demandés : autre version
+	if w := conditionalGet("/api/entreprise/552032534?fields=tva", etag); w.Code != http.StatusOK {
+		t.Errorf("fields=tva : statut = %d, attendu 200", w.Code)
+	}
+}
+
+func TestEntrepriseETagFollowsData(t *testing.T) {
+	denomination := "DANONE"
+	useStubProvider(t, func(ctx context.Context, numid string, fields entrepriseFields) (*EntrepriseResponse, error) {
+		data, err := danone(ctx, numid, fields)
+		if data != nil {
+			data.Denomination = denomination
+		}
+		return data, err
+	})
+
+	etag := conditionalGet("/api/entreprise/552032534", "").Header().Get("ETag")
+
+	// Données modifiées chez le fournisseur (cache vidé) : nouvel ETag
+	denomination = "DANONE SA"
+	useFreshCompanyCache(t)
+	w := conditionalGet("/api/entreprise/552032534", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("données modifiées : statut = %d, ETag = %q, attendu 200 et un nouvel ETag", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestCompanyHTTPMaxAgeDisabled(t *testing.T) {
+	useStubProvider(t, danone)
+	useCompanyHTTPMaxAge(t, 0)
+	t.Setenv("API_KEY", "")
+
+	if got := conditionalGet("/api/entreprise/552032534", "").Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("COMPANY_HTTP_MAX_AGE=0 : Cache-Control = %q, attendu no-cache", got)
+	}
+}
+
+func TestEntrepriseCacheControlPrivateWithAPIKey(t *testing.T) {
+	useStubProvider(t, danone)
+	useCompanyHTTPMaxAge(t, 30*time.Minute)
+	t.Setenv("API_KEY", "cle-secrete")
+
+	// Réponse authentifiée : jamais stockée par un cache partagé
+	if got := conditionalGet("/api/entreprise/552032534", "").Header().Get("Cache-Control"); got != "private, max-age=1800" {
+		t.Errorf("Cache-Control = %q, attendu private, max-age=1800", got)
+	}
+	useCompanyHTTPMaxAge(t, 0)
+	if got := conditionalGet("/api/entreprise/552032534", "").Header().Get("Cache-Control"); got != "private, no-cache" {
+		t.Errorf("COMPANY_HTTP_MAX_AGE=0 : Cache-Control = %q, attendu private, no-cache", got)
+	}
+}
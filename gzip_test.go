@@ -0,0 +1,121 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// jsonHandler répond un corps JSON de la taille demandée
+func jsonHandler(size int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"data":"`+strings.Repeat("a", size)+`"}`)
+	})
+}
+
+func gzipRequest(handler http.Handler, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	handler := gzipMiddleware(jsonHandler(4096))
+	want := `{"data":"` + strings.Repeat("a", 4096) + `"}`
+
+	// Avec gzip : corps compressé, identique une fois décompressé
+	w := gzipRequest(handler, "gzip, deflate")
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, attendu gzip", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q, attendu Accept-Encoding", got)
+	}
+	if w.Body.Len() >= len(want) {
+		t.Errorf("corps de %d octets, attendu moins que l'original (%d)", w.Body.Len(), len(want))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("décompression: %v", err)
+	}
+	if string(body) != want {
+		t.Errorf("corps décompressé de %d octets, attendu %d", len(body), len(want))
+	}
+
+	// Sans gzip : corps en clair, Vary toujours présent pour les caches
+	for _, accept := range []string{"", "deflate", "gzip;q=0"} {
+		w := gzipRequest(handler, accept)
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Accept-Encoding %q : Content-Encoding = %q, attendu absent", accept, got)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q : Vary = %q", accept, got)
+		}
+		if w.Body.String() != want {
+			t.Errorf("Accept-Encoding %q : corps modifié", accept)
+		}
+	}
+}
+
+func TestGzipMiddlewareSkips(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.Handler
+	}{
+		{"corps trop petit", jsonHandler(10)},
+		{"image déjà compressée", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(make([]byte, 4096))
+		})},
+		{"Content-Encoding déjà défini", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "br")
+			w.Write(make([]byte, 4096))
+		})},
+	}
+	for _, tt := range tests {
+		w := gzipRequest(gzipMiddleware(tt.handler), "gzip")
+		if got := w.Header().Get("Content-Encoding"); got == "gzip" {
+			t.Errorf("%s : réponse compressée", tt.name)
+		}
+	}
+
+	// Le code HTTP est conservé lorsque le corps reste en tampon
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "introuvable", http.StatusNotFound)
+	})
+	if w := gzipRequest(gzipMiddleware(notFound), "gzip"); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "introuvable") {
+		t.Errorf("statut = %d, corps = %q, attendu 404 en clair", w.Code, w.Body)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                false,
+		"gzip":            true,
+		"GZIP":            true,
+		"deflate, gzip":   true,
+		"gzip;q=0":        false,
+		"gzip;q=0.5":      true,
+		"*":               true,
+		"br, identity":    false,
+		"gzip;q=invalide": false,
+	}
+	for header, want := range tests {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, attendu %v", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// --- IDEMPOTENCE (en-tête Idempotency-Key) ---
+
+// idempotencyStore mémorise, pour chaque clé, la réponse renvoyée afin de la
+// rejouer si le client retente la même requête (ex: après un timeout). Les
+// clés sont propres à chaque client (voir idempotencyScope).
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	ttl     time.Duration
+}
+
+type idempotencyEntry struct {
+	done     bool     // false tant que la première requête est en cours
+	bodyHash [32]byte // Empreinte SHA-256 du corps de la première requête
+	status   int
+	header   http.Header
+	body     []byte
+	expires  time.Time
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	s := &idempotencyStore{
+		entries: make(map[string]*idempotencyEntry),
+		ttl:     ttl,
+	}
+	go s.cleanup()
+	return s
+}
+
+// Réponses d'envoi d'email rejouables pendant IDEMPOTENCY_TTL
+var emailIdempotency = newIdempotencyStore(envDuration("IDEMPOTENCY_TTL", 24*time.Hour))
+
+// begin réserve la clé pour un corps d'empreinte bodyHash. Retourne l'entrée
+// existante si la clé est déjà connue (réponse à rejouer, ou requête encore
+// en cours).
+func (s *idempotencyStore) begin(key string, bodyHash [32]byte) (*idempotencyEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && (!e.done || time.Now().Before(e.expires)) {
+		copied := *e
+		return &copied, true
+	}
+	s.entries[key] = &idempotencyEntry{bodyHash: bodyHash}
+	return nil, false
+}
+
+// finish enregistre la réponse. Seuls les succès sont conservés : après un
+// échec, le client doit pouvoir retenter avec la même clé.
+func (s *idempotencyStore) finish(key string, bodyHash [32]byte, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status < 200 || status >= 300 {
+		delete(s.entries, key)
+		return
+	}
+	s.entries[key] = &idempotencyEntry{
+		done:     true,
+		bodyHash: bodyHash,
+		status:   status,
+		header:   header,
+		body:     body,
+		expires:  time.Now().Add(s.ttl),
+	}
+}
+
+// cleanup oublie périodiquement les réponses expirées
+func (s *idempotencyStore) cleanup() {
+	for range time.Tick(time.Minute) {
+		s.mu.Lock()
+		for key, e := range s.entries {
+			if e.done && time.Now().After(e.expires) {
+				delete(s.entries, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// idempotencyScope rattache une clé au client qui l'envoie : deux clients
+// choisissant la même Idempotency-Key ne partagent pas leurs réponses
+func idempotencyScope(r *http.Request, key string) string {
+	return clientIP(r) + " " + key
+}
+
+// idempotencyMiddleware rejoue la réponse d'une requête déjà traitée avec le
+// même Idempotency-Key (en-tête Idempotent-Replayed: true), répond 409 si
+// elle est encore en cours et 422 si la clé est réutilisée avec un autre
+// corps. Sans en-tête, la requête passe normalement.
+func idempotencyMiddleware(store *idempotencyStore, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !validRequestID(key) {
+			writeError(w, http.StatusBadRequest, "INVALID_IDEMPOTENCY_KEY", "En-tête Idempotency-Key invalide (128 caractères imprimables maximum)")
+			return
+		}
+
+		// Corps lu une fois pour en calculer l'empreinte, puis rendu au handler
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				writeError(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", "Requête trop volumineuse")
+				return
+			}
+			writeError(w, http.StatusBadRequest, "INVALID_JSON", "JSON invalide")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(payload))
+		bodyHash := sha256.Sum256(payload)
+		scoped := idempotencyScope(r, key)
+
+		if e, found := store.begin(scoped, bodyHash); found {
+			if e.bodyHash != bodyHash {
+				writeError(w, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED", "Idempotency-Key déjà utilisée pour une requête différente")
+				return
+			}
+			if !e.done {
+				writeError(w, http.StatusConflict, "IDEMPOTENCY_IN_PROGRESS", "Une requête avec la même Idempotency-Key est en cours de traitement")
+				return
+			}
+			loggerFromContext(r.Context()).Info("réponse rejouée (Idempotency-Key)", "route", r.URL.Path, "idempotency_key", key)
+			for k, v := range e.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(e.status)
+			w.Write(e.body)
+			return
+		}
+
+		// Libère la clé si le handler panique (sinon elle resterait "en cours")
+		completed := false
+		defer func() {
+			if !completed {
+				store.finish(scoped, bodyHash, http.StatusInternalServerError, nil, nil)
+			}
+		}()
+
+		before := w.Header().Clone()
+		rec := &captureRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		completed = true
+		store.finish(scoped, bodyHash, rec.status, handlerHeaders(before, w.Header()), rec.body.Bytes())
+	})
+}
+
+// En-têtes liés à l'encodage de la réponse transmise (gzipMiddleware) : le
+// corps mémorisé n'est pas compressé, ils ne doivent pas être rejoués
+var transportHeaders = map[string]bool{
+	"Content-Encoding": true,
+	"Content-Length":   true,
+}
+
+// handlerHeaders retourne les en-têtes posés pendant le traitement de la
+// requête (ex: Content-Type), sans ceux des middlewares englobants
+// (X-Request-ID, Vary...) ni les en-têtes d'encodage
+func handlerHeaders(before, after http.Header) http.Header {
+	set := make(http.Header)
+	for k, v := range after {
+		if transportHeaders[k] || slices.Equal(before[k], v) {
+			continue
+		}
+		set[k] = slices.Clone(v)
+	}
+	return set
+}
+
+// captureRecorder transmet la réponse au client tout en conservant une copie
+// du code HTTP et du corps
+type captureRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *captureRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *captureRecorder) Write(p []byte) (int, error) {
+	rec.body.Write(p)
+	return rec.ResponseWriter.Write(p)
+}
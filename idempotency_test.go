@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useFreshIdempotency remplace le stockage des clés d'idempotence le temps du test
+func useFreshIdempotency(t *testing.T) *idempotencyStore {
+	t.Helper()
+	store := &idempotencyStore{entries: make(map[string]*idempotencyEntry), ttl: time.Hour}
+	previous := emailIdempotency
+	emailIdempotency = store
+	t.Cleanup(func() { emailIdempotency = previous })
+	return store
+}
+
+func TestSendEmailIdempotencyKey(t *testing.T) {
+	s := useFakeSMTP(t)
+	useFreshIdempotency(t)
+	handler := newTestHandler(t)
+
+	send := func(key, to string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/send-email", strings.NewReader(`{"to":"`+to+`","subject":"Devis","body":"Bonjour"}`))
+		r.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	first := send("devis-42", "client@exemple.fr")
+	if first.Code != http.StatusOK {
+		t.Fatalf("premier envoi : statut = %d (%s)", first.Code, first.Body)
+	}
+	second := send("devis-42", "client@exemple.fr")
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Errorf("réponse rejouée = %d %s, attendu %d %s", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("en-tête Idempotent-Replayed absent de la réponse rejouée")
+	}
+	if second.Header().Get("Content-Type") != first.Header().Get("Content-Type") {
+		t.Errorf("Content-Type rejoué = %q, attendu %q", second.Header().Get("Content-Type"), first.Header().Get("Content-Type"))
+	}
+	if n := len(s.received()); n != 1 {
+		t.Fatalf("%d emails envoyés, attendu 1 pour deux requêtes avec la même clé", n)
+	}
+
+	// Une autre clé déclenche un nouvel envoi
+	if w := send("devis-43", "client@exemple.fr"); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("autre clé : statut = %d, Idempotent-Replayed = %q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if n := len(s.received()); n != 2 {
+		t.Errorf("%d emails envoyés, attendu 2", n)
+	}
+}
+
+func TestSendEmailIdempotencyRetryAfterFailure(t *testing.T) {
+	s := useFakeSMTP(t)
+	s.reject("client@exemple.fr")
+	store := useFreshIdempotency(t)
+	handler := newTestHandler(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/send-email", strings.NewReader(`{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`))
+	r.Header.Set("Idempotency-Key", "devis-42")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code < 400 {
+		t.Fatalf("statut = %d, attendu un échec d'envoi", w.Code)
+	}
+
+	// Un échec n'est pas mémorisé : la même clé peut être retentée
+	if _, found := store.begin(idempotencyScope(r, "devis-42"), sha256.Sum256(nil)); found {
+		t.Error("clé conservée après un échec d'envoi")
+	}
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	store := &idempotencyStore{entries: make(map[string]*idempotencyEntry), ttl: time.Hour}
+	handler := idempotencyMiddleware(store, okHandler)
+
+	request := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Requête encore en cours avec la même clé (et le même corps, vide) : 409
+	store.begin("192.0.2.1 en-cours", sha256.Sum256(nil))
+	if w := request("en-cours"); w.Code != http.StatusConflict || decodeAPIError(t, w).Code != "IDEMPOTENCY_IN_PROGRESS" {
+		t.Errorf("clé en cours : statut = %d, attendu 409 IDEMPOTENCY_IN_PROGRESS", w.Code)
+	}
+	if w := request("cle\x01invalide"); w.Code != http.StatusBadRequest {
+		t.Errorf("clé invalide : statut = %d, attendu 400", w.Code)
+	}
+	if w := request(""); w.Code != http.StatusOK {
+		t.Errorf("sans clé : statut = %d, attendu 200", w.Code)
+	}
+
+	// Réponse expirée : la clé est de nouveau utilisable
+	store.finish("192.0.2.1 expiree", sha256.Sum256(nil), http.StatusOK, nil, nil)
+	store.entries["192.0.2.1 expiree"].expires = time.Now().Add(-time.Second)
+	if w := request("expiree"); w.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("réponse expirée rejouée")
+	}
+}
+
+func TestSendEmailIdempotencyKeyBoundToRequest(t *testing.T) {
+	s := useFakeSMTP(t)
+	useFreshIdempotency(t)
+	handler := newTestHandler(t)
+
+	send := func(remoteAddr, to string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/send-email", strings.NewReader(`{"to":"`+to+`","subject":"Devis","body":"Bonjour"}`))
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Idempotency-Key", "devis-42")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := send("198.51.100.7:1234", "client@exemple.fr"); w.Code != http.StatusOK {
+		t.Fatalf("premier envoi : statut = %d (%s)", w.Code, w.Body)
+	}
+
+	// Même clé, autre contenu : refusé plutôt que de rejouer le premier envoi
+	w := send("198.51.100.7:1234", "autre@exemple.fr")
+	if w.Code != http.StatusUnprocessableEntity || decodeAPIError(t, w).Code != "IDEMPOTENCY_KEY_REUSED" {
+		t.Errorf("autre corps : statut = %d (%s), attendu 422 IDEMPOTENCY_KEY_REUSED", w.Code, w.Body)
+	}
+	if n := len(s.received()); n != 1 {
+		t.Fatalf("%d emails envoyés, attendu 1", n)
+	}
+
+	// Même clé et même contenu depuis un autre client : clé distincte
+	if w := send("203.0.113.9:1234", "client@exemple.fr"); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("autre client : statut = %d, Idempotent-Replayed = %q, attendu un nouvel envoi", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if n := len(s.received()); n != 2 {
+		t.Errorf("%d emails envoyés, attendu 2", n)
+	}
+}
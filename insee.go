@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- FOURNISSEUR INSEE (API Sirene) ---
+
+const (
+	inseeTokenURL = "https://api.insee.fr/token"
+	inseeAPIBase  = "https://api.insee.fr/entreprises/sirene/V3.11"
+)
+
+// Structure interne API Sirene (/siret/{siret})
+type SireneEtablissementResponse struct {
+	Etablissement struct {
+		Siren       string           `json:"siren"`
+		Siret       string           `json:"siret"`
+		UniteLegale sireneUniteLegal `json:"uniteLegale"`
+		Adresse     struct {
+			CodePostal string `json:"codePostalEtablissement"`
+			Commune    string `json:"libelleCommuneEtablissement"`
+		} `json:"adresseEtablissement"`
+	} `json:"etablissement"`
+}
+
+// Structure interne API Sirene (/siren/{siren})
+type SireneUniteLegaleResponse struct {
+	UniteLegale struct {
+		Siren    string             `json:"siren"`
+		Periodes []sireneUniteLegal `json:"periodesUniteLegale"`
+	} `json:"uniteLegale"`
+}
+
+// Champs communs de l'unité légale (période courante)
+type sireneUniteLegal struct {
+	Denomination string `json:"denominationUniteLegale"`
+	Nom          string `json:"nomUniteLegale"`
+	Prenom       string `json:"prenom1UniteLegale"`
+	NicSiege     string `json:"nicSiegeUniteLegale"`
+	Etat         string `json:"etatAdministratifUniteLegale"` // "A" active, "C" cessée
+}
+
+// denomination retourne la raison sociale, ou "Prénom Nom" pour un
+// entrepreneur individuel
+func (u sireneUniteLegal) denomination() string {
+	if u.Denomination != "" {
+		return u.Denomination
+	}
+	return strings.TrimSpace(u.Prenom + " " + u.Nom)
+}
+
+// mapSireneEtat convertit l'état administratif Sirene de l'unité légale.
+// Sirene ne distingue pas la radiation du RCS de la cessation d'activité.
+func mapSireneEtat(etat string) string {
+	switch etat {
+	case "A":
+		return statutActive
+	case "C":
+		return statutCessee
+	default:
+		return statutInconnu
+	}
+}
+
+// inseeProvider interroge l'API Sirene de l'INSEE, authentifiée en OAuth
+// (client credentials). Le jeton est mis en cache jusqu'à son expiration.
+type inseeProvider struct {
+	clientID     string
+	clientSecret string
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+func newInseeProvider() *inseeProvider {
+	return &inseeProvider{
+		clientID:     getenv("INSEE_CLIENT_ID"),
+		clientSecret: getenv("INSEE_CLIENT_SECRET"),
+	}
+}
+
+func (p *inseeProvider) Name() string { return "insee" }
+
+func (p *inseeProvider) Ping(ctx context.Context) error {
+	return pingUpstream(ctx, inseeAPIBase+"/")
+}
+
+func (p *inseeProvider) Lookup(ctx context.Context, numid string, fields entrepriseFields) (*EntrepriseResponse, error) {
+	// SIREN : l'unité légale donne la dénomination et le NIC du siège,
+	// l'établissement siège donne l'adresse
+	siret := numid
+	if len(numid) == 9 {
+		var ul SireneUniteLegaleResponse
+		if err := p.get(ctx, "/siren/"+numid, &ul); err != nil {
+			return nil, err
+		}
+		if len(ul.UniteLegale.Periodes) == 0 {
+			return nil, errEntrepriseIntrouvable
+		}
+		current := ul.UniteLegale.Periodes[0]
+
+		result := &EntrepriseResponse{
+			Denomination:      current.denomination(),
+			Siren:             ul.UniteLegale.Siren,
+			Siret:             ul.UniteLegale.Siren + current.NicSiege,
+			Status:            mapSireneEtat(current.Etat),
+			ImmatriculeeInsee: true, // Présente dans Sirene, donc immatriculée
+		}
+		if fields.Tva {
+			// L'API Sirene ne fournit pas la TVA : elle est calculée depuis le SIREN
+			result.Tva, _ = computeTVA(result.Siren)
+		}
+		if !fields.Address || current.NicSiege == "" {
+			return result, nil
+		}
+		siret = result.Siret
+
+		var etab SireneEtablissementResponse
+		result.AdressePostaleLegale = &AdressePostale{}
+		if err := p.get(ctx, "/siret/"+siret, &etab); err != nil {
+			slog.Warn("adresse légale indisponible", "numid", numid, "error", err)
+			return result, nil
+		}
+		result.AdressePostaleLegale.Ville = etab.Etablissement.Adresse.Commune
+		result.AdressePostaleLegale.CodePostal = etab.Etablissement.Adresse.CodePostal
+		return result, nil
+	}
+
+	var etab SireneEtablissementResponse
+	if err := p.get(ctx, "/siret/"+siret, &etab); err != nil {
+		return nil, err
+	}
+	return mapSireneEtablissement(etab, fields), nil
+}
+
+// mapSireneEtablissement convertit un établissement Sirene au format commun
+func mapSireneEtablissement(etab SireneEtablissementResponse, fields entrepriseFields) *EntrepriseResponse {
+	e := etab.Etablissement
+	result := &EntrepriseResponse{
+		Denomination:      e.UniteLegale.denomination(),
+		Siren:             e.Siren,
+		Siret:             e.Siret,
+		Status:            mapSireneEtat(e.UniteLegale.Etat),
+		ImmatriculeeInsee: true,
+	}
+	if fields.Tva {
+		result.Tva, _ = computeTVA(e.Siren)
+	}
+	if fields.Address {
+		result.AdressePostaleLegale = &AdressePostale{
+			Ville:      e.Adresse.Commune,
+			CodePostal: e.Adresse.CodePostal,
+		}
+	}
+	return result
+}
+
+// get effectue un GET authentifié sur l'API Sirene et décode la réponse.
+// Un 401 (jeton révoqué) déclenche un renouvellement et un second essai.
+func (p *inseeProvider) get(ctx context.Context, path string, out any) error {
+	for attempt := 1; ; attempt++ {
+		token, err := p.accessToken(ctx, attempt > 1)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", inseeAPIBase+path, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := upstreamHTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 1:
+			continue
+		case resp.StatusCode == http.StatusNotFound:
+			return errEntrepriseIntrouvable
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return &upstreamRateLimitError{provider: "INSEE", retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+		case resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("erreur API INSEE : %d - %s", resp.StatusCode, string(bodyBytes))
+		}
+
+		if err := json.Unmarshal(bodyBytes, out); err != nil {
+			return fmt.Errorf("erreur de décodage JSON : %v", err)
+		}
+		return nil
+	}
+}
+
+// accessToken retourne le jeton OAuth en cache, ou en demande un nouveau
+// s'il est absent, expiré (avec une marge) ou si forceRefresh est vrai
+func (p *inseeProvider) accessToken(ctx context.Context, forceRefresh bool) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !forceRefresh && p.token != "" && time.Now().Before(p.tokenExpiry) {
+		return p.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	req, err := http.NewRequestWithContext(ctx, "POST", inseeTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(p.clientID, p.clientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := upstreamHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("authentification INSEE refusée : %d - %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("erreur de décodage du jeton INSEE : %v", err)
+	}
+
+	p.token = tokenResp.AccessToken
+	// Marge d'une minute pour ne pas utiliser un jeton sur le point d'expirer
+	p.tokenExpiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn)*time.Second - time.Minute)
+	return p.token, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// roundTripFunc sert les requêtes sortantes sans réseau
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// useUpstreamHandler fait traiter par handler les appels aux fournisseurs
+// (upstreamHTTPClient), y compris vers les URL fixes de l'INSEE
+func useUpstreamHandler(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	previous := upstreamHTTPClient
+	upstreamHTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Result(), nil
+	})}
+	t.Cleanup(func() { upstreamHTTPClient = previous })
+}
+
+// sireneFixture lit une réponse Sirene enregistrée (testdata)
+func sireneFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// fakeInsee simule le jeton OAuth et les endpoints /siren et /siret
+func fakeInsee(t *testing.T, tokens *atomic.Int64) http.HandlerFunc {
+	siren, siret := sireneFixture(t, "sirene_siren.json"), sireneFixture(t, "sirene_siret.json")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() == inseeTokenURL {
+			user, pass, _ := r.BasicAuth()
+			r.ParseForm()
+			if user != "client-id" || pass != "client-secret" || r.PostForm.Get("grant_type") != "client_credentials" {
+				http.Error(w, "identifiants invalides", http.StatusUnauthorized)
+				return
+			}
+			tokens.Add(1)
+			w.Write([]byte(`{"access_token":"jeton-1","token_type":"Bearer","expires_in":604800}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer jeton-1" {
+			http.Error(w, "jeton invalide", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.String() {
+		case inseeAPIBase + "/siren/552032534":
+			w.Write(siren)
+		case inseeAPIBase + "/siret/55203253400646":
+			w.Write(siret)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func TestMapSireneEtablissement(t *testing.T) {
+	var etab SireneEtablissementResponse
+	if err := json.Unmarshal(sireneFixture(t, "sirene_siret.json"), &etab); err != nil {
+		t.Fatal(err)
+	}
+
+	got := mapSireneEtablissement(etab, allEntrepriseFields)
+	want := EntrepriseResponse{
+		Denomination:         "DANONE",
+		Siren:                "552032534",
+		Siret:                "55203253400646",
+		Status:               statutActive,
+		ImmatriculeeInsee:    true,
+		Tva:                  "FR27552032534",
+		AdressePostaleLegale: &AdressePostale{Ville: "PARIS 9", CodePostal: "75009"},
+	}
+	if got.AdressePostaleLegale == nil || *got.AdressePostaleLegale != *want.AdressePostaleLegale {
+		t.Fatalf("adresse = %+v, attendu %+v", got.AdressePostaleLegale, want.AdressePostaleLegale)
+	}
+	got.AdressePostaleLegale, want.AdressePostaleLegale = nil, nil
+	if *got != want {
+		t.Errorf("mapSireneEtablissement = %+v, attendu %+v", *got, want)
+	}
+
+	if got := mapSireneEtablissement(etab, entrepriseFields{}); got.Tva != "" || got.AdressePostaleLegale != nil {
+		t.Errorf("sans fields : tva %q, adresse %+v, attendu vides", got.Tva, got.AdressePostaleLegale)
+	}
+}
+
+func TestSireneDenomination(t *testing.T) {
+	if got := (sireneUniteLegal{Nom: "MARTIN", Prenom: "ÉLODIE"}).denomination(); got != "ÉLODIE MARTIN" {
+		t.Errorf("entrepreneur individuel : dénomination = %q, attendu \"ÉLODIE MARTIN\"", got)
+	}
+	for etat, want := range map[string]string{"A": statutActive, "C": statutCessee, "": statutInconnu} {
+		if got := mapSireneEtat(etat); got != want {
+			t.Errorf("mapSireneEtat(%q) = %q, attendu %q", etat, got, want)
+		}
+	}
+}
+
+func TestInseeLookupSiren(t *testing.T) {
+	var tokens atomic.Int64
+	useUpstreamHandler(t, fakeInsee(t, &tokens))
+	p := &inseeProvider{clientID: "client-id", clientSecret: "client-secret"}
+
+	got, err := p.Lookup(context.Background(), "552032534", allEntrepriseFields)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	// Période courante de l'unité légale, adresse de l'établissement siège
+	if got.Denomination != "DANONE" || got.Siret != "55203253400646" || got.Tva != "FR27552032534" {
+		t.Errorf("Lookup = %+v", got)
+	}
+	if got.AdressePostaleLegale == nil || got.AdressePostaleLegale.CodePostal != "75009" || got.AdressePostaleLegale.Ville != "PARIS 9" {
+		t.Errorf("adresse = %+v, attendu 75009 PARIS 9", got.AdressePostaleLegale)
+	}
+
+	// Jeton OAuth réutilisé tant qu'il n'a pas expiré
+	if _, err := p.Lookup(context.Background(), "55203253400646", allEntrepriseFields); err != nil {
+		t.Fatalf("Lookup (SIRET): %v", err)
+	}
+	if n := tokens.Load(); n != 1 {
+		t.Errorf("%d demandes de jeton, attendu 1", n)
+	}
+
+	if _, err := p.Lookup(context.Background(), "356000000", allEntrepriseFields); !errors.Is(err, errEntrepriseIntrouvable) {
+		t.Errorf("SIREN inconnu : err = %v, attendu errEntrepriseIntrouvable", err)
+	}
+}
+
+func TestInseeTokenRefreshOnUnauthorized(t *testing.T) {
+	var tokens atomic.Int64
+	useUpstreamHandler(t, fakeInsee(t, &tokens))
+	// Jeton en cache révoqué côté INSEE : renouvelé puis requête rejouée
+	p := &inseeProvider{clientID: "client-id", clientSecret: "client-secret", token: "revoque", tokenExpiry: time.Now().Add(time.Hour)}
+
+	if _, err := p.Lookup(context.Background(), "55203253400646", entrepriseFields{}); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if n := tokens.Load(); n != 1 {
+		t.Errorf("%d demandes de jeton, attendu 1 (renouvellement après 401)", n)
+	}
+}
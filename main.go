@@ -1,55 +1,145 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
-	"net/smtp"
+	"net/mail"
 	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // --- CONSTANTES ---
-const API_TOKEN = "3b8fe35c2885c14c1eaee3248c79472b"
+
+// Erreur retournée quand l'API distante ne connaît pas le SIREN/SIRET
+var errEntrepriseIntrouvable = errors.New("entreprise introuvable (numid invalide)")
+
+// Erreur retournée quand SMTP_HOST/SMTP_PORT ne sont pas définis
+var errSMTPNotConfigured = errors.New("configuration SMTP absente")
+
+// Informations de build, injectées via -ldflags
+// (ex: -X main.Version=1.2.0 -X main.Commit=abc123 -X main.BuildDate=2025-01-01T00:00:00Z)
+var Version, Commit, BuildDate string
+
+// buildValue retourne une information de build, ou "dev" si non injectée
+func buildValue(v string) string {
+	if v == "" {
+		return "dev"
+	}
+	return v
+}
 
 // --- STRUCTURES DE DONNÉES ---
 
 // 1. Structure pour la réponse Entreprise
 type EntrepriseResponse struct {
-	Denomination         string `json:"denomination"`
-	Siren                string `json:"siren"`
-	Siret                string `json:"siret"`
-	Tva                  string `json:"tva"`
-	AdressePostaleLegale struct {
-		Ville      string `json:"ville"`
-		CodePostal string `json:"code_postal"`
-	} `json:"adresse_postale_legale"`
-}
-
-// 2. Structure interne API Societe.com
-type SocieteExistResponse struct {
-	Common struct {
-		Siren      string `json:"siren"`
-		SiretSiege string `json:"siretsiege"`
-		NumTVA     string `json:"numtva"`
-		Deno       string `json:"deno"`
-		Status     string `json:"status"`
-		ImmatInsee string `json:"immatinsee"`
-	} `json:"common"`
-}
-
-// 3. Structure pour la requête d'envoi d'email
+	XMLName              xml.Name        `json:"-" xml:"entreprise"`
+	Denomination         string          `json:"denomination" xml:"denomination"`
+	Siren                string          `json:"siren" xml:"siren"`
+	Siret                string          `json:"siret" xml:"siret"`
+	Status               string          `json:"status,omitempty" xml:"status,omitempty"`     // active, radiée, cessée ou inconnu
+	ImmatriculeeInsee    bool            `json:"immatriculee_insee" xml:"immatriculee_insee"` // Unité légale immatriculée au répertoire Sirene
+	Tva                  string          `json:"tva,omitempty" xml:"tva,omitempty"`
+	AdressePostaleLegale *AdressePostale `json:"adresse_postale_legale,omitempty" xml:"adresse_postale_legale,omitempty"`
+	TvaValide            *bool           `json:"tva_valide,omitempty" xml:"tva_valide,omitempty"` // Uniquement avec ?validate_tva=true
+	CachedAt             time.Time       `json:"cached_at" xml:"cached_at"`                       // Date de récupération auprès du fournisseur
+	Fresh                bool            `json:"fresh" xml:"fresh"`                               // false si servie depuis le cache
+}
+
+// Réponse de GET /api/entreprise/{siren}/tva
+type TVAResponse struct {
+	Siren       string `json:"siren"`
+	Tva         string `json:"tva"`          // ex: FR27552032534
+	TvaFormatee string `json:"tva_formatee"` // ex: FR 27 552032534
+}
+
+type AdressePostale struct {
+	Ville      string `json:"ville" xml:"ville"`
+	CodePostal string `json:"code_postal" xml:"code_postal"`
+}
+
+// Statuts d'entreprise exposés (quel que soit le fournisseur)
+const (
+	statutActive  = "active"
+	statutRadiee  = "radiée"
+	statutCessee  = "cessée"
+	statutInconnu = "inconnu"
+)
+
+// Données optionnelles sélectionnables via ?fields=address,tva
+type entrepriseFields struct {
+	Address bool
+	Tva     bool
+}
+
+// Par défaut (sans ?fields), toutes les données optionnelles sont retournées
+var allEntrepriseFields = entrepriseFields{Address: true, Tva: true}
+
+// 2. Structure pour la requête d'envoi d'email
 type EmailRequest struct {
-	To             string `json:"to"`
-	Subject        string `json:"subject"`
-	Body           string `json:"body"`
-	AttachmentName string `json:"attachment_name"` // Nom du fichier (ex: devis.pdf)
-	AttachmentData string `json:"attachment_data"` // Contenu en Base64
+	To              Recipients        `json:"to" validate:"required,singleline,emaillist"`
+	Cc              Recipients        `json:"cc" validate:"singleline,emaillist"`  // Copie, visible des destinataires
+	Bcc             Recipients        `json:"bcc" validate:"singleline,emaillist"` // Copie cachée (enveloppe SMTP uniquement)
+	Subject         string            `json:"subject" validate:"required,singleline"`
+	Body            string            `json:"body" validate:"required"`
+	BodyHTML        string            `json:"body_html"`                                     // Version HTML optionnelle du corps
+	ReplyTo         string            `json:"reply_to" validate:"singleline,email"`          // Adresse de réponse optionnelle
+	AttachmentName  string            `json:"attachment_name" validate:"singleline"`         // Nom du fichier (ex: devis.pdf)
+	AttachmentData  string            `json:"attachment_data"`                               // Contenu en Base64
+	AttachmentType  string            `json:"attachment_content_type" validate:"singleline"` // Optionnel, détecté depuis l'extension sinon
+	Attachments     []Attachment      `json:"attachments"`                                   // Pièces jointes multiples
+	InlineImages    []InlineImage     `json:"inline_images"`                                 // Images intégrées au HTML (cid:...)
+	MessageID       string            `json:"message_id" validate:"singleline"`              // Message-ID imposé (<id@domaine>), généré sinon
+	ICS             string            `json:"ics"`                                           // Invitation iCalendar (BEGIN:VCALENDAR...), ajoutée en text/calendar
+	Headers         map[string]string `json:"headers"`                                       // En-têtes additionnels (ex: X-Campaign-ID, List-Unsubscribe)
+	Template        string            `json:"template"`                                      // Template serveur (TEMPLATES_DIR) remplaçant subject/body
+	Variables       map[string]any    `json:"variables"`                                     // Variables du template
+	Async           bool              `json:"async"`                                         // Envoi en arrière-plan : réponse 202 avec un job_id
+	CallbackURL     string            `json:"callback_url"`                                  // Avec async : notifié (POST JSON) à la fin de l'envoi
+	DryRun          bool              `json:"dry_run"`                                       // Valide et construit le message sans l'envoyer
+	NoSubjectPrefix bool              `json:"no_subject_prefix"`                             // N'applique pas SUBJECT_PREFIX à cet envoi
+	RequestDSN      bool              `json:"request_dsn"`                                   // Avis de remise (DSN), si le serveur SMTP les gère
+	RequestMDN      bool              `json:"request_mdn"`                                   // Accusé de lecture (Disposition-Notification-To)
+	NotifyAddress   string            `json:"notify_address" validate:"singleline,email"`    // Destinataire de l'accusé de lecture (reply_to ou From par défaut)
+}
+
+// 3. Pièce jointe d'un email
+type Attachment struct {
+	Name        string `json:"name" validate:"singleline"`         // Nom du fichier (ex: devis.pdf)
+	Data        string `json:"data"`                               // Contenu en Base64
+	ContentType string `json:"content_type" validate:"singleline"` // Optionnel, détecté depuis l'extension sinon
+}
+
+// Image intégrée au corps HTML, référencée par <img src="cid:logo">
+type InlineImage struct {
+	Cid         string `json:"cid"`                                // Identifiant référencé dans le HTML (ex: logo)
+	Name        string `json:"name" validate:"singleline"`         // Nom du fichier, optionnel (ex: logo.png)
+	Data        string `json:"data"`                               // Contenu en Base64
+	ContentType string `json:"content_type" validate:"singleline"` // Optionnel, détecté depuis l'extension sinon
+}
+
+// 4. Réponse d'un envoi en mode dry_run (message construit mais non envoyé)
+type EmailDryRunResponse struct {
+	Message string              `json:"message"`
+	DryRun  bool                `json:"dry_run"`
+	Headers map[string][]string `json:"headers"`
+	Size    int                 `json:"size"` // Taille du message MIME en octets
 }
 
 // Structures utilitaires
@@ -58,9 +148,19 @@ type InfoResponse struct {
 	Data   any    `json:"data,omitempty"`
 }
 
+// APIError est le format commun des réponses d'erreur. Le message reste sous
+// la clé "error" (compatibilité avec les clients existants) et "code" est un
+// identifiant stable sur lequel le frontend peut s'appuyer.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"error"`
+	Details any    `json:"details,omitempty"`
+}
+
 type HealthResponse struct {
-	Status string `json:"status"`
-	Code   int    `json:"code"`
+	Status       string                     `json:"status"`
+	Code         int                        `json:"code"`
+	Dependencies map[string]DependencyCheck `json:"dependencies,omitempty"` // Uniquement avec ?verbose=1
 }
 
 // --- UTILITAIRES ---
@@ -77,320 +177,896 @@ func splitLines(s string) string {
 	return strings.Join(lines, "\r\n")
 }
 
-// --- MIDDLEWARES ---
+// writeError écrit une réponse d'erreur JSON au format APIError
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeAPIError(w, status, APIError{Code: code, Message: message})
+}
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		allowedOrigins := []string{
-			"http://localhost:8082",
-			"https://vintagestandards.fr",
-			"https://dev.vintagestandards.fr/",
-		}
+func writeAPIError(w http.ResponseWriter, status int, apiErr APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiErr)
+}
 
-		origin := r.Header.Get("Origin")
-		for _, allowed := range allowedOrigins {
-			if origin == allowed {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
-				break
-			}
+// allowMethods vérifie la méthode HTTP de la requête. Sinon, répond 405 avec
+// un en-tête Allow listant les méthodes acceptées (OPTIONS est géré par CORS).
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
 		}
-//
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+	allow := strings.Join(append(methods, http.MethodOptions), ", ")
+	w.Header().Set("Allow", allow)
+	writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Méthode non autorisée. Utilisez "+strings.Join(methods, " ou ")+".")
+	return false
+}
 
-		next.ServeHTTP(w, r)
-	})
+// envDuration lit une durée (ex: "30s", "1h") depuis l'environnement,
+// avec une valeur par défaut si absente ou invalide
+func envDuration(key string, def time.Duration) time.Duration {
+	v := getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		slog.Warn("variable d'environnement invalide, valeur par défaut utilisée", "key", key, "value", v, "default", def)
+		return def
+	}
+	return d
 }
 
-// --- LOGIQUE MÉTIER (Appel /exist) ---
+// setupLogger configure le logger slog global : JSON par défaut (agrégateur
+// de logs), texte lisible si LOG_FORMAT=text, niveau via LOG_LEVEL
+func setupLogger() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
 
-func fetchSocieteExistData(numid string) (*EntrepriseResponse, error) {
-	url := fmt.Sprintf("https://api.societe.com/api/v1/entreprise/%s/exist", numid)
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if strings.EqualFold(getenv("LOG_FORMAT"), "text") {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
 
-	req, err := http.NewRequest("GET", url, nil)
+// envInt lit un entier depuis l'environnement, avec une valeur par défaut
+// si absente ou invalide
+func envInt(key string, def int) int {
+	v := getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
 	if err != nil {
-		return nil, err
+		slog.Warn("variable d'environnement invalide, valeur par défaut utilisée", "key", key, "value", v, "default", def)
+		return def
 	}
+	return n
+}
 
-	req.Header.Set("X-Authorization", "socapi "+API_TOKEN)
-	req.Header.Set("Accept", "application/json")
+// envDate lit une date (RFC 3339 ou AAAA-MM-JJ) depuis l'environnement,
+// avec une valeur par défaut si absente ou invalide
+func envDate(key string, def time.Time) time.Time {
+	v := getenv(key)
+	if v == "" {
+		return def
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t
+		}
+	}
+	slog.Warn("variable d'environnement invalide, valeur par défaut utilisée", "key", key, "value", v, "default", def)
+	return def
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+// Les SIRET des établissements de La Poste ne respectent pas toujours la clé
+// de Luhn : la somme de leurs chiffres doit alors être un multiple de 5.
+const laPosteSiren = "356000000"
+
+// validateLuhn vérifie la clé de contrôle d'un SIREN (9 chiffres) ou d'un
+// SIRET (14 chiffres) selon l'algorithme de Luhn
+func validateLuhn(numid string) bool {
+	if len(numid) != 9 && len(numid) != 14 {
+		return false
+	}
+
+	sum := 0
+	plainSum := 0
+	for i := 0; i < len(numid); i++ {
+		c := numid[len(numid)-1-i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		plainSum += d
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+
+	if len(numid) == 14 && strings.HasPrefix(numid, laPosteSiren) {
+		return sum%10 == 0 || plainSum%5 == 0
 	}
-	defer resp.Body.Close()
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+	return sum%10 == 0
+}
+
+// normalizeNumid nettoie un SIREN/SIRET saisi par l'utilisateur : espaces
+// (y compris insécables), points, tirets et barres obliques sont retirés.
+// Toute lettre ou autre caractère non numérique est refusé.
+func normalizeNumid(raw string) (string, error) {
+	var b strings.Builder
+	for _, c := range raw {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case unicode.IsSpace(c), c == '.', c == '-', c == '/':
+		case unicode.IsLetter(c):
+			return "", fmt.Errorf("SIREN/SIRET invalide : lettre %q non autorisée, seuls les chiffres sont acceptés", c)
+		default:
+			return "", fmt.Errorf("SIREN/SIRET invalide : caractère %q non autorisé", c)
+		}
+	}
+	return b.String(), nil
+}
+
+// Type d'identifiant attendu par un handler
+type numidKind int
+
+const (
+	numidAny   numidKind = iota // SIREN ou SIRET
+	numidSiren                  // SIREN (9 chiffres) uniquement
+	numidSiret                  // SIRET (14 chiffres) uniquement
+)
+
+// parseNumid normalise un identifiant et vérifie qu'il correspond au type
+// attendu ; le message d'erreur précise ce qui était attendu
+func parseNumid(raw string, kind numidKind) (string, error) {
+	numid, err := normalizeNumid(raw)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	if resp.StatusCode == 404 {
-		return nil, fmt.Errorf("entreprise introuvable (numid invalide)")
+	switch kind {
+	case numidSiren:
+		if len(numid) != 9 {
+			return "", fmt.Errorf("SIREN attendu (9 chiffres), %d chiffres reçus", len(numid))
+		}
+	case numidSiret:
+		if len(numid) != 14 {
+			return "", fmt.Errorf("SIRET attendu (14 chiffres), %d chiffres reçus", len(numid))
+		}
+	default:
+		if len(numid) != 9 && len(numid) != 14 {
+			return "", errors.New("Le paramètre doit être un SIREN (9 chiffres) ou un SIRET (14 chiffres)")
+		}
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("erreur API distante : %d - %s", resp.StatusCode, string(bodyBytes))
+	if !validateLuhn(numid) {
+		return "", errors.New("SIREN/SIRET invalide (clé de contrôle incorrecte)")
 	}
+	return numid, nil
+}
 
-	log.Printf("DEBUG - Réponse API brute pour %s : %s", numid, string(bodyBytes))
+// computeTVA calcule le numéro de TVA intracommunautaire français d'un SIREN :
+// "FR" + clé sur 2 chiffres ((12 + 3 * (SIREN mod 97)) mod 97) + SIREN
+func computeTVA(siren string) (string, error) {
+	if len(siren) != 9 || !validateLuhn(siren) {
+		return "", fmt.Errorf("SIREN invalide : %q", siren)
+	}
+	n, err := strconv.Atoi(siren)
+	if err != nil {
+		return "", fmt.Errorf("SIREN invalide : %q", siren)
+	}
+	key := (12 + 3*(n%97)) % 97
+	return fmt.Sprintf("FR%02d%s", key, siren), nil
+}
 
-	var apiData SocieteExistResponse
-	if err := json.Unmarshal(bodyBytes, &apiData); err != nil {
-		return nil, fmt.Errorf("erreur de décodage JSON : %v", err)
+// formatTVA met en forme un numéro de TVA français pour l'affichage
+// ("FR27552032534" -> "FR 27 552032534")
+func formatTVA(tva string) string {
+	tva = strings.ToUpper(strings.Join(strings.Fields(tva), ""))
+	if len(tva) != 13 || !strings.HasPrefix(tva, "FR") {
+		return tva
 	}
+	return tva[:2] + " " + tva[2:4] + " " + tva[4:]
+}
+
+// validateTVA vérifie qu'un numéro de TVA (espaces tolérés) correspond au SIREN
+func validateTVA(siren, tva string) bool {
+	expected, err := computeTVA(siren)
+	if err != nil {
+		return false
+	}
+	return strings.ToUpper(strings.Join(strings.Fields(tva), "")) == expected
+}
 
-	result := &EntrepriseResponse{}
-	result.Denomination = apiData.Common.Deno
-	result.Siren = apiData.Common.Siren
-	result.Siret = apiData.Common.SiretSiege
-	result.Tva = apiData.Common.NumTVA
+// parseEntrepriseFields lit le paramètre ?fields (ex: "address,tva").
+// Vide : toutes les données optionnelles.
+func parseEntrepriseFields(raw string) (entrepriseFields, error) {
+	if strings.TrimSpace(raw) == "" {
+		return allEntrepriseFields, nil
+	}
 
-	return result, nil
+	var fields entrepriseFields
+	for _, f := range strings.Split(raw, ",") {
+		switch strings.TrimSpace(f) {
+		case "address":
+			fields.Address = true
+		case "tva":
+			fields.Tva = true
+		case "":
+		default:
+			return fields, fmt.Errorf("champ inconnu dans 'fields' : %q (valeurs possibles : address, tva)", f)
+		}
+	}
+	return fields, nil
 }
 
 // --- HANDLERS ---
 
 func entrepriseHandler(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
 	w.Header().Set("Content-Type", "application/json")
 
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	// Deux formes acceptées : /api/entreprise/{numid} et /api/entreprise?id={numid}
 	numid := strings.TrimPrefix(r.URL.Path, "/api/entreprise/")
+	if r.URL.Path == "/api/entreprise" {
+		numid = r.URL.Query().Get("id")
+	}
 
-	if len(numid) != 9 && len(numid) != 14 {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Le paramètre doit être un SIREN (9 chiffres) ou un SIRET (14 chiffres)",
-		})
+	// Sous-ressource : /api/entreprise/{siren}/tva
+	if siren, ok := strings.CutSuffix(numid, "/tva"); ok && r.URL.Path != "/api/entreprise" {
+		entrepriseTVAHandler(w, r, siren)
 		return
 	}
 
-	log.Printf("🔍 Vérification existence (SIREN/SIRET) : %s", numid)
+	// JSON par défaut, XML pour les intégrations historiques (Accept: application/xml)
+	w.Header().Add("Vary", "Accept")
+	format, ok := negotiateFormat(r.Header.Get("Accept"))
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, "NOT_ACCEPTABLE", "Formats disponibles : application/json, application/xml")
+		return
+	}
 
-	data, err := fetchSocieteExistData(numid)
+	fields, err := parseEntrepriseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_FIELDS", err.Error())
+		return
+	}
 
+	// Tolère les saisies copiées-collées ("123 456 789", "123.456.789")
+	numid, err = parseNumid(numid, numidAny)
 	if err != nil {
-		log.Printf("❌ Erreur : %v", err)
-		if strings.Contains(err.Error(), "introuvable") {
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Entreprise inconnue"})
+		writeError(w, http.StatusBadRequest, "INVALID_SIREN", err.Error())
+		return
+	}
+
+	logger.Info("vérification existence entreprise", "route", "/api/entreprise", "numid", numid)
+
+	cacheKey := fmt.Sprintf("%s|%+v", numid, fields)
+	data, err := entrepriseCache.lookup(r.Context(), cacheKey, func(ctx context.Context) (*EntrepriseResponse, error) {
+		return companyProvider.Lookup(ctx, numid, fields)
+	})
+
+	if err != nil {
+		logger.Error("échec recherche entreprise", "route", "/api/entreprise", "numid", numid, "error", err)
+		if errors.Is(err, errEntrepriseIntrouvable) {
+			writeError(w, http.StatusNotFound, "COMPANY_NOT_FOUND", "Entreprise inconnue")
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			writeUpstreamError(w, err)
 		}
 		return
 	}
 
-	log.Printf("✅ Trouvé : %s (SIREN: %s)", data.Denomination, data.Siren)
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(data)
+	logger.Info("entreprise trouvée", "route", "/api/entreprise", "denomination", data.Denomination, "siren", data.Siren)
+
+	// Copie : data peut être partagé avec le cache
+	response := *data
+	if r.URL.Query().Get("validate_tva") == "true" {
+		valid := validateTVA(response.Siren, response.Tva)
+		if !valid {
+			logger.Warn("numéro de TVA incohérent avec le SIREN", "siren", response.Siren, "tva", response.Tva)
+		}
+		response.TvaValide = &valid
+	}
+
+	// Corps construit en mémoire pour calculer l'ETag
+	var body bytes.Buffer
+	if format == formatXML {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		encodeXML(&body, response)
+	} else {
+		json.NewEncoder(&body).Encode(response)
+	}
+	writeCacheable(w, r, body.Bytes(), companyVersion(response, format))
 }
 
-// Handler d'envoi d'email (Support PDF + Fix SSL/TLS + MIME Fix)
-func sendEmailHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// entrepriseTVAHandler retourne le numéro de TVA intracommunautaire d'une
+// entreprise, formaté pour l'affichage. Le numéro fourni par le fournisseur
+// est utilisé s'il est cohérent, sinon il est calculé depuis le SIREN.
+func entrepriseTVAHandler(w http.ResponseWriter, r *http.Request, raw string) {
+	logger := loggerFromContext(r.Context())
 
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Méthode non autorisée. Utilisez POST."})
+	siren, err := parseNumid(raw, numidSiren)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_SIREN", err.Error())
 		return
 	}
 
-	var req EmailRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "JSON invalide"})
+	fields := entrepriseFields{Tva: true}
+	cacheKey := fmt.Sprintf("%s|%+v", siren, fields)
+	data, err := entrepriseCache.lookup(r.Context(), cacheKey, func(ctx context.Context) (*EntrepriseResponse, error) {
+		return companyProvider.Lookup(ctx, siren, fields)
+	})
+	if err != nil {
+		logger.Error("échec recherche entreprise", "route", "/api/entreprise/{siren}/tva", "siren", siren, "error", err)
+		if errors.Is(err, errEntrepriseIntrouvable) {
+			writeError(w, http.StatusNotFound, "COMPANY_NOT_FOUND", "Entreprise inconnue")
+		} else {
+			writeUpstreamError(w, err)
+		}
 		return
 	}
 
-	if req.To == "" || req.Subject == "" || req.Body == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Les champs 'to', 'subject' et 'body' sont requis"})
-		return
+	tva := strings.ToUpper(strings.Join(strings.Fields(data.Tva), ""))
+	if !validateTVA(siren, tva) {
+		if tva != "" {
+			logger.Warn("numéro de TVA incohérent avec le SIREN, recalculé", "siren", siren, "tva", tva)
+		}
+		// Ne peut échouer : le SIREN a été validé ci-dessus
+		tva, _ = computeTVA(siren)
 	}
 
-	// --- RECUPERATION ENV ---
-	smtpHost := os.Getenv("SMTP_HOST")
-	smtpPort := os.Getenv("SMTP_PORT")
-	smtpUser := os.Getenv("SMTP_ADMIN_EMAIL")
-	smtpPass := os.Getenv("SMTP_PASS")
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(TVAResponse{Siren: siren, Tva: tva, TvaFormatee: formatTVA(tva)})
+	writeCacheable(w, r, body.Bytes(), nil)
+}
 
-	log.Printf("📧 Config SMTP -> Host: %s | Port: %s | User: %s", smtpHost, smtpPort, smtpUser)
+// emailPreviewHandler accepte la même requête que /api/send-email et
+// retourne le message MIME complet tel qu'il serait transmis au serveur SMTP
+// (encodages compris), sans jamais l'envoyer
+func emailPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithValue(r.Context(), emailPreviewKey, true)
+	sendEmailHandler(w, r.WithContext(ctx))
+}
+
+// Handler d'envoi d'email (Support PDF + Fix SSL/TLS + MIME Fix)
+func sendEmailHandler(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
 
-	if smtpHost == "" || smtpPort == "" || smtpUser == "" || smtpPass == "" {
-		log.Println("❌ Erreur : Configuration SMTP incomplète (ENV)")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Configuration serveur email incomplète"})
+	if !allowMethods(w, r, http.MethodPost) {
 		return
 	}
 
-	// Debug : Vérifier si on reçoit le PDF
-	if req.AttachmentData != "" {
-		log.Printf("📎 Backend : PDF reçu ! Taille: %d caractères", len(req.AttachmentData))
-	} else {
-		log.Println("⚠️ Backend : Pas de données PDF reçues")
-	}
+	// Taille du corps limitée par bodyLimitMiddleware (voir emailMaxBodyBytes)
+	maxAttachment := maxAttachmentBytes()
 
-	// --- CONSTRUCTION EMAIL (MIME Multipart) ---
-	boundary := "MyBoundarySeparation12345"
+	// Champ inconnu refusé : une faute de frappe (ex: "attachement_data")
+	// enverrait sinon l'email sans la donnée attendue
+	var req EmailRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", "Requête trop volumineuse")
+			return
+		}
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			field = strings.Trim(field, `"`)
+			writeAPIError(w, http.StatusBadRequest, APIError{
+				Code:    "UNKNOWN_FIELD",
+				Message: fmt.Sprintf("Champ inconnu : '%s'", field),
+				Details: map[string]string{"field": field},
+			})
+			return
+		}
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "JSON invalide")
+		return
+	}
 
-	// En-têtes
-	header := make(map[string]string)
-	header["From"] = smtpUser
-	header["To"] = req.To
-	header["Subject"] = req.Subject
-	header["MIME-Version"] = "1.0"
-	header["Content-Type"] = "multipart/mixed; boundary=" + boundary
+	if req.Template != "" {
+		if err := req.applyTemplate(); err != nil {
+			code := "TEMPLATE_RENDER_FAILED"
+			if errors.Is(err, errTemplateNotFound) {
+				code = "TEMPLATE_NOT_FOUND"
+			}
+			writeError(w, http.StatusBadRequest, code, err.Error())
+			return
+		}
+	}
 
-	message := ""
-	for k, v := range header {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
+	// Champs requis, adresses et valeurs recopiées dans des en-têtes MIME
+	// (un CR/LF permettrait d'injecter des en-têtes, ex: "\r\nBcc: ...") :
+	// toutes les erreurs sont renvoyées ensemble (voir les tags validate)
+	if errs := validateStruct(req); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
 	}
-	message += "\r\n"
 
-	// PARTIE 1 : Corps du texte
-	message += fmt.Sprintf("--%s\r\n", boundary)
-	message += "Content-Type: text/plain; charset=\"utf-8\"\r\n"
-	message += "Content-Transfer-Encoding: 7bit\r\n"
-	message += "\r\n"
-	message += req.Body + "\r\n"
+	async := req.Async || r.URL.Query().Get("async") == "true"
+	if req.CallbackURL != "" {
+		if !async {
+			writeError(w, http.StatusBadRequest, "INVALID_CALLBACK_URL", "Le champ 'callback_url' nécessite un envoi asynchrone (async)")
+			return
+		}
+		if err := validateCallbackURL(r.Context(), req.CallbackURL); err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_CALLBACK_URL", err.Error())
+			return
+		}
+	}
 
-	// PARTIE 2 : Pièce jointe (si présente)
-	if req.AttachmentData != "" && req.AttachmentName != "" {
-		// Nettoyage nom de fichier
-		cleanName := strings.ReplaceAll(req.AttachmentName, "\n", "")
+	if err := validateCustomHeaders(req.Headers); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_HEADER", err.Error())
+		return
+	}
 
-		message += fmt.Sprintf("--%s\r\n", boundary)
-		message += "Content-Type: application/pdf\r\n"
-		message += "Content-Transfer-Encoding: base64\r\n"
-		message += fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n", cleanName)
-		message += "\r\n"
-		// IMPORTANT : Découpage du Base64
-		message += splitLines(req.AttachmentData) + "\r\n"
+	if req.MessageID != "" {
+		id, err := normalizeMessageID(req.MessageID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_MESSAGE_ID", err.Error())
+			return
+		}
+		req.MessageID = id
 	}
 
-	message += fmt.Sprintf("--%s--\r\n", boundary)
+	if req.ICS != "" {
+		if err := validateICS(req.ICS); err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_ICS", err.Error())
+			return
+		}
+	}
 
-	// --- ENVOI ---
-	msgBytes := []byte(message)
-	addr := smtpHost + ":" + smtpPort
-	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
+	// Vérification optionnelle (CHECK_MX=1) que le domaine destinataire
+	// accepte les emails, pour détecter les fautes de frappe (@gmial.com)
+	if getenv("CHECK_MX") == "1" {
+		for _, addr := range req.envelopeRecipients() {
+			domain := addressDomain(addr)
+			err := recipientMXChecker.check(r.Context(), domain)
+			switch {
+			case errors.Is(err, errNoMX):
+				writeAPIError(w, http.StatusBadRequest, APIError{
+					Code:    "UNDELIVERABLE_DOMAIN",
+					Message: fmt.Sprintf("Le domaine '%s' n'accepte pas d'emails (ni MX ni adresse IP, ou null MX)", domain),
+					Details: map[string]string{"field": "to"},
+				})
+				return
+			case err != nil:
+				// Erreur DNS temporaire : on ne bloque pas l'envoi
+				logger.Warn("vérification MX impossible", "domain", domain, "error", err)
+			}
+		}
+	}
 
-	var err error
+	// Limites globales (mémoire, taille maximale acceptée par le serveur SMTP),
+	// vérifiées sur la taille estimée avant tout décodage du Base64
+	attachmentCount := len(req.allAttachments()) + len(req.InlineImages)
+	if limit := maxAttachments(); attachmentCount > limit {
+		writeError(w, http.StatusRequestEntityTooLarge, "TOO_MANY_ATTACHMENTS",
+			fmt.Sprintf("Trop de pièces jointes (%d, maximum %d images intégrées comprises)", attachmentCount, limit))
+		return
+	}
+	var totalSize int64
+	for _, a := range req.allAttachments() {
+		totalSize += decodedBase64Size(a.Data)
+	}
+	for _, img := range req.InlineImages {
+		totalSize += decodedBase64Size(img.Data)
+	}
+	if limit := maxTotalAttachmentBytes(); totalSize > limit {
+		writeError(w, http.StatusRequestEntityTooLarge, "ATTACHMENTS_TOO_LARGE",
+			fmt.Sprintf("Pièces jointes trop volumineuses au total (%d octets, maximum %d)", totalSize, limit))
+		return
+	}
 
-	// GESTION SSL (Port 465) vs STARTTLS (587)
-	if smtpPort == "465" {
-		log.Println("🔒 Connexion SSL Implicite détectée (Port 465)")
-		err = sendMail465(addr, auth, smtpUser, []string{req.To}, msgBytes)
-	} else {
-		log.Println("🔓 Connexion STARTTLS standard")
-		err = smtp.SendMail(addr, auth, smtpUser, []string{req.To}, msgBytes)
+	for _, a := range req.allAttachments() {
+		if size := decodedBase64Size(a.Data); size > maxAttachment {
+			writeError(w, http.StatusRequestEntityTooLarge, "ATTACHMENT_TOO_LARGE",
+				fmt.Sprintf("Pièce jointe '%s' trop volumineuse (%d octets, maximum %d)", a.Name, size, maxAttachment))
+			return
+		}
+	}
+	for _, img := range req.InlineImages {
+		if size := decodedBase64Size(img.Data); size > maxAttachment {
+			writeError(w, http.StatusRequestEntityTooLarge, "ATTACHMENT_TOO_LARGE",
+				fmt.Sprintf("Image intégrée '%s' trop volumineuse (%d octets, maximum %d)", img.Cid, size, maxAttachment))
+			return
+		}
 	}
 
-	if err != nil {
-		log.Printf("❌ Erreur lors de l'envoi SMTP : %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Échec de l'envoi : " + err.Error()})
+	if err := req.normalizeAttachments(); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ATTACHMENT", err.Error())
+		return
+	}
+	if err := req.checkAttachmentTypes(); err != nil {
+		writeError(w, http.StatusBadRequest, "ATTACHMENT_TYPE_NOT_ALLOWED", err.Error())
+		return
+	}
+	if err := req.normalizeInlineImages(); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INLINE_IMAGE", err.Error())
 		return
 	}
 
-	log.Printf("✅ Email envoyé avec succès à : %s", req.To)
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Email envoyé avec succès"})
-}
+	// --- RECUPERATION ENV ---
+	smtpCfg := loadSMTPConfig()
 
-// Fonction utilitaire pour gérer le SSL (Port 465)
-func sendMail465(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
-	host, _, _ := net.SplitHostPort(addr)
+	logger.Debug("configuration SMTP", "host", smtpCfg.host, "port", smtpCfg.port, "user", smtpCfg.user)
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: false,
-		ServerName:         host,
+	// Debug : Vérifier si on reçoit les pièces jointes
+	attachments := req.allAttachments()
+	if len(attachments) > 0 {
+		for _, a := range attachments {
+			logger.Debug("pièce jointe reçue", "name", a.Name, "size", len(a.Data))
+		}
+	} else {
+		logger.Debug("aucune pièce jointe reçue")
 	}
 
-	conn, err := tls.Dial("tcp", addr, tlsConfig)
-	if err != nil {
-		return err
+	// Préfixe de marque (SUBJECT_PREFIX), ajouté avant l'encodage RFC 2047
+	if !req.NoSubjectPrefix {
+		req.Subject = applySubjectPrefix(req.Subject)
 	}
-	defer conn.Close()
 
-	client, err := smtp.NewClient(conn, host)
+	// Longueur maximale du sujet (MAX_SUBJECT_LENGTH), préfixe compris
+	subject, err := limitSubject(req.Subject)
 	if err != nil {
-		return err
+		writeError(w, http.StatusBadRequest, "SUBJECT_TOO_LONG", err.Error())
+		return
 	}
-	defer client.Close()
+	req.Subject = subject
 
-	if auth != nil {
-		if ok, _ := client.Extension("AUTH"); ok {
-			if err = client.Auth(auth); err != nil {
-				return err
-			}
+	// --- CONSTRUCTION EMAIL (MIME Multipart) ---
+	// Message-ID fixé par le service (sinon généré par le serveur SMTP) pour
+	// garder la maîtrise des fils de discussion et de la déduplication
+	from := fromHeader(smtpCfg.user)
+	if req.MessageID == "" {
+		req.MessageID = newMessageID(from)
+	}
+	message := buildEmailMessage(req, from)
+
+	// --- APERÇU (message brut RFC 822, jamais envoyé) ---
+	if preview, _ := r.Context().Value(emailPreviewKey).(bool); preview {
+		logger.Info("aperçu du message (non envoyé)", "route", "/api/email/preview", "to", req.To, "size", len(message))
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, message)
+		return
+	}
+
+	// --- DRY RUN (validation et construction uniquement) ---
+	if req.DryRun || r.URL.Query().Get("dry_run") == "1" {
+		parsed, err := mail.ReadMessage(strings.NewReader(message))
+		if err != nil {
+			logger.Error("message construit illisible", "route", "/api/send-email", "error", err)
+			writeError(w, http.StatusInternalServerError, "SMTP_SEND_FAILED", "Message invalide : "+err.Error())
+			return
 		}
+		logger.Info("email validé (dry_run, non envoyé)", "route", "/api/send-email", "to", req.To, "size", len(message))
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(EmailDryRunResponse{
+			Message: "Email valide (non envoyé)",
+			DryRun:  true,
+			Headers: parsed.Header,
+			Size:    len(message),
+		})
+		return
 	}
 
-	if err = client.Mail(from); err != nil {
-		return err
+	// --- ENVOI ---
+	// Aperçu et dry_run ne se connectent pas : la configuration SMTP complète
+	// n'est exigée qu'ici
+	if !requireSMTPConfig(w, logger, "/api/send-email", smtpCfg) {
+		return
 	}
-	for _, addr := range to {
-		if err = client.Rcpt(addr); err != nil {
-			return err
+
+	out := smtpCfg.outgoing(req.envelopeRecipients(), req.Subject, []byte(message))
+	out.dsn = req.RequestDSN
+
+	// Envoi asynchrone : la requête rend la main immédiatement (202)
+	if async {
+		job, err := emailQueue.enqueue(out, req.CallbackURL, logger)
+		if err != nil {
+			logger.Warn("file d'envoi pleine", "route", "/api/send-email", "to", req.To)
+			writeError(w, http.StatusServiceUnavailable, "QUEUE_FULL", "File d'envoi pleine, réessayez plus tard")
+			return
 		}
+		logger.Info("email mis en file d'envoi", "route", "/api/send-email", "to", req.To, "job_id", job.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+		return
 	}
-	w, err := client.Data()
-	if err != nil {
-		return err
+
+	if !waitSMTPSlot(w, r, logger, "/api/send-email") {
+		return
 	}
-	_, err = w.Write(msg)
+	defer releaseSMTPSlot()
+
+	results, err := out.send(logger)
 	if err != nil {
-		return err
+		writeError(w, http.StatusInternalServerError, "SMTP_SEND_FAILED", "Échec de l'envoi : "+err.Error())
+		return
 	}
-	err = w.Close()
-	if err != nil {
-		return err
+
+	// Envoi partiel : certains destinataires ont été refusés par le serveur
+	if len(rejectedRecipients(results)) > 0 {
+		w.WriteHeader(http.StatusMultiStatus)
+		json.NewEncoder(w).Encode(map[string]any{
+			"message":    "Email envoyé partiellement",
+			"message_id": req.MessageID,
+			"recipients": results,
+		})
+		return
 	}
-	return client.Quit()
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email envoyé avec succès", "message_id": req.MessageID})
+}
+
+// requireSMTPConfig répond SMTP_CONFIG_MISSING (500) si la configuration
+// SMTP est incomplète
+func requireSMTPConfig(w http.ResponseWriter, logger *slog.Logger, route string, cfg smtpConfig) bool {
+	if cfg.complete() {
+		return true
+	}
+	logger.Error("configuration SMTP incomplète (ENV)", "route", route)
+	writeError(w, http.StatusInternalServerError, "SMTP_CONFIG_MISSING", "Configuration serveur email incomplète")
+	return false
+}
+
+// waitSMTPSlot attend une place d'envoi libre au plus SMTP_SLOT_TIMEOUT, et
+// répond SMTP_BUSY (503 avec Retry-After) sinon. En cas de succès, l'appelant
+// libère la place avec releaseSMTPSlot.
+func waitSMTPSlot(w http.ResponseWriter, r *http.Request, logger *slog.Logger, route string) bool {
+	ctx, cancel := context.WithTimeout(r.Context(), smtpSlotTimeout())
+	defer cancel()
+	if err := acquireSMTPSlot(ctx); err != nil {
+		logger.Warn("aucune place d'envoi SMTP disponible", "route", route)
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, "SMTP_BUSY", "Trop d'envois en cours, réessayez plus tard")
+		return false
+	}
+	return true
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(HealthResponse{Status: "ok", Code: 200})
+	resp := HealthResponse{Status: "ok", Code: 200}
+	// Mode détaillé : latence mesurée vers SMTP et l'API entreprise (le statut
+	// reste "ok", /health ne sert qu'à la sonde de vivacité). Les erreurs
+	// détaillées ne sont exposées qu'avec la clé API.
+	if r.URL.Query().Get("verbose") == "1" {
+		authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			resp.Dependencies = dependencies.check(r.Context())
+			json.NewEncoder(w).Encode(resp)
+		})).ServeHTTP(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
 }
 
 func infoHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(InfoResponse{Status: "success", Data: map[string]string{"version": "1.0.0"}})
+	json.NewEncoder(w).Encode(InfoResponse{Status: "success", Data: map[string]any{
+		"version":          buildValue(Version),
+		"commit":           buildValue(Commit),
+		"build_date":       buildValue(BuildDate),
+		"entreprise_cache": entrepriseCache.stats(),
+	}})
+}
+
+// Réponse de GET /version
+type VersionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// versionHandler expose les métadonnées de build (injectées via -ldflags)
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VersionResponse{
+		Version:   buildValue(Version),
+		Commit:    buildValue(Commit),
+		BuildDate: buildValue(BuildDate),
+		GoVersion: runtime.Version(),
+	})
 }
 
 // --- MAIN ---
 
-func main() {
-	port := os.Getenv("PORT")
+// newHandler déclare les routes et applique la chaîne de middlewares
+func newHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/ready", readyHandler)
+	mux.HandleFunc("/info", infoHandler)
+	mux.HandleFunc("/version", versionHandler)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	// Routes Métier (protégées par clé API)
+	mux.Handle("/api/entreprise", authMiddleware(http.HandlerFunc(entrepriseHandler)))
+	mux.Handle("/api/entreprise/", authMiddleware(http.HandlerFunc(entrepriseHandler)))
+	mux.Handle("/api/entreprise/search", authMiddleware(http.HandlerFunc(entrepriseSearchHandler)))
+	mux.Handle("/api/entreprise/batch", authMiddleware(http.HandlerFunc(entrepriseBatchHandler)))
+	sendEmail := authMiddleware(rateLimitMiddleware(emailRateLimiter, idempotencyMiddleware(emailIdempotency, http.HandlerFunc(sendEmailHandler))))
+	mux.Handle("/api/send-email", sendEmail)
+	mux.Handle("/api/email/preview", authMiddleware(http.HandlerFunc(emailPreviewHandler)))
+	mux.Handle("/api/email/validate", authMiddleware(http.HandlerFunc(emailValidateHandler)))
+	mux.Handle("/api/emails", authMiddleware(http.HandlerFunc(emailLogHandler)))
+	mux.Handle("/api/config", authMiddleware(http.HandlerFunc(configHandler)))
+	mux.Handle("/api/emails/", authMiddleware(http.HandlerFunc(emailJobHandler)))
+	mux.Handle("/Send/", deprecatedRouteMiddleware("/api/send-email", sendEmail)) // Alias obsolète
+
+	return requestIDMiddleware(corsMiddleware(requestLogMiddleware(metricsMiddleware(recoverMiddleware(gzipMiddleware(bodyLimitMiddleware(mux)))))))
+}
+
+// listenAddr retourne l'adresse d'écoute : PORT (8091 par défaut) sur
+// l'interface BIND_ADDR (ex: 127.0.0.1 derrière un reverse proxy), toutes
+// les interfaces si BIND_ADDR est absent
+func listenAddr() string {
+	port := getenv("PORT")
 	if port == "" {
 		port = "8091"
 	}
+	return net.JoinHostPort(getenv("BIND_ADDR"), port)
+}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/health", healthHandler)
-	mux.HandleFunc("/info", infoHandler)
+// newServer configure le serveur HTTP (TLS 1.2 minimum, délais)
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+
+		// Délais serveur (protection slowloris). WriteTimeout couvre l'envoi
+		// SMTP avec ses nouvelles tentatives.
+		ReadHeaderTimeout: envDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       envDuration("HTTP_READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:      envDuration("HTTP_WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:       envDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+	}
+}
 
-	// Routes Métier
-	mux.HandleFunc("/api/entreprise/", entrepriseHandler)
-	mux.HandleFunc("/api/send-email", sendEmailHandler)
-	mux.HandleFunc("/Send/", sendEmailHandler) // Alias
+func main() {
+	setupLogger()
 
-	handler := corsMiddleware(mux)
+	if fileConfigErr != nil {
+		slog.Error("fichier de configuration invalide", "error", fileConfigErr)
+		os.Exit(1)
+	}
+	if trustedProxiesErr != nil {
+		slog.Error("configuration invalide", "error", trustedProxiesErr)
+		os.Exit(1)
+	}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		slog.Info("configuration chargée depuis un fichier", "path", path, "keys", len(fileConfig))
+	}
+
+	addr := listenAddr()
+
+	provider, err := newCompanyProvider(getenv("COMPANY_PROVIDER"))
+	if err != nil {
+		slog.Error("fournisseur de données entreprise invalide", "error", err)
+		os.Exit(1)
+	}
+	companyProvider = provider
+	slog.Info("fournisseur de données entreprise", "provider", provider.Name())
+
+	if provider.Name() == "insee" && (getenv("INSEE_CLIENT_ID") == "" || getenv("INSEE_CLIENT_SECRET") == "") {
+		slog.Error("INSEE_CLIENT_ID et INSEE_CLIENT_SECRET sont requis avec COMPANY_PROVIDER=insee")
+		os.Exit(1)
+	}
 
-	log.Printf("🚀 Serveur démarré sur :%s", port)
-	log.Printf("📍 Route Entreprise : GET /api/entreprise/{siren}")
-	log.Printf("📍 Route Email      : POST /api/send-email (Support PDF)")
+	if provider.Name() == "societe" && getenv("SOCIETE_API_TOKEN") == "" {
+		if getenv("DEV_MODE") != "1" {
+			slog.Error("SOCIETE_API_TOKEN manquant : définissez la variable d'environnement (ou DEV_MODE=1 en local)")
+			os.Exit(1)
+		}
+		slog.Warn("SOCIETE_API_TOKEN absent : utilisation du token de développement (DEV_MODE=1)")
+	}
+
+	if getenv("API_KEY") == "" {
+		if getenv("DEV_MODE") != "1" {
+			slog.Error("API_KEY manquant : définissez la clé partagée protégeant les routes /api (ou DEV_MODE=1 en local)")
+			os.Exit(1)
+		}
+		slog.Warn("API_KEY absent : routes /api accessibles sans authentification (DEV_MODE=1)")
+	}
+
+	// Journal des envois persistant si DB_PATH est défini (mémoire sinon)
+	if dbPath := getenv("DB_PATH"); dbPath != "" {
+		store, err := openSQLiteEmailLog(dbPath)
+		if err != nil {
+			slog.Error("ouverture de la base du journal des envois impossible", "path", dbPath, "error", err)
+			os.Exit(1)
+		}
+		defer store.Close()
+		sentEmails = store
+		slog.Info("journal des envois persisté dans SQLite", "path", dbPath)
+	}
 
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatalf("Erreur au démarrage: %v", err)
+	// HTTPS direct (sans reverse proxy) si certificat et clé sont fournis
+	tlsCertFile := getenv("TLS_CERT_FILE")
+	tlsKeyFile := getenv("TLS_KEY_FILE")
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		slog.Error("TLS_CERT_FILE et TLS_KEY_FILE doivent être définis ensemble")
+		os.Exit(1)
 	}
-}
\ No newline at end of file
+	useTLS := tlsCertFile != ""
+
+	handler := newHandler()
+
+	slog.Info("serveur démarré", "addr", addr, "tls", useTLS, "routes", []string{
+		"GET /api/entreprise/{siren}",
+		"GET /api/entreprise?id={siren}&fields=address,tva",
+		"GET /api/entreprise/{siren}/tva",
+		"GET /api/entreprise/search?q={nom}&page=1&per_page=20",
+		"POST /api/entreprise/batch?format=csv",
+		"POST /api/send-email",
+		"GET /api/emails?status=failed&limit=50",
+		"GET /api/config",
+		"GET /api/emails/{job_id}",
+		"POST /api/emails/{id}/resend",
+		"POST /api/email/preview",
+		"GET /api/email/validate?address={email}&check_mx=true",
+	})
+
+	srv := newServer(addr, handler)
+
+	// Arrêt propre sur SIGINT/SIGTERM (docker stop) : les envois en cours
+	// ont SHUTDOWN_TIMEOUT pour se terminer
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		var err error
+		if useTLS {
+			err = srv.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("erreur au démarrage", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	shutdownTimeout := envDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	slog.Info("signal d'arrêt reçu, fin des requêtes en cours", "timeout", shutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("arrêt forcé", "error", err)
+		return
+	}
+	// Les emails déjà en file sont envoyés dans le même délai
+	if err := emailQueue.shutdown(shutdownCtx); err != nil {
+		slog.Error("envois en file abandonnés", "error", err)
+		return
+	}
+	slog.Info("serveur arrêté proprement")
+}
@@ -0,0 +1,733 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// serve exécute handler sur une requête de test et retourne la réponse
+func serve(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// newTestHandler construit la chaîne complète (newHandler) sans clé API et
+// avec un limiteur de débit neuf, pour que les tests ne s'épuisent pas
+// mutuellement le quota des routes d'envoi
+func newTestHandler(t *testing.T) http.Handler {
+	t.Helper()
+	t.Setenv("API_KEY", "")
+	previous := emailRateLimiter
+	emailRateLimiter = newIPRateLimiter(rate.Inf, 1)
+	t.Cleanup(func() { emailRateLimiter = previous })
+	return newHandler()
+}
+
+// decodeAPIError lit une réponse d'erreur JSON ({code, error, details})
+func decodeAPIError(t *testing.T, w *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	var apiErr APIError
+	if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil {
+		t.Fatalf("réponse d'erreur illisible %q : %v", w.Body.String(), err)
+	}
+	return apiErr
+}
+
+func TestValidateLuhn(t *testing.T) {
+	tests := []struct {
+		numid string
+		want  bool
+	}{
+		{"552032534", true},       // SIREN valide
+		{"55203253400646", true},  // SIRET valide
+		{"552032535", false},      // clé incorrecte
+		{"123456789", false},      // clé incorrecte
+		{"35600000000048", true},  // La Poste, clé de Luhn respectée
+		{"35600000049837", true},  // La Poste, somme des chiffres multiple de 5
+		{"35600000049838", false}, // La Poste, aucune des deux règles
+		{"356000000", true},       // SIREN de La Poste (règle normale)
+		{"55203253", false},       // longueur invalide
+		{"5520325340", false},     // longueur invalide
+		{"55203253A", false},      // caractère non numérique
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validateLuhn(tt.numid); got != tt.want {
+			t.Errorf("validateLuhn(%q) = %v, attendu %v", tt.numid, got, tt.want)
+		}
+	}
+}
+
+func TestValidateLuhnLaPosteExceptionOnlyForLaPoste(t *testing.T) {
+	// Même somme des chiffres multiple de 5 qu'un SIRET de La Poste accepté,
+	// mais hors SIREN 356000000 : la clé de Luhn reste exigée
+	numid := "55203253400655"
+	if validateLuhn(numid) {
+		t.Errorf("validateLuhn(%q) = true, l'exception La Poste ne doit pas s'appliquer", numid)
+	}
+}
+
+// emailJSON encode une requête d'envoi
+func emailJSON(t *testing.T, req map[string]any) string {
+	t.Helper()
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	return string(data)
+}
+
+// attachmentRequest : envoi en dry_run avec une pièce jointe de size octets
+func attachmentRequest(t *testing.T, size int) string {
+	return emailJSON(t, map[string]any{
+		"to":              "client@exemple.fr",
+		"subject":         "Devis",
+		"body":            "Bonjour",
+		"attachment_name": "devis.pdf",
+		"attachment_data": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), size)),
+		"dry_run":         true,
+	})
+}
+
+func TestSendEmailAttachmentSizeBoundary(t *testing.T) {
+	t.Setenv("MAX_ATTACHMENT_BYTES", "1000")
+
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", attachmentRequest(t, 1000)); w.Code != http.StatusOK {
+		t.Errorf("pièce jointe de 1000 octets : statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", attachmentRequest(t, 1001))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("pièce jointe de 1001 octets : statut = %d, attendu 413", w.Code)
+	}
+	if code := decodeAPIError(t, w).Code; code != "ATTACHMENT_TOO_LARGE" {
+		t.Errorf("code = %q, attendu ATTACHMENT_TOO_LARGE", code)
+	}
+}
+
+func TestSendEmailAttachmentSizeCheckedBeforeDecoding(t *testing.T) {
+	t.Setenv("MAX_ATTACHMENT_BYTES", "1000")
+	t.Setenv("MAX_TOTAL_ATTACHMENT_BYTES", "1500")
+
+	// Contenu Base64 invalide mais trop volumineux : 413 avant toute tentative
+	// de décodage (un 400 INVALID_ATTACHMENT prouverait qu'il a été décodé)
+	invalid := strings.Repeat("!", 2000)
+	tests := []struct {
+		name string
+		req  map[string]any
+		code string
+	}{
+		{"pièce jointe", map[string]any{"attachment_name": "devis.pdf", "attachment_data": invalid}, "ATTACHMENT_TOO_LARGE"},
+		{"image intégrée", map[string]any{"body_html": `<img src="cid:logo">`, "inline_images": []any{map[string]any{"cid": "logo", "name": "logo.png", "data": invalid}}}, "ATTACHMENT_TOO_LARGE"},
+		{"total", map[string]any{"attachments": []any{
+			map[string]any{"name": "a.pdf", "data": invalid[:1200]},
+			map[string]any{"name": "b.pdf", "data": invalid[:1200]},
+		}}, "ATTACHMENTS_TOO_LARGE"},
+	}
+	for _, tt := range tests {
+		req := map[string]any{"to": "client@exemple.fr", "subject": "Devis", "body": "Bonjour", "dry_run": true}
+		for k, v := range tt.req {
+			req[k] = v
+		}
+		w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", emailJSON(t, req))
+		if w.Code != http.StatusRequestEntityTooLarge || decodeAPIError(t, w).Code != tt.code {
+			t.Errorf("%s : statut = %d (%s), attendu 413 %s", tt.name, w.Code, w.Body, tt.code)
+		}
+	}
+}
+
+// attachmentsRequest : envoi en dry_run avec n pièces jointes et images
+// intégrées de size octets chacune
+func attachmentsRequest(t *testing.T, attachments, images, size int) string {
+	data := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), size))
+	files := make([]map[string]string, attachments)
+	for i := range files {
+		files[i] = map[string]string{"name": fmt.Sprintf("devis-%d.pdf", i), "data": data}
+	}
+	inline := make([]map[string]string, images)
+	html := "<p>Bonjour</p>"
+	for i := range inline {
+		cid := fmt.Sprintf("image%d", i)
+		inline[i] = map[string]string{"cid": cid, "name": cid + ".png", "data": data}
+		html += `<img src="cid:` + cid + `">`
+	}
+	return emailJSON(t, map[string]any{
+		"to":            "client@exemple.fr",
+		"subject":       "Devis",
+		"body":          "Bonjour",
+		"body_html":     html,
+		"attachments":   files,
+		"inline_images": inline,
+		"dry_run":       true,
+	})
+}
+
+func TestSendEmailAttachmentCountLimit(t *testing.T) {
+	t.Setenv("MAX_ATTACHMENTS", "3")
+
+	// Images intégrées comprises dans le décompte
+	for _, n := range [][2]int{{3, 0}, {2, 1}} {
+		if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", attachmentsRequest(t, n[0], n[1], 10)); w.Code != http.StatusOK {
+			t.Errorf("%d pièces jointes + %d images : statut = %d (%s), attendu 200", n[0], n[1], w.Code, w.Body)
+		}
+	}
+	for _, n := range [][2]int{{4, 0}, {2, 2}} {
+		w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", attachmentsRequest(t, n[0], n[1], 10))
+		if w.Code != http.StatusRequestEntityTooLarge || decodeAPIError(t, w).Code != "TOO_MANY_ATTACHMENTS" {
+			t.Errorf("%d pièces jointes + %d images : statut = %d (%s), attendu 413 TOO_MANY_ATTACHMENTS", n[0], n[1], w.Code, w.Body)
+		}
+	}
+}
+
+func TestSendEmailTotalAttachmentSizeLimit(t *testing.T) {
+	t.Setenv("MAX_ATTACHMENT_BYTES", "1000")
+	t.Setenv("MAX_TOTAL_ATTACHMENT_BYTES", "1500")
+
+	// Chaque fichier respecte MAX_ATTACHMENT_BYTES, seul le total compte
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", attachmentsRequest(t, 2, 1, 500)); w.Code != http.StatusOK {
+		t.Errorf("total de 1500 octets : statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	for _, n := range [][2]int{{2, 1}, {1, 2}} {
+		w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", attachmentsRequest(t, n[0], n[1], 501))
+		if w.Code != http.StatusRequestEntityTooLarge || decodeAPIError(t, w).Code != "ATTACHMENTS_TOO_LARGE" {
+			t.Errorf("%d pièces jointes + %d images de 501 octets : statut = %d (%s), attendu 413 ATTACHMENTS_TOO_LARGE", n[0], n[1], w.Code, w.Body)
+		}
+	}
+}
+
+func TestSendEmailBodyLimit(t *testing.T) {
+	t.Setenv("MAX_ATTACHMENT_BYTES", "1000")
+	t.Setenv("MAX_TOTAL_ATTACHMENT_BYTES", "1000")
+	handler := bodyLimitMiddleware(http.HandlerFunc(sendEmailHandler))
+	body := attachmentRequest(t, 2<<20)
+
+	// Content-Length connu : refus avant lecture
+	r := httptest.NewRequest(http.MethodPost, "/api/send-email", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge || decodeAPIError(t, w).Code != "REQUEST_TOO_LARGE" {
+		t.Errorf("Content-Length trop grand : statut = %d (%s), attendu 413 REQUEST_TOO_LARGE", w.Code, w.Body)
+	}
+
+	// Corps envoyé par morceaux : la lecture s'interrompt à la limite
+	r = httptest.NewRequest(http.MethodPost, "/api/send-email", io.NopCloser(strings.NewReader(body)))
+	r.ContentLength = -1
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge || decodeAPIError(t, w).Code != "REQUEST_TOO_LARGE" {
+		t.Errorf("corps sans Content-Length : statut = %d (%s), attendu 413 REQUEST_TOO_LARGE", w.Code, w.Body)
+	}
+}
+
+func TestSendEmailInvalidBase64(t *testing.T) {
+	body := emailJSON(t, map[string]any{
+		"to":              "client@exemple.fr",
+		"subject":         "Devis",
+		"body":            "Bonjour",
+		"attachment_name": "devis.pdf",
+		"attachment_data": "pas du base64 !",
+		"dry_run":         true,
+	})
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body)
+	if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != "INVALID_ATTACHMENT" {
+		t.Errorf("statut = %d (%s), attendu 400 INVALID_ATTACHMENT", w.Code, w.Body)
+	}
+}
+
+func TestAPIErrorShape(t *testing.T) {
+	for _, key := range []string{"SMTP_HOST", "SMTP_PORT", "SMTP_ADMIN_EMAIL", "SMTP_PASS"} {
+		t.Setenv(key, "")
+	}
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		method      string
+		target      string
+		body        string
+		wantStatus  int
+		wantCode    string
+		wantDetails bool
+	}{
+		{"SIREN invalide", entrepriseHandler, http.MethodGet, "/api/entreprise/123", "", http.StatusBadRequest, "INVALID_SIREN", false},
+		{"JSON invalide", sendEmailHandler, http.MethodPost, "/api/send-email", "{", http.StatusBadRequest, "INVALID_JSON", false},
+		{"champs manquants", sendEmailHandler, http.MethodPost, "/api/send-email", "{}", http.StatusBadRequest, "VALIDATION_FAILED", true},
+		{"champ inconnu", sendEmailHandler, http.MethodPost, "/api/send-email", `{"sujet":"x"}`, http.StatusBadRequest, "UNKNOWN_FIELD", true},
+		{"configuration SMTP absente", sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`, http.StatusInternalServerError, "SMTP_CONFIG_MISSING", false},
+	}
+	for _, tt := range tests {
+		w := serve(tt.handler, tt.method, tt.target, tt.body)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s : statut = %d, attendu %d", tt.name, w.Code, tt.wantStatus)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s : Content-Type = %q, attendu application/json", tt.name, ct)
+		}
+
+		var raw map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+			t.Fatalf("%s : corps illisible %q : %v", tt.name, w.Body, err)
+		}
+		if code, _ := raw["code"].(string); code != tt.wantCode {
+			t.Errorf("%s : code = %v, attendu %s", tt.name, raw["code"], tt.wantCode)
+		}
+		if msg, _ := raw["error"].(string); msg == "" {
+			t.Errorf("%s : message 'error' absent : %v", tt.name, raw)
+		}
+		if _, ok := raw["details"]; ok != tt.wantDetails {
+			t.Errorf("%s : présence de 'details' = %v, attendu %v", tt.name, ok, tt.wantDetails)
+		}
+		if len(raw) > 3 {
+			t.Errorf("%s : clés inattendues dans %v", tt.name, raw)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	handler := newTestHandler(t)
+
+	tests := []struct {
+		target string
+		allow  string
+	}{
+		{"/api/entreprise/552032534", "GET, OPTIONS"},
+		{"/api/entreprise?id=552032534", "GET, OPTIONS"},
+		{"/api/entreprise/search?q=danone", "GET, OPTIONS"},
+		{"/api/entreprise/batch", "POST, OPTIONS"},
+		{"/api/send-email", "POST, OPTIONS"},
+		{"/api/emails", "GET, OPTIONS"},
+		{"/api/email/validate?address=a@exemple.fr", "GET, OPTIONS"},
+		{"/api/config", "GET, OPTIONS"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, tt.target, nil))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("DELETE %s : statut = %d, attendu 405", tt.target, w.Code)
+			continue
+		}
+		if got := w.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("DELETE %s : Allow = %q, attendu %q", tt.target, got, tt.allow)
+		}
+		if code := decodeAPIError(t, w).Code; code != "METHOD_NOT_ALLOWED" {
+			t.Errorf("DELETE %s : code = %q, attendu METHOD_NOT_ALLOWED", tt.target, code)
+		}
+	}
+}
+
+// decodeEntreprise lit une réponse EntrepriseResponse JSON
+func decodeEntreprise(t *testing.T, w *httptest.ResponseRecorder) EntrepriseResponse {
+	t.Helper()
+	var data EntrepriseResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil {
+		t.Fatalf("réponse illisible %q : %v", w.Body.String(), err)
+	}
+	return data
+}
+
+func TestEntrepriseQueryForm(t *testing.T) {
+	tests := []struct {
+		target      string
+		wantFields  entrepriseFields
+		wantTva     bool
+		wantAddress bool
+	}{
+		{"/api/entreprise?id=552032534", allEntrepriseFields, true, true},
+		{"/api/entreprise?id=552032534&fields=tva", entrepriseFields{Tva: true}, true, false},
+		{"/api/entreprise?id=552032534&fields=address", entrepriseFields{Address: true}, false, true},
+		{"/api/entreprise?id=552032534&fields=address,+tva", allEntrepriseFields, true, true},
+		{"/api/entreprise/552032534?fields=tva", entrepriseFields{Tva: true}, true, false}, // forme chemin
+	}
+	for _, tt := range tests {
+		p := useStubProvider(t, danone)
+		w := serve(entrepriseHandler, http.MethodGet, tt.target, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("%s : statut = %d (%s), attendu 200", tt.target, w.Code, w.Body)
+			continue
+		}
+		data := decodeEntreprise(t, w)
+		if data.Siren != "552032534" || (data.Tva != "") != tt.wantTva || (data.AdressePostaleLegale != nil) != tt.wantAddress {
+			t.Errorf("%s : réponse = %+v, attendu tva = %v, adresse = %v", tt.target, data, tt.wantTva, tt.wantAddress)
+		}
+		if calls := p.lookups(); len(calls) != 1 || calls[0] != (stubLookup{"552032534", tt.wantFields}) {
+			t.Errorf("%s : appels au fournisseur = %+v, attendu champs %+v", tt.target, calls, tt.wantFields)
+		}
+	}
+}
+
+func TestEntrepriseQueryFormErrors(t *testing.T) {
+	useStubProvider(t, danone)
+	tests := []struct {
+		target string
+		code   string
+	}{
+		{"/api/entreprise", "INVALID_SIREN"},
+		{"/api/entreprise?id=552032535", "INVALID_SIREN"},
+		{"/api/entreprise?id=552032534&fields=adresse", "INVALID_FIELDS"},
+	}
+	for _, tt := range tests {
+		w := serve(entrepriseHandler, http.MethodGet, tt.target, "")
+		if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != tt.code {
+			t.Errorf("%s : statut = %d (%s), attendu 400 %s", tt.target, w.Code, w.Body, tt.code)
+		}
+	}
+}
+
+func TestComputeTVA(t *testing.T) {
+	tests := []struct {
+		siren, want string
+	}{
+		{"552032534", "FR27552032534"}, // DANONE
+		{"356000000", "FR39356000000"}, // La Poste
+	}
+	for _, tt := range tests {
+		if got, err := computeTVA(tt.siren); err != nil || got != tt.want {
+			t.Errorf("computeTVA(%q) = %q, %v, attendu %q", tt.siren, got, err, tt.want)
+		}
+	}
+	for _, siren := range []string{"552032535", "55203253400646", "", "abc"} {
+		if _, err := computeTVA(siren); err == nil {
+			t.Errorf("computeTVA(%q) : erreur attendue", siren)
+		}
+	}
+}
+
+func TestValidateTVA(t *testing.T) {
+	tests := []struct {
+		siren, tva string
+		want       bool
+	}{
+		{"552032534", "FR27552032534", true},
+		{"552032534", "fr 27 552 032 534", true}, // espaces et casse tolérés
+		{"552032534", "FR28552032534", false},    // mauvaise clé
+		{"552032534", "FR39356000000", false},    // autre entreprise
+		{"552032534", "", false},
+		{"552032535", "FR27552032535", false}, // SIREN invalide
+	}
+	for _, tt := range tests {
+		if got := validateTVA(tt.siren, tt.tva); got != tt.want {
+			t.Errorf("validateTVA(%q, %q) = %v, attendu %v", tt.siren, tt.tva, got, tt.want)
+		}
+	}
+}
+
+func TestEntrepriseValidateTVAParam(t *testing.T) {
+	for tva, want := range map[string]bool{"FR27552032534": true, "FR00552032534": false} {
+		useStubProvider(t, func(context.Context, string, entrepriseFields) (*EntrepriseResponse, error) {
+			return &EntrepriseResponse{Denomination: "DANONE", Siren: "552032534", Tva: tva}, nil
+		})
+
+		data := decodeEntreprise(t, serve(entrepriseHandler, http.MethodGet, "/api/entreprise/552032534?validate_tva=true", ""))
+		if data.TvaValide == nil || *data.TvaValide != want {
+			t.Errorf("tva %s : tva_valide = %v, attendu %v", tva, data.TvaValide, want)
+		}
+
+		// Sans le paramètre, le champ est omis
+		if data := decodeEntreprise(t, serve(entrepriseHandler, http.MethodGet, "/api/entreprise/552032534", "")); data.TvaValide != nil {
+			t.Errorf("sans validate_tva : tva_valide = %v, attendu absent", *data.TvaValide)
+		}
+	}
+}
+
+func TestSendEmailDryRunMakesNoSMTPConnection(t *testing.T) {
+	s := useFakeSMTP(t)
+
+	tests := []struct {
+		target, body string
+	}{
+		{"/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour","dry_run":true}`},
+		{"/api/send-email?dry_run=1", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`},
+	}
+	for _, tt := range tests {
+		w := serve(sendEmailHandler, http.MethodPost, tt.target, tt.body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s : statut = %d (%s), attendu 200", tt.target, w.Code, w.Body)
+		}
+		var resp EmailDryRunResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if !resp.DryRun || resp.Size == 0 || len(resp.Headers["Message-Id"]) != 1 || resp.Headers["To"][0] != "<client@exemple.fr>" {
+			t.Errorf("%s : réponse = %+v", tt.target, resp)
+		}
+	}
+	if n := s.connCount(); n != 0 {
+		t.Errorf("%d connexions SMTP en dry_run, attendu 0", n)
+	}
+}
+
+func TestSendEmailRejectsHeaderInjection(t *testing.T) {
+	body := emailJSON(t, map[string]any{
+		"to":      "client@exemple.fr",
+		"subject": "Devis",
+		"body":    "Bonjour",
+		"headers": map[string]string{"X-Campaign-ID": "42\r\nBcc: victime@exemple.fr"},
+		"dry_run": true,
+	})
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body)
+	if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != "INVALID_HEADER" {
+		t.Errorf("statut = %d (%s), attendu 400 INVALID_HEADER", w.Code, w.Body)
+	}
+}
+
+// useBuildInfo simule des métadonnées injectées via -ldflags
+func useBuildInfo(t *testing.T, version, commit, buildDate string) {
+	t.Helper()
+	v, c, d := Version, Commit, BuildDate
+	Version, Commit, BuildDate = version, commit, buildDate
+	t.Cleanup(func() { Version, Commit, BuildDate = v, c, d })
+}
+
+func TestInfoBuildMetadata(t *testing.T) {
+	tests := []struct {
+		name                    string
+		version, commit, date   string
+		wantVersion, wantCommit string
+		wantDate                string
+	}{
+		{"injectées", "1.4.2", "abc1234", "2026-01-15T10:00:00Z", "1.4.2", "abc1234", "2026-01-15T10:00:00Z"},
+		{"absentes", "", "", "", "dev", "dev", "dev"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useBuildInfo(t, tt.version, tt.commit, tt.date)
+
+			w := serve(infoHandler, http.MethodGet, "/info", "")
+			var resp struct {
+				Status string         `json:"status"`
+				Data   map[string]any `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("réponse illisible: %v", err)
+			}
+			want := map[string]string{"version": tt.wantVersion, "commit": tt.wantCommit, "build_date": tt.wantDate}
+			for key, value := range want {
+				if got, ok := resp.Data[key]; !ok || got != value {
+					t.Errorf("data.%s = %v, attendu %q", key, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	useBuildInfo(t, "1.4.2", "abc1234", "2026-01-15T10:00:00Z")
+	handler := newTestHandler(t)
+
+	// Route publique, hors clé API
+	t.Setenv("API_KEY", "cle-secrete")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("statut = %d, Content-Type = %q, attendu du JSON", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	var fields map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&fields); err != nil {
+		t.Fatalf("réponse illisible: %v", err)
+	}
+	want := map[string]string{
+		"version":    "1.4.2",
+		"commit":     "abc1234",
+		"build_date": "2026-01-15T10:00:00Z",
+		"go_version": runtime.Version(),
+	}
+	if len(fields) != len(want) {
+		t.Errorf("champs = %v, attendu %v", fields, want)
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s = %q, attendu %q", key, fields[key], value)
+		}
+	}
+
+	// Métadonnées absentes (go run) : "dev"
+	useBuildInfo(t, "", "", "")
+	var resp VersionResponse
+	json.NewDecoder(serve(versionHandler, http.MethodGet, "/version", "").Body).Decode(&resp)
+	if resp.Version != "dev" || resp.Commit != "dev" || resp.BuildDate != "dev" || resp.GoVersion == "" {
+		t.Errorf("sans -ldflags : %+v, attendu dev", resp)
+	}
+}
+
+func TestNormalizeNumid(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"552032534", "552032534"},
+		{"552 032 534", "552032534"},
+		{"552\u00a0032\u00a0534", "552032534"}, // espaces insécables copiés depuis le web
+		{" 552.032.534 ", "552032534"},
+		{"552-032-534", "552032534"},
+		{"552 032 534 00646", "55203253400646"},
+		{"\t552032534\n", "552032534"},
+	}
+	for _, tt := range tests {
+		if got, err := normalizeNumid(tt.raw); err != nil || got != tt.want {
+			t.Errorf("normalizeNumid(%q) = %q, %v, attendu %q", tt.raw, got, err, tt.want)
+		}
+	}
+
+	for raw, want := range map[string]string{
+		"552O32534":   "lettre 'O'",
+		"FR552032534": "lettre 'F'",
+		"552_032_534": "caractère '_'",
+		"552+032534":  "caractère '+'",
+	} {
+		_, err := normalizeNumid(raw)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("normalizeNumid(%q) : err = %v, attendu une mention de %s", raw, err, want)
+		}
+	}
+}
+
+func TestEntrepriseSpacedInput(t *testing.T) {
+	for _, id := range []string{"552+032+534", "552.032.534", "552%C2%A0032%C2%A0534", "552-032-534-00646"} {
+		useStubProvider(t, danone)
+		w := serve(entrepriseHandler, http.MethodGet, "/api/entreprise?id="+id, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("id=%s : statut = %d (%s), attendu 200", id, w.Code, w.Body)
+			continue
+		}
+		if got := decodeEntreprise(t, w).Siren; got != "552032534" {
+			t.Errorf("id=%s : siren = %q", id, got)
+		}
+	}
+
+	useStubProvider(t, danone)
+	w := serve(entrepriseHandler, http.MethodGet, "/api/entreprise?id=552O32534", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("lettre : statut = %d, attendu 400", w.Code)
+	}
+	if e := decodeAPIError(t, w); e.Code != "INVALID_SIREN" || !strings.Contains(e.Message, "lettre") {
+		t.Errorf("lettre : erreur = %+v, attendu INVALID_SIREN mentionnant la lettre", e)
+	}
+}
+
+func TestFormatTVA(t *testing.T) {
+	tests := map[string]string{
+		"FR27552032534":     "FR 27 552032534",
+		"fr 27 552 032 534": "FR 27 552032534",
+		"DE123456789":       "DE123456789", // autre pays : inchangé
+		"":                  "",
+	}
+	for tva, want := range tests {
+		if got := formatTVA(tva); got != want {
+			t.Errorf("formatTVA(%q) = %q, attendu %q", tva, got, want)
+		}
+	}
+}
+
+func TestEntrepriseTVAHandler(t *testing.T) {
+	decode := func(w *httptest.ResponseRecorder) TVAResponse {
+		t.Helper()
+		var resp TVAResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("réponse illisible: %v", err)
+		}
+		return resp
+	}
+
+	useStubProvider(t, danone)
+	w := serve(entrepriseHandler, http.MethodGet, "/api/entreprise/552032534/tva", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	if resp := decode(w); resp != (TVAResponse{Siren: "552032534", Tva: "FR27552032534", TvaFormatee: "FR 27 552032534"}) {
+		t.Errorf("réponse = %+v", resp)
+	}
+
+	// Numéro absent ou incohérent chez le fournisseur : calculé depuis le SIREN
+	useStubProvider(t, func(context.Context, string, entrepriseFields) (*EntrepriseResponse, error) {
+		return &EntrepriseResponse{Siren: "356000000", Tva: "FR00356000000"}, nil
+	})
+	w = serve(entrepriseHandler, http.MethodGet, "/api/entreprise/356000000/tva", "")
+	if resp := decode(w); resp.TvaFormatee != "FR 39 356000000" {
+		t.Errorf("TVA incohérente : réponse = %+v, attendu FR 39 356000000", resp)
+	}
+
+	tests := []struct {
+		target string
+		status int
+		code   string
+	}{
+		{"/api/entreprise/356000000/tva", http.StatusNotFound, "COMPANY_NOT_FOUND"},
+		{"/api/entreprise/55203253400646/tva", http.StatusBadRequest, "INVALID_SIREN"},
+		{"/api/entreprise/552032535/tva", http.StatusBadRequest, "INVALID_SIREN"},
+	}
+	useStubProvider(t, danone)
+	for _, tt := range tests {
+		w := serve(entrepriseHandler, http.MethodGet, tt.target, "")
+		if w.Code != tt.status || decodeAPIError(t, w).Code != tt.code {
+			t.Errorf("%s : statut = %d (%s), attendu %d %s", tt.target, w.Code, w.Body, tt.status, tt.code)
+		}
+	}
+}
+
+func TestParseNumidKinds(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		kind    numidKind
+		want    string
+		wantErr string
+	}{
+		{"SIREN accepté", "552 032 534", numidSiren, "552032534", ""},
+		{"SIRET refusé là où un SIREN est attendu", "55203253400646", numidSiren, "", "SIREN attendu (9 chiffres), 14 chiffres reçus"},
+		{"SIRET accepté", "552 032 534 00646", numidSiret, "55203253400646", ""},
+		{"SIREN refusé là où un SIRET est attendu", "552032534", numidSiret, "", "SIRET attendu (14 chiffres), 9 chiffres reçus"},
+		{"SIREN ou SIRET : SIREN", "552032534", numidAny, "552032534", ""},
+		{"SIREN ou SIRET : SIRET", "55203253400646", numidAny, "55203253400646", ""},
+		{"SIREN ou SIRET : longueur invalide", "5520325", numidAny, "", "SIREN (9 chiffres) ou un SIRET (14 chiffres)"},
+		{"clé de contrôle", "552032535", numidSiren, "", "clé de contrôle"},
+	}
+	for _, tt := range tests {
+		got, err := parseNumid(tt.raw, tt.kind)
+		if tt.wantErr == "" {
+			if err != nil || got != tt.want {
+				t.Errorf("%s : parseNumid(%q) = %q, %v, attendu %q", tt.name, tt.raw, got, err, tt.want)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s : parseNumid(%q) : err = %v, attendu %q", tt.name, tt.raw, err, tt.wantErr)
+		}
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	tests := []struct {
+		bind, port string
+		want       string
+	}{
+		{"", "", ":8091"},
+		{"", "9000", ":9000"},
+		{"127.0.0.1", "", "127.0.0.1:8091"},
+		{"127.0.0.1", "9000", "127.0.0.1:9000"},
+		{"::1", "9000", "[::1]:9000"},
+	}
+	for _, tt := range tests {
+		t.Setenv("BIND_ADDR", tt.bind)
+		t.Setenv("PORT", tt.port)
+		if got := listenAddr(); got != tt.want {
+			t.Errorf("BIND_ADDR=%q PORT=%q : listenAddr() = %q, attendu %q", tt.bind, tt.port, got, tt.want)
+		}
+	}
+}
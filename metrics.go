@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// --- MÉTRIQUES PROMETHEUS (/metrics) ---
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "info_go_http_requests_total",
+		Help: "Nombre de requêtes HTTP par route, méthode et statut.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "info_go_http_request_duration_seconds",
+		Help:    "Durée de traitement des requêtes HTTP par route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
+	emailsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "info_go_emails_total",
+		Help: "Nombre d'emails traités par statut (sent, failed).",
+	}, []string{"status"})
+
+	_ = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "info_go_company_cache_hits_total",
+		Help: "Nombre de recherches entreprise servies depuis le cache.",
+	}, func() float64 { return float64(entrepriseCache.hits.Load()) })
+
+	_ = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "info_go_company_cache_misses_total",
+		Help: "Nombre de recherches entreprise transmises à l'API distante.",
+	}, func() float64 { return float64(entrepriseCache.misses.Load()) })
+)
+
+// metricsMiddleware compte les requêtes et mesure leur durée, par route
+// déclarée (r.Pattern, sans le SIREN), renseignée par le ServeMux après
+// traitement. Les middlewares placés entre les deux doivent donc transmettre
+// la même *http.Request (sans WithContext ni Clone), sinon la route est
+// "inconnue".
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "inconnue"
+		}
+		httpRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpRequestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
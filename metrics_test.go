@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	s := useFakeSMTP(t)
+	s.reject("inconnu@exemple.fr")
+	handler := newTestHandler(t)
+
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	request(http.MethodGet, "/health", "")
+	// Envoi refusé par le serveur SMTP : compté dans info_go_emails_total
+	if w := request(http.MethodPost, "/api/send-email", `{"to":"inconnu@exemple.fr","subject":"Devis","body":"Bonjour"}`); w.Code < 400 {
+		t.Fatalf("envoi vers un destinataire refusé : statut = %d, attendu une erreur", w.Code)
+	}
+
+	w := request(http.MethodGet, "/metrics", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /metrics : statut = %d", w.Code)
+	}
+	metrics := w.Body.String()
+	for _, name := range []string{
+		"info_go_http_requests_total",
+		"info_go_http_request_duration_seconds_bucket",
+		"info_go_emails_total",
+		"info_go_company_cache_hits_total",
+		"info_go_company_cache_misses_total",
+	} {
+		if !strings.Contains(metrics, "\n"+name) {
+			t.Errorf("métrique %s absente de /metrics", name)
+		}
+	}
+
+	// Route déclarée (r.Pattern) transmise à travers toute la chaîne
+	for _, series := range []string{
+		`info_go_http_requests_total{method="GET",route="/health",status="200"}`,
+		`info_go_emails_total{status="failed"}`,
+	} {
+		if !strings.Contains(metrics, series) {
+			t.Errorf("série %s absente de /metrics", series)
+		}
+	}
+	// Seules les requêtes refusées avant le ServeMux (413 de bodyLimitMiddleware,
+	// par exemple) peuvent être sans route : une réponse 200 en a toujours une
+	if strings.Contains(metrics, `route="inconnue",status="200"`) {
+		t.Error("route \"inconnue\" : r.Pattern perdu entre metricsMiddleware et le ServeMux")
+	}
+}
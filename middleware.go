@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// --- MIDDLEWARES ---
+
+// Origines autorisées si CORS_ALLOWED_ORIGINS n'est pas défini
+var defaultAllowedOrigins = []string{
+	"http://localhost:8082",
+	"https://vintagestandards.fr",
+	"https://dev.vintagestandards.fr",
+}
+
+// Origines autorisées (normalisées), lues une fois au démarrage
+var corsAllowedOrigins = loadAllowedOrigins()
+
+// Méthodes et en-têtes autorisés (CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS)
+var (
+	corsAllowedMethods = envList("CORS_ALLOWED_METHODS", "GET, POST, OPTIONS")
+	corsAllowedHeaders = envList("CORS_ALLOWED_HEADERS", "Content-Type, Authorization, X-API-Key, X-Request-ID, Idempotency-Key")
+)
+
+// Durée pendant laquelle le navigateur peut réutiliser une réponse preflight
+var corsMaxAge = loadCORSMaxAge()
+
+// loadCORSMaxAge lit CORS_MAX_AGE en secondes ("600", comme l'en-tête
+// Access-Control-Max-Age) ou en durée Go ("10m")
+func loadCORSMaxAge() time.Duration {
+	if seconds, err := strconv.Atoi(getenv("CORS_MAX_AGE")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return envDuration("CORS_MAX_AGE", 10*time.Minute)
+}
+
+// allowedOrigins regroupe les origines exactes et les motifs de
+// sous-domaine ("https://*.vintagestandards.fr")
+type allowedOrigins struct {
+	exact     map[string]bool
+	wildcards []wildcardOrigin
+}
+
+// wildcardOrigin : "https://*.exemple.fr" -> scheme "https://", suffix ".exemple.fr"
+type wildcardOrigin struct {
+	scheme string
+	suffix string
+}
+
+// loadAllowedOrigins lit la liste séparée par des virgules
+// CORS_ALLOWED_ORIGINS, ou la liste par défaut si absente
+func loadAllowedOrigins() allowedOrigins {
+	origins := defaultAllowedOrigins
+	if v := getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		origins = strings.Split(v, ",")
+	}
+
+	allowed := allowedOrigins{exact: make(map[string]bool)}
+	for _, o := range origins {
+		o = normalizeOrigin(o)
+		if o == "" {
+			continue
+		}
+		if scheme, rest, ok := strings.Cut(o, "://*."); ok {
+			allowed.wildcards = append(allowed.wildcards, wildcardOrigin{scheme: scheme + "://", suffix: "." + rest})
+			continue
+		}
+		allowed.exact[o] = true
+	}
+	return allowed
+}
+
+// list retourne les origines et motifs autorisés, triés
+func (a allowedOrigins) list() []string {
+	list := make([]string, 0, len(a.exact)+len(a.wildcards))
+	for o := range a.exact {
+		list = append(list, o)
+	}
+	for _, w := range a.wildcards {
+		list = append(list, w.scheme+"*"+w.suffix)
+	}
+	slices.Sort(list)
+	return list
+}
+
+// match vérifie une origine. Un motif "*." n'accepte qu'un seul niveau de
+// sous-domaine : ni le domaine nu, ni "evil-exemple.fr", ni "a.b.exemple.fr"
+func (a allowedOrigins) match(origin string) bool {
+	origin = normalizeOrigin(origin)
+	if a.exact[origin] {
+		return true
+	}
+	for _, w := range a.wildcards {
+		host, ok := strings.CutPrefix(origin, w.scheme)
+		if !ok {
+			continue
+		}
+		label, ok := strings.CutSuffix(host, w.suffix)
+		if ok && isDNSLabel(label) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDNSLabel vérifie qu'une chaîne est un label DNS unique (sans point)
+func isDNSLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, c := range label {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// envList lit une liste séparée par des virgules et la normalise
+// ("GET,POST" -> "GET, POST"), avec une valeur par défaut si absente
+func envList(key, def string) string {
+	v := getenv(key)
+	if v == "" {
+		return def
+	}
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return strings.Join(items, ", ")
+}
+
+// normalizeOrigin supprime espaces, casse et slash final
+// ("https://Dev.vintagestandards.fr/" -> "https://dev.vintagestandards.fr")
+func normalizeOrigin(origin string) string {
+	return strings.TrimRight(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
+
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && corsAllowedOrigins.match(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		w.Header().Add("Vary", "Origin")
+
+		w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Idempotent-Replayed")
+
+		if r.Method == "OPTIONS" {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// --- TAILLE DES REQUÊTES ---
+
+// Taille maximale du corps des requêtes (MAX_BODY_BYTES), hors envoi d'email
+var maxBodyBytes = int64(envInt("MAX_BODY_BYTES", 1<<20))
+
+// emailMaxBodyBytes : pièces jointes en Base64 (+33%) + marge pour le JSON
+func emailMaxBodyBytes() int64 {
+	return max(maxAttachmentBytes(), maxTotalAttachmentBytes())*4/3 + 1<<20
+}
+
+// bodyLimitFor retourne la taille de corps autorisée pour une route
+func bodyLimitFor(path string) int64 {
+	if path == "/api/send-email" || path == "/api/email/preview" || strings.HasPrefix(path, "/Send/") {
+		return emailMaxBodyBytes()
+	}
+	return maxBodyBytes
+}
+
+// bodyLimitMiddleware limite la taille du corps des requêtes : 413 (JSON)
+// immédiat si Content-Length dépasse la limite, sinon la lecture échoue avec
+// *http.MaxBytesError au-delà (à traiter par le handler)
+func bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := bodyLimitFor(r.URL.Path)
+		if r.ContentLength > limit {
+			loggerFromContext(r.Context()).Warn("requête trop volumineuse", "route", r.URL.Path, "content_length", r.ContentLength, "limit", limit)
+			w.Header().Set("Connection", "close")
+			writeError(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", fmt.Sprintf("Requête trop volumineuse (maximum %d octets)", limit))
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// --- IDENTIFIANT DE REQUÊTE ---
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	loggerKey
+	emailPreviewKey // POST /api/email/preview : message construit, jamais envoyé
+)
+
+// requestIDMiddleware attribue un identifiant à chaque requête (ou reprend
+// l'en-tête X-Request-ID du client s'il est valide), le renvoie dans la
+// réponse et l'attache au logger de la requête
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = context.WithValue(ctx, loggerKey, slog.Default().With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID accepte les identifiants courts et imprimables (pas
+// d'injection dans les logs ou les en-têtes)
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b) // ne retourne jamais d'erreur depuis Go 1.24
+	return hex.EncodeToString(b)
+}
+
+// loggerFromContext retourne le logger de la requête (avec son request_id),
+// ou le logger global hors requête
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// statusRecorder mémorise le code HTTP écrit par le handler et la taille du
+// corps de la réponse
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap donne accès au ResponseWriter d'origine (http.ResponseController)
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// requestLogMiddleware émet une ligne de log structurée par requête, une fois
+// le handler terminé (méthode, route, statut, taille de la réponse, IP
+// cliente, durée)
+func requestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		loggerFromContext(r.Context()).Info("requête traitée",
+			"method", r.Method,
+			"route", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"client_ip", clientIP(r),
+			"duration", time.Since(start),
+		)
+	})
+}
+
+// recoverMiddleware intercepte les panics des handlers : la pile est
+// journalisée avec l'identifiant de requête et le client reçoit une erreur
+// 500 JSON au lieu d'une connexion coupée
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// Abandon volontaire de la réponse : laissé à net/http
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			loggerFromContext(r.Context()).Error("panic dans le handler",
+				"route", r.URL.Path,
+				"panic", fmt.Sprint(p),
+				"stack", string(debug.Stack()),
+			)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Erreur interne du serveur")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authMiddleware exige la clé partagée API_KEY, transmise soit dans
+// "Authorization: Bearer <clé>", soit dans "X-API-Key". Sans API_KEY
+// configurée (DEV_MODE uniquement), les requêtes passent sans contrôle.
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey := getenv("API_KEY")
+		if apiKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		provided := r.Header.Get("X-API-Key")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			provided = strings.TrimSpace(bearer)
+		}
+
+		if provided == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) != 1 {
+			loggerFromContext(r.Context()).Warn("accès refusé (clé API absente ou invalide)", "method", r.Method, "route", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Clé API absente ou invalide")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Date de retrait annoncée des routes obsolètes (SEND_ALIAS_SUNSET, ex: 2027-06-30)
+var sendAliasSunset = envDate("SEND_ALIAS_SUNSET", time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC))
+
+// deprecatedRouteMiddleware signale une route obsolète (en-têtes Deprecation,
+// Sunset et Link vers la route de remplacement) sans la désactiver
+func deprecatedRouteMiddleware(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Sunset", sendAliasSunset.UTC().Format(http.TimeFormat))
+		w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+
+		loggerFromContext(r.Context()).Warn("route obsolète utilisée", "route", r.URL.Path, "successor", successor, "client_ip", clientIP(r))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// --- LIMITATION DE DÉBIT (par IP) ---
+
+// ipRateLimiter attribue un token bucket à chaque IP cliente
+type ipRateLimiter struct {
+	mu       sync.Mutex
+	visitors map[string]*visitor
+	limit    rate.Limit
+	burst    int
+}
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newIPRateLimiter(limit rate.Limit, burst int) *ipRateLimiter {
+	l := &ipRateLimiter{
+		visitors: make(map[string]*visitor),
+		limit:    limit,
+		burst:    burst,
+	}
+	go l.cleanup(10 * time.Minute)
+	return l
+}
+
+func (l *ipRateLimiter) get(ip string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	v, ok := l.visitors[ip]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.visitors[ip] = v
+	}
+	v.lastSeen = time.Now()
+	return v.limiter
+}
+
+// cleanup oublie périodiquement les IP inactives
+func (l *ipRateLimiter) cleanup(idle time.Duration) {
+	for range time.Tick(time.Minute) {
+		l.mu.Lock()
+		for ip, v := range l.visitors {
+			if time.Since(v.lastSeen) > idle {
+				delete(l.visitors, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Limiteur des routes d'envoi d'email (RATE_LIMIT_PER_MINUTE / RATE_LIMIT_BURST)
+var emailRateLimiter = newIPRateLimiter(
+	rate.Limit(float64(envInt("RATE_LIMIT_PER_MINUTE", 10))/60),
+	envInt("RATE_LIMIT_BURST", 5),
+)
+
+// rateLimitMiddleware répond 429 (avec Retry-After) quand l'IP cliente a
+// épuisé son quota
+func rateLimitMiddleware(limiter *ipRateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+
+		reservation := limiter.get(ip).Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+
+			loggerFromContext(r.Context()).Warn("limite de débit atteinte", "client_ip", ip, "method", r.Method, "route", r.URL.Path)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "RATE_LIMITED", "Trop de requêtes, réessayez plus tard")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Proxys de confiance (TRUSTED_PROXIES) : seules leurs requêtes peuvent
+// indiquer l'IP du client via X-Forwarded-For ou X-Real-IP
+var trustedProxies, trustedProxiesErr = loadTrustedProxies(getenv("TRUSTED_PROXIES"))
+
+// loadTrustedProxies lit une liste de plages CIDR séparées par des virgules
+// ("10.0.0.0/8, 172.16.0.0/12") ; une IP seule vaut pour elle-même
+func loadTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("TRUSTED_PROXIES : adresse %q invalide", item)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES : plage %q invalide (notation CIDR attendue, ex: 10.0.0.0/8)", item)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// isTrustedProxy indique si ip appartient à l'une des plages TRUSTED_PROXIES
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP retourne l'IP du client. Les en-têtes X-Forwarded-For et
+// X-Real-IP ne sont pris en compte que si la connexion vient d'un proxy de
+// confiance (TRUSTED_PROXIES), sinon n'importe quel client pourrait choisir
+// son IP et contourner la limitation de débit. X-Forwarded-For est parcouru
+// de droite à gauche : la première IP hors des proxys de confiance est celle
+// du client.
+func clientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !isTrustedProxy(peer) {
+		return peer
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				break
+			}
+			client = hop
+			if !isTrustedProxy(hop) {
+				break
+			}
+		}
+		return client
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		if _, err := netip.ParseAddr(ip); err == nil {
+			return ip
+		}
+	}
+	return peer
+}
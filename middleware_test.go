@@ -0,0 +1,633 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// okHandler répond 200 sans corps
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestAuthMiddleware(t *testing.T) {
+	t.Setenv("API_KEY", "cle-secrete")
+	handler := authMiddleware(okHandler)
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"bearer valide", "Authorization", "Bearer cle-secrete", http.StatusOK},
+		{"X-API-Key valide", "X-API-Key", "cle-secrete", http.StatusOK},
+		{"clé absente", "", "", http.StatusUnauthorized},
+		{"bearer invalide", "Authorization", "Bearer mauvaise-cle", http.StatusUnauthorized},
+		{"X-API-Key invalide", "X-API-Key", "cle-secret", http.StatusUnauthorized},
+		{"schéma Basic", "Authorization", "Basic cle-secrete", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/send-email", nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.want {
+			t.Errorf("%s : statut = %d, attendu %d", tt.name, w.Code, tt.want)
+			continue
+		}
+		if tt.want == http.StatusUnauthorized {
+			if code := decodeAPIError(t, w).Code; code != "UNAUTHORIZED" {
+				t.Errorf("%s : code = %q, attendu UNAUTHORIZED", tt.name, code)
+			}
+			if w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("%s : en-tête WWW-Authenticate absent", tt.name)
+			}
+		}
+	}
+}
+
+func TestAuthMiddlewareWithoutAPIKey(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	w := httptest.NewRecorder()
+	authMiddleware(okHandler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/entreprise?id=552032534", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("sans API_KEY : statut = %d, attendu 200", w.Code)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := rateLimitMiddleware(newIPRateLimiter(rate.Every(time.Minute), 3), okHandler)
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/send-email", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := range 3 {
+		if w := request("203.0.113.7:4000"); w.Code != http.StatusOK {
+			t.Fatalf("requête %d : statut = %d, attendu 200 (dans le burst)", i+1, w.Code)
+		}
+	}
+
+	w := request("203.0.113.7:4001")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("statut = %d après le burst, attendu 429", w.Code)
+	}
+	if code := decodeAPIError(t, w).Code; code != "RATE_LIMITED" {
+		t.Errorf("code = %q, attendu RATE_LIMITED", code)
+	}
+	if retry, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retry < 1 || retry > 60 {
+		t.Errorf("Retry-After = %q, attendu entre 1 et 60 secondes", w.Header().Get("Retry-After"))
+	}
+
+	// Une autre IP dispose de son propre quota
+	if w := request("198.51.100.9:4000"); w.Code != http.StatusOK {
+		t.Errorf("autre IP : statut = %d, attendu 200", w.Code)
+	}
+}
+
+// captureLogs redirige le logger global vers un tampon JSON (niveau debug)
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// logRecords décode les lignes de log JSON capturées
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("ligne de log non JSON %q : %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestRequestLogRecord(t *testing.T) {
+	buf := captureLogs(t)
+	handler := requestIDMiddleware(requestLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "introuvable")
+	})))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/entreprise?id=552032534", nil))
+
+	records := logRecords(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("%d enregistrements, attendu 1", len(records))
+	}
+	rec := records[0]
+	for _, key := range []string{"time", "level", "msg", "request_id", "method", "route", "status", "bytes", "client_ip", "duration"} {
+		if _, ok := rec[key]; !ok {
+			t.Errorf("clé %q absente de l'enregistrement %v", key, rec)
+		}
+	}
+	if rec["route"] != "/api/entreprise" || rec["status"] != float64(http.StatusNotFound) || rec["level"] != "INFO" {
+		t.Errorf("enregistrement = %v, attendu route /api/entreprise, status 404, niveau INFO", rec)
+	}
+}
+
+func TestRequestLogStatusAndBytes(t *testing.T) {
+	buf := captureLogs(t)
+	handler := requestLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		// Statut implicite (200) et corps écrit en plusieurs fois
+		io.WriteString(w, "Bonjour ")
+		io.WriteString(w, "le monde")
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/send-email?dry_run=1", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	records := logRecords(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("%d enregistrements, attendu 1", len(records))
+	}
+	rec := records[0]
+	want := map[string]any{
+		"msg":       "requête traitée",
+		"method":    http.MethodPost,
+		"route":     "/api/send-email",
+		"status":    float64(http.StatusOK),
+		"bytes":     float64(len("Bonjour le monde")),
+		"client_ip": "203.0.113.7",
+	}
+	for key, value := range want {
+		if rec[key] != value {
+			t.Errorf("%s = %v, attendu %v", key, rec[key], value)
+		}
+	}
+	// Durée sérialisée en nanosecondes par le handler JSON
+	if d, _ := rec["duration"].(float64); time.Duration(d) < 5*time.Millisecond {
+		t.Errorf("duration = %v, attendu au moins 5ms", rec["duration"])
+	}
+}
+
+func TestSetupLogger(t *testing.T) {
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("LOG_FORMAT", "")
+	setupLogger()
+	if _, ok := slog.Default().Handler().(*slog.JSONHandler); !ok {
+		t.Errorf("handler = %T, attendu *slog.JSONHandler par défaut", slog.Default().Handler())
+	}
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("LOG_LEVEL=debug : niveau debug désactivé")
+	}
+
+	t.Setenv("LOG_LEVEL", "inconnu")
+	t.Setenv("LOG_FORMAT", "text")
+	setupLogger()
+	if _, ok := slog.Default().Handler().(*slog.TextHandler); !ok {
+		t.Errorf("LOG_FORMAT=text : handler = %T, attendu *slog.TextHandler", slog.Default().Handler())
+	}
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("LOG_LEVEL invalide : attendu le niveau info par défaut")
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	buf := captureLogs(t)
+	var ctxID string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxID, _ = r.Context().Value(requestIDKey).(string)
+		loggerFromContext(r.Context()).Info("traitement")
+	}))
+
+	request := func(id string) string {
+		r := httptest.NewRequest(http.MethodGet, "/api/entreprise?id=552032534", nil)
+		if id != "" {
+			r.Header.Set("X-Request-ID", id)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Header().Get("X-Request-ID")
+	}
+
+	// Identifiant du client repris tel quel
+	if got := request("client-42"); got != "client-42" || ctxID != "client-42" {
+		t.Errorf("X-Request-ID = %q (contexte %q), attendu client-42", got, ctxID)
+	}
+
+	// Identifiant généré en l'absence d'en-tête, ou s'il est invalide
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	for _, id := range []string{"", "avec espace", strings.Repeat("x", 129)} {
+		got := request(id)
+		if !generated.MatchString(got) || got == id || ctxID != got {
+			t.Errorf("X-Request-ID %q : réponse %q (contexte %q), attendu un identifiant généré", id, got, ctxID)
+		}
+	}
+	if first, second := request(""), request(""); first == second {
+		t.Errorf("identifiant %q généré deux fois", first)
+	}
+
+	// Chaque ligne de log de la requête porte son identifiant
+	records := logRecords(t, buf)
+	if len(records) == 0 || records[0]["request_id"] != "client-42" {
+		t.Errorf("premier enregistrement = %v, attendu request_id client-42", records)
+	}
+}
+
+func TestSendEmailLogsRequestID(t *testing.T) {
+	buf := captureLogs(t)
+	body := `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour","dry_run":true}`
+	r := httptest.NewRequest(http.MethodPost, "/api/send-email", strings.NewReader(body))
+	r.Header.Set("X-Request-ID", "envoi-7")
+	requestIDMiddleware(http.HandlerFunc(sendEmailHandler)).ServeHTTP(httptest.NewRecorder(), r)
+
+	records := logRecords(t, buf)
+	if len(records) == 0 {
+		t.Fatal("aucun log émis par sendEmailHandler")
+	}
+	for _, rec := range records {
+		if rec["request_id"] != "envoi-7" {
+			t.Errorf("enregistrement sans request_id : %v", rec)
+		}
+	}
+}
+
+// useAllowedOrigins applique CORS_ALLOWED_ORIGINS (lu au démarrage) le temps du test
+func useAllowedOrigins(t *testing.T, value string) {
+	t.Helper()
+	t.Setenv("CORS_ALLOWED_ORIGINS", value)
+	previous := corsAllowedOrigins
+	corsAllowedOrigins = loadAllowedOrigins()
+	t.Cleanup(func() { corsAllowedOrigins = previous })
+}
+
+// corsRequest envoie une requête depuis origin à travers corsMiddleware
+func corsRequest(method, origin string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/api/entreprise?id=552032534", nil)
+	r.Header.Set("Origin", origin)
+	w := httptest.NewRecorder()
+	corsMiddleware(okHandler).ServeHTTP(w, r)
+	return w
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	useAllowedOrigins(t, "https://app.exemple.fr, https://Dev.Exemple.fr/ ,http://localhost:3000")
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.exemple.fr", true},
+		{"https://dev.exemple.fr", true},  // configurée avec casse et slash final
+		{"https://app.exemple.fr/", true}, // slash final envoyé par le client
+		{"http://localhost:3000", true},
+		{"http://app.exemple.fr", false}, // autre schéma
+		{"https://exemple.fr", false},
+		{"https://vintagestandards.fr", false}, // liste par défaut remplacée
+	}
+	for _, tt := range tests {
+		w := corsRequest(http.MethodGet, tt.origin)
+		got := w.Header().Get("Access-Control-Allow-Origin")
+		if (got != "") != tt.want {
+			t.Errorf("Origin %q : Access-Control-Allow-Origin = %q, attendu autorisée = %v", tt.origin, got, tt.want)
+		}
+		if !slices.Contains(w.Header().Values("Vary"), "Origin") {
+			t.Errorf("Origin %q : en-tête Vary: Origin absent", tt.origin)
+		}
+	}
+}
+
+func TestCORSDefaultOrigins(t *testing.T) {
+	useAllowedOrigins(t, "")
+	for _, origin := range []string{"https://vintagestandards.fr", "https://dev.vintagestandards.fr", "http://localhost:8082"} {
+		if got := corsRequest(http.MethodGet, origin).Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("Origin %q : Access-Control-Allow-Origin = %q, attendu l'origine par défaut", origin, got)
+		}
+	}
+}
+
+func TestCORSWildcardSubdomain(t *testing.T) {
+	useAllowedOrigins(t, "https://*.vintagestandards.fr")
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://dev.vintagestandards.fr", true},
+		{"https://App-2.Vintagestandards.fr", true},
+		{"https://vintagestandards.fr", false},      // domaine nu
+		{"https://a.b.vintagestandards.fr", false},  // deux niveaux
+		{"https://evil-vintagestandards.fr", false}, // domaine sosie
+		{"https://devvintagestandards.fr", false},   // sans point
+		{"https://dev.vintagestandards.fr.evil.fr", false},
+		{"http://dev.vintagestandards.fr", false},    // autre schéma
+		{"https://-dev.vintagestandards.fr", false},  // label invalide
+		{"https://dev_1.vintagestandards.fr", false}, // label invalide
+	}
+	for _, tt := range tests {
+		got := corsRequest(http.MethodGet, tt.origin).Header().Get("Access-Control-Allow-Origin")
+		if (got != "") != tt.want {
+			t.Errorf("Origin %q : Access-Control-Allow-Origin = %q, attendu autorisée = %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORSPreflightMaxAge(t *testing.T) {
+	useAllowedOrigins(t, "https://vintagestandards.fr")
+	previous := corsMaxAge
+	t.Cleanup(func() { corsMaxAge = previous })
+
+	t.Setenv("CORS_MAX_AGE", "")
+	corsMaxAge = loadCORSMaxAge()
+	w := corsRequest(http.MethodOptions, "https://vintagestandards.fr")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("OPTIONS : statut %d, Access-Control-Max-Age = %q, attendu 200 et 600 par défaut", w.Code, w.Header().Get("Access-Control-Max-Age"))
+	}
+
+	t.Setenv("CORS_MAX_AGE", "2h")
+	corsMaxAge = loadCORSMaxAge()
+	if got := corsRequest(http.MethodOptions, "https://vintagestandards.fr").Header().Get("Access-Control-Max-Age"); got != "7200" {
+		t.Errorf("CORS_MAX_AGE=2h : Access-Control-Max-Age = %q, attendu 7200", got)
+	}
+
+	// Valeur en secondes, comme l'en-tête Access-Control-Max-Age
+	for value, want := range map[string]string{"600": "600", "3600": "3600", "0": "0"} {
+		t.Setenv("CORS_MAX_AGE", value)
+		corsMaxAge = loadCORSMaxAge()
+		if got := corsRequest(http.MethodOptions, "https://vintagestandards.fr").Header().Get("Access-Control-Max-Age"); got != want {
+			t.Errorf("CORS_MAX_AGE=%s : Access-Control-Max-Age = %q, attendu %s", value, got, want)
+		}
+	}
+
+	// Uniquement sur les réponses preflight
+	if got := corsRequest(http.MethodGet, "https://vintagestandards.fr").Header().Get("Access-Control-Max-Age"); got != "" {
+		t.Errorf("GET : Access-Control-Max-Age = %q, attendu absent", got)
+	}
+}
+
+func TestSendAliasDeprecationHeaders(t *testing.T) {
+	handler := newTestHandler(t)
+	buf := captureLogs(t)
+	body := `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour","dry_run":true}`
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/Send/", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /Send/ : statut = %d (%s), attendu 200 (route toujours active)", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("Deprecation = %q, attendu true", got)
+	}
+	if got, want := w.Header().Get("Sunset"), sendAliasSunset.UTC().Format(http.TimeFormat); got != want {
+		t.Errorf("Sunset = %q, attendu %q", got, want)
+	}
+	if got := w.Header().Get("Link"); got != `</api/send-email>; rel="successor-version"` {
+		t.Errorf("Link = %q", got)
+	}
+	if !strings.Contains(buf.String(), "route obsolète utilisée") {
+		t.Error("aucun avertissement journalisé pour la route obsolète")
+	}
+
+	// La route de remplacement n'est pas marquée
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/send-email", strings.NewReader(body)))
+	if w.Header().Get("Deprecation") != "" {
+		t.Error("en-tête Deprecation sur /api/send-email")
+	}
+}
+
+func TestCORSAllowedMethodsAndHeaders(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_METHODS", "GET,POST , PUT,DELETE,,OPTIONS")
+	t.Setenv("CORS_ALLOWED_HEADERS", "Content-Type, X-API-Key, X-Tenant")
+	methods, headers := corsAllowedMethods, corsAllowedHeaders
+	corsAllowedMethods = envList("CORS_ALLOWED_METHODS", "GET, POST, OPTIONS")
+	corsAllowedHeaders = envList("CORS_ALLOWED_HEADERS", "Content-Type")
+	t.Cleanup(func() { corsAllowedMethods, corsAllowedHeaders = methods, headers })
+
+	w := corsRequest(http.MethodOptions, "https://vintagestandards.fr")
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST, PUT, DELETE, OPTIONS" {
+		t.Errorf("Access-Control-Allow-Methods = %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, X-API-Key, X-Tenant" {
+		t.Errorf("Access-Control-Allow-Headers = %q", got)
+	}
+}
+
+func TestCORSDefaultMethodsAndHeaders(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_METHODS", "")
+	t.Setenv("CORS_ALLOWED_HEADERS", "")
+	if got := envList("CORS_ALLOWED_METHODS", "GET, POST, OPTIONS"); got != "GET, POST, OPTIONS" {
+		t.Errorf("méthodes par défaut = %q", got)
+	}
+
+	w := corsRequest(http.MethodOptions, "https://vintagestandards.fr")
+	for _, header := range []string{"Content-Type", "Authorization", "X-API-Key", "Idempotency-Key"} {
+		if !strings.Contains(w.Header().Get("Access-Control-Allow-Headers"), header) {
+			t.Errorf("Access-Control-Allow-Headers = %q, attendu %s", w.Header().Get("Access-Control-Allow-Headers"), header)
+		}
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	buf := captureLogs(t)
+	handler := requestIDMiddleware(recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data *EntrepriseResponse
+		_ = data.Siren // déréférencement nil
+	})))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/entreprise?id=552032534", nil)
+	r.Header.Set("X-Request-ID", "req-panique")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError || decodeAPIError(t, w).Code != "INTERNAL_ERROR" {
+		t.Fatalf("statut = %d (%s), attendu 500 INTERNAL_ERROR", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "nil pointer") {
+		t.Error("détail de la panique exposé au client")
+	}
+
+	var found bool
+	for _, rec := range logRecords(t, buf) {
+		if rec["msg"] != "panic dans le handler" {
+			continue
+		}
+		found = true
+		if rec["request_id"] != "req-panique" {
+			t.Errorf("request_id = %v, attendu req-panique", rec["request_id"])
+		}
+		if panicMsg, _ := rec["panic"].(string); !strings.Contains(panicMsg, "nil pointer") {
+			t.Errorf("panic = %q", panicMsg)
+		}
+		if stack, _ := rec["stack"].(string); !strings.Contains(stack, "TestRecoverMiddleware") {
+			t.Error("pile d'appels absente du log")
+		}
+	}
+	if !found {
+		t.Errorf("panique non journalisée : %s", buf)
+	}
+}
+
+func TestRecoverMiddlewareKeepsServing(t *testing.T) {
+	captureLogs(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/panique", func(w http.ResponseWriter, r *http.Request) { panic("boum") })
+	mux.Handle("/ok", okHandler)
+	srv := httptest.NewServer(recoverMiddleware(mux))
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/panique")
+	if err != nil {
+		t.Fatalf("connexion coupée au lieu d'une réponse 500 : %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("statut = %d, Content-Type = %q, attendu une erreur JSON 500", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	resp, err = http.Get(srv.URL + "/ok")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("requête suivante : %v, attendu 200", err)
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	// http.ErrAbortHandler reste transmis à net/http (réponse abandonnée)
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("recover() = %v, attendu http.ErrAbortHandler", p)
+		}
+	}()
+	recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+// useTrustedProxies applique TRUSTED_PROXIES (lu au démarrage) le temps du test
+func useTrustedProxies(t *testing.T, value string) {
+	t.Helper()
+	prefixes, err := loadTrustedProxies(value)
+	if err != nil {
+		t.Fatalf("loadTrustedProxies(%q): %v", value, err)
+	}
+	previous := trustedProxies
+	trustedProxies = prefixes
+	t.Cleanup(func() { trustedProxies = previous })
+}
+
+func TestClientIP(t *testing.T) {
+	useTrustedProxies(t, "10.0.0.0/8, 192.0.2.10")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		realIP     string
+		want       string
+	}{
+		{"sans proxy", "203.0.113.7:4000", nil, "", "203.0.113.7"},
+		{"XFF usurpé par un client direct", "203.0.113.7:4000", []string{"1.2.3.4"}, "", "203.0.113.7"},
+		{"X-Real-IP usurpé par un client direct", "203.0.113.7:4000", nil, "1.2.3.4", "203.0.113.7"},
+		{"proxy de confiance", "10.1.2.3:4000", []string{"198.51.100.9"}, "", "198.51.100.9"},
+		{"IP seule de confiance", "192.0.2.10:4000", []string{"198.51.100.9"}, "", "198.51.100.9"},
+		{"chaîne de proxys de confiance", "10.1.2.3:4000", []string{"198.51.100.9, 10.9.9.9"}, "", "198.51.100.9"},
+		// Le client a préfixé une fausse IP : seul le dernier saut non fiable compte
+		{"XFF préfixé par le client", "10.1.2.3:4000", []string{"1.2.3.4, 198.51.100.9"}, "", "198.51.100.9"},
+		{"en-têtes XFF multiples", "10.1.2.3:4000", []string{"1.2.3.4", "198.51.100.9"}, "", "198.51.100.9"},
+		{"saut invalide", "10.1.2.3:4000", []string{"198.51.100.9, pas-une-ip"}, "", "10.1.2.3"},
+		{"X-Real-IP via un proxy de confiance", "10.1.2.3:4000", nil, "198.51.100.9", "198.51.100.9"},
+		{"X-Real-IP invalide", "10.1.2.3:4000", nil, "pas-une-ip", "10.1.2.3"},
+		{"IPv4 mappée en IPv6", "[::ffff:10.1.2.3]:4000", []string{"198.51.100.9"}, "", "198.51.100.9"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, v := range tt.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := clientIP(r); got != tt.want {
+			t.Errorf("%s : clientIP = %q, attendu %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadTrustedProxies(t *testing.T) {
+	prefixes, err := loadTrustedProxies(" 10.0.0.0/8, ,192.0.2.10, 2001:db8::/32, 10.1.2.3/16")
+	if err != nil {
+		t.Fatalf("loadTrustedProxies: %v", err)
+	}
+	want := []string{"10.0.0.0/8", "192.0.2.10/32", "2001:db8::/32", "10.1.0.0/16"}
+	if len(prefixes) != len(want) {
+		t.Fatalf("plages = %v, attendu %v", prefixes, want)
+	}
+	for i, p := range prefixes {
+		if p.String() != want[i] {
+			t.Errorf("plage %d = %s, attendu %s", i, p, want[i])
+		}
+	}
+
+	for _, value := range []string{"10.0.0.0/33", "proxy.local", "10.0.0"} {
+		if _, err := loadTrustedProxies(value); err == nil || !strings.Contains(err.Error(), "TRUSTED_PROXIES") {
+			t.Errorf("loadTrustedProxies(%q) = %v, attendu une erreur", value, err)
+		}
+	}
+}
+
+func TestRateLimitUsesTrustedClientIP(t *testing.T) {
+	useTrustedProxies(t, "10.0.0.0/8")
+	limiter := newIPRateLimiter(rate.Every(time.Hour), 1)
+	handler := rateLimitMiddleware(limiter, okHandler)
+
+	request := func(remoteAddr, xff string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/send-email", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-For", xff)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Client direct : changer de X-Forwarded-For ne donne pas un nouveau quota
+	request("203.0.113.7:4000", "1.1.1.1")
+	if code := request("203.0.113.7:4000", "2.2.2.2"); code != http.StatusTooManyRequests {
+		t.Errorf("XFF usurpé : statut = %d, attendu 429", code)
+	}
+	// Derrière le proxy : un quota par client réel
+	request("10.0.0.1:4000", "198.51.100.1")
+	if code := request("10.0.0.1:4000", "198.51.100.2"); code != http.StatusOK {
+		t.Errorf("autre client derrière le proxy : statut = %d, attendu 200", code)
+	}
+	if code := request("10.0.0.2:4000", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("même client via un autre proxy : statut = %d, attendu 429", code)
+	}
+}
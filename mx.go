@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- VÉRIFICATION DES DOMAINES DESTINATAIRES (MX) ---
+
+// mxResolver permet de remplacer le résolveur DNS (net.DefaultResolver)
+type mxResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+var errNoMX = errors.New("domaine sans serveur de messagerie")
+
+// mxChecker vérifie qu'un domaine possède un serveur de messagerie (MX ou
+// A/AAAA), avec un cache des réponses définitives (MX_CACHE_TTL)
+type mxChecker struct {
+	resolver mxResolver
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	cache map[string]mxCacheEntry
+}
+
+type mxCacheEntry struct {
+	hasMX   bool
+	expires time.Time
+}
+
+var recipientMXChecker = newMXChecker(net.DefaultResolver, envDuration("MX_CACHE_TTL", 10*time.Minute))
+
+func newMXChecker(resolver mxResolver, ttl time.Duration) *mxChecker {
+	c := &mxChecker{
+		resolver: resolver,
+		ttl:      ttl,
+		cache:    make(map[string]mxCacheEntry),
+	}
+	go c.cleanup()
+	return c
+}
+
+// cleanup oublie périodiquement les réponses expirées
+func (c *mxChecker) cleanup() {
+	for range time.Tick(time.Minute) {
+		c.sweep(time.Now())
+	}
+}
+
+// sweep supprime les réponses expirées à la date now
+func (c *mxChecker) sweep(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for domain, e := range c.cache {
+		if !now.Before(e.expires) {
+			delete(c.cache, domain)
+		}
+	}
+}
+
+// check retourne errNoMX si le domaine ne peut pas recevoir d'emails : domaine
+// inexistant, "null MX" (RFC 7505), ou ni MX ni adresse IP (sans MX, le
+// domaine reçoit sur ses enregistrements A/AAAA, RFC 5321 section 5.1). Une
+// erreur DNS temporaire est retournée telle quelle et n'est pas mise en
+// cache : l'appelant décide de laisser passer l'envoi.
+func (c *mxChecker) check(ctx context.Context, domain string) error {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	c.mu.Lock()
+	entry, ok := c.cache[domain]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		if !entry.hasMX {
+			return errNoMX
+		}
+		return nil
+	}
+
+	deliverable, err := c.lookup(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.cache[domain] = mxCacheEntry{hasMX: deliverable, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	if !deliverable {
+		return errNoMX
+	}
+	return nil
+}
+
+// lookup interroge le DNS : MX d'abord, puis A/AAAA en l'absence de MX
+// (MX implicite)
+func (c *mxChecker) lookup(ctx context.Context, domain string) (bool, error) {
+	records, err := c.resolver.LookupMX(ctx, domain)
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		records = nil
+	default:
+		return false, err
+	}
+
+	if len(records) > 0 {
+		// Un "null MX" (hôte ".") déclare explicitement le domaine sans messagerie
+		for _, mx := range records {
+			if mx.Host != "." && mx.Host != "" {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	addrs, err := c.resolver.LookupIPAddr(ctx, domain)
+	switch {
+	case err == nil:
+		return len(addrs) > 0, nil
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// addressDomain retourne le domaine d'une adresse nue ("jean@exemple.fr")
+func addressDomain(address string) string {
+	_, domain, _ := strings.Cut(address, "@")
+	return domain
+}
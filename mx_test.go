@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver répond depuis des tables en mémoire : un domaine absent des
+// deux tables est inexistant (NXDOMAIN), un domaine de failing échoue
+// temporairement
+type fakeResolver struct {
+	mx      map[string][]*net.MX
+	ips     map[string][]net.IPAddr
+	failing map[string]bool
+
+	mu      sync.Mutex
+	lookups int
+}
+
+func (r *fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	r.mu.Lock()
+	r.lookups++
+	r.mu.Unlock()
+	if r.failing[name] {
+		return nil, &net.DNSError{Err: "délai dépassé", Name: name, IsTimeout: true, IsTemporary: true}
+	}
+	if records, ok := r.mx[name]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if addrs, ok := r.ips[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (r *fakeResolver) lookupCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookups
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{
+		mx: map[string][]*net.MX{
+			"exemple.fr":   {{Host: "mx1.exemple.fr.", Pref: 10}},
+			"sans-mail.fr": {{Host: ".", Pref: 0}}, // null MX (RFC 7505)
+		},
+		ips: map[string][]net.IPAddr{
+			"mx-implicite.fr": {{IP: net.ParseIP("93.184.216.34")}},
+		},
+		failing: map[string]bool{"dns-en-panne.fr": true},
+	}
+}
+
+// useFakeResolver remplace le vérificateur MX par un vérificateur sans cache
+// préalable, branché sur un résolveur en mémoire
+func useFakeResolver(t *testing.T) *fakeResolver {
+	t.Helper()
+	resolver := newFakeResolver()
+	previous := recipientMXChecker
+	recipientMXChecker = &mxChecker{resolver: resolver, ttl: time.Minute, cache: make(map[string]mxCacheEntry)}
+	t.Cleanup(func() { recipientMXChecker = previous })
+	return resolver
+}
+
+func TestMXCheckerCheck(t *testing.T) {
+	tests := []struct {
+		domain  string
+		want    error
+		network bool // erreur DNS temporaire attendue
+	}{
+		{"exemple.fr", nil, false},
+		{"EXEMPLE.FR.", nil, false},
+		{"mx-implicite.fr", nil, false},
+		{"gmial.com", errNoMX, false},
+		{"sans-mail.fr", errNoMX, false},
+		{"dns-en-panne.fr", nil, true},
+	}
+	for _, tt := range tests {
+		c := &mxChecker{resolver: newFakeResolver(), ttl: time.Minute, cache: make(map[string]mxCacheEntry)}
+		err := c.check(context.Background(), tt.domain)
+		if tt.network {
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) || !dnsErr.Temporary() || errors.Is(err, errNoMX) {
+				t.Errorf("check(%q) = %v, attendu l'erreur DNS temporaire", tt.domain, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("check(%q) = %v, attendu %v", tt.domain, err, tt.want)
+		}
+	}
+}
+
+func TestMXCheckerCache(t *testing.T) {
+	resolver := newFakeResolver()
+	c := &mxChecker{resolver: resolver, ttl: time.Minute, cache: make(map[string]mxCacheEntry)}
+	ctx := context.Background()
+
+	// Réponses définitives en cache, positives comme négatives
+	for range 3 {
+		c.check(ctx, "exemple.fr")
+		c.check(ctx, "gmial.com")
+	}
+	if n := resolver.lookupCount(); n != 2 {
+		t.Errorf("%d requêtes DNS, attendu 2 (une par domaine)", n)
+	}
+
+	// Erreur temporaire : jamais en cache
+	c.check(ctx, "dns-en-panne.fr")
+	c.check(ctx, "dns-en-panne.fr")
+	if n := resolver.lookupCount(); n != 4 {
+		t.Errorf("%d requêtes DNS, attendu 4 (erreurs temporaires non mises en cache)", n)
+	}
+
+	// Réponses expirées purgées
+	c.sweep(time.Now().Add(2 * time.Minute))
+	if len(c.cache) != 0 {
+		t.Errorf("%d réponses en cache après expiration, attendu 0", len(c.cache))
+	}
+}
+
+func TestSendEmailCheckMX(t *testing.T) {
+	useFakeResolver(t)
+	t.Setenv("CHECK_MX", "1")
+
+	send := func(to string) int {
+		w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"`+to+`","subject":"Devis","body":"Bonjour","dry_run":true}`)
+		if w.Code == http.StatusBadRequest {
+			if code := decodeAPIError(t, w).Code; code != "UNDELIVERABLE_DOMAIN" {
+				t.Errorf("%s : code = %q, attendu UNDELIVERABLE_DOMAIN", to, code)
+			}
+		}
+		return w.Code
+	}
+
+	for to, want := range map[string]int{
+		"client@exemple.fr":      http.StatusOK,
+		"client@mx-implicite.fr": http.StatusOK,
+		"client@gmial.com":       http.StatusBadRequest,
+		"client@sans-mail.fr":    http.StatusBadRequest,
+		// Erreur DNS temporaire : l'envoi n'est pas bloqué
+		"client@dns-en-panne.fr": http.StatusOK,
+	} {
+		if got := send(to); got != want {
+			t.Errorf("%s : statut = %d, attendu %d", to, got, want)
+		}
+	}
+
+	// Vérification désactivée par défaut
+	t.Setenv("CHECK_MX", "")
+	if got := send("client@gmial.com"); got != http.StatusOK {
+		t.Errorf("sans CHECK_MX : statut = %d, attendu 200", got)
+	}
+}
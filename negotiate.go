@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// --- NÉGOCIATION DE CONTENU ---
+
+// Formats de réponse proposés par les routes entreprise
+const (
+	formatJSON = "application/json"
+	formatXML  = "application/xml"
+)
+
+// negotiateFormat choisit le format de réponse d'après l'en-tête Accept :
+// JSON par défaut (en-tête absent, */*, application/*), XML sur demande
+// (application/xml, text/xml). ok vaut false si aucun type accepté n'est
+// proposé (-> 406).
+func negotiateFormat(accept string) (format string, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		return formatJSON, true
+	}
+
+	bestQ := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			if v, found := strings.CutPrefix(strings.TrimSpace(p), "q="); found {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q <= 0 || q <= bestQ {
+			continue
+		}
+
+		switch name {
+		case "application/json", "application/*", "*/*":
+			format, bestQ = formatJSON, q
+		case "application/xml", "text/xml":
+			format, bestQ = formatXML, q
+		}
+	}
+	return format, format != ""
+}
+
+// encodeXML écrit v en XML précédé de la déclaration standard
+func encodeXML(w io.Writer, v any) error {
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
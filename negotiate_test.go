@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		{"", formatJSON, true},
+		{"*/*", formatJSON, true},
+		{"application/json", formatJSON, true},
+		{"application/*", formatJSON, true},
+		{"application/xml", formatXML, true},
+		{"text/xml", formatXML, true},
+		{"Application/XML", formatXML, true},
+		{"application/json;q=0.5, application/xml", formatXML, true},
+		{"application/xml;q=0.2, */*;q=0.8", formatJSON, true},
+		{"text/html, application/xml;q=0.9", formatXML, true},
+		{"application/xml;q=0", "", false},
+		{"text/html", "", false},
+		{"text/csv, image/png", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := negotiateFormat(tt.accept)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("negotiateFormat(%q) = %q, %v, attendu %q, %v", tt.accept, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// entrepriseAccept interroge /api/entreprise avec l'en-tête Accept donné
+func entrepriseAccept(accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/api/entreprise/552032534", nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	entrepriseHandler(w, r)
+	return w
+}
+
+func TestEntrepriseContentNegotiation(t *testing.T) {
+	p := useStubProvider(t, danone)
+
+	// JSON par défaut
+	w := entrepriseAccept("")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("sans Accept : statut = %d, Content-Type = %q, attendu du JSON", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got := decodeEntreprise(t, w).Denomination; got != "DANONE" {
+		t.Errorf("JSON : denomination = %q", got)
+	}
+	if w.Header().Get("Vary") != "Accept" {
+		t.Errorf("Vary = %q, attendu Accept", w.Header().Get("Vary"))
+	}
+
+	// XML sur demande
+	w = entrepriseAccept("application/xml")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/xml; charset=utf-8" {
+		t.Fatalf("Accept XML : statut = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, xml.Header) || !strings.Contains(body, "<entreprise>") || !strings.Contains(body, "<tva>FR27552032534</tva>") {
+		t.Errorf("corps XML inattendu :\n%s", body)
+	}
+	var data EntrepriseResponse
+	if err := xml.Unmarshal(w.Body.Bytes(), &data); err != nil {
+		t.Fatalf("XML illisible: %v", err)
+	}
+	if data.Siren != "552032534" || data.AdressePostaleLegale == nil || data.AdressePostaleLegale.Ville != "PARIS" {
+		t.Errorf("XML : %+v", data)
+	}
+
+	// ETag distinct par format : un cache ne doit pas servir l'un pour l'autre
+	if entrepriseAccept("").Header().Get("ETag") == entrepriseAccept("text/xml").Header().Get("ETag") {
+		t.Error("même ETag pour les réponses JSON et XML")
+	}
+
+	// Type non proposé : refusé sans interroger le fournisseur
+	calls := len(p.lookups())
+	w = entrepriseAccept("text/html")
+	if w.Code != http.StatusNotAcceptable || decodeAPIError(t, w).Code != "NOT_ACCEPTABLE" {
+		t.Errorf("Accept text/html : statut = %d (%s), attendu 406 NOT_ACCEPTABLE", w.Code, w.Body)
+	}
+	if n := len(p.lookups()); n != calls {
+		t.Errorf("%d appels au fournisseur pour une réponse 406", n-calls)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// --- FOURNISSEURS DE DONNÉES ENTREPRISE ---
+
+// CompanyProvider est une source de données entreprise (societe.com, INSEE).
+// Lookup retourne errEntrepriseIntrouvable si le SIREN/SIRET est inconnu.
+type CompanyProvider interface {
+	Name() string
+	Lookup(ctx context.Context, numid string, fields entrepriseFields) (*EntrepriseResponse, error)
+}
+
+// CompanySearcher est implémenté par les fournisseurs proposant la
+// recherche par nom (GET /api/entreprise/search)
+type CompanySearcher interface {
+	Search(ctx context.Context, q string, page, perPage int) (*EntrepriseSearchResponse, error)
+}
+
+// Fournisseur utilisé par les handlers, choisi au démarrage via COMPANY_PROVIDER
+var companyProvider CompanyProvider = societeProvider{}
+
+// Client HTTP partagé par les fournisseurs : réutilise les connexions
+// (keep-alive) entre les appels. http.Client est sûr en accès concurrent.
+// COMPANY_API_TIMEOUT s'applique à chaque tentative (voir withUpstreamRetry).
+var upstreamHTTPClient = &http.Client{
+	Timeout: envDuration("COMPANY_API_TIMEOUT", 10*time.Second),
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        envInt("UPSTREAM_MAX_IDLE_CONNS", 100),
+		MaxIdleConnsPerHost: envInt("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", 10),
+		IdleConnTimeout:     envDuration("UPSTREAM_IDLE_CONN_TIMEOUT", 90*time.Second),
+		TLSHandshakeTimeout: 5 * time.Second,
+		ForceAttemptHTTP2:   true,
+	},
+}
+
+// newCompanyProvider retourne le fournisseur correspondant à son nom
+// ("societe" par défaut)
+func newCompanyProvider(name string) (CompanyProvider, error) {
+	switch name {
+	case "", "societe":
+		return societeProvider{}, nil
+	case "insee":
+		return newInseeProvider(), nil
+	default:
+		return nil, fmt.Errorf("COMPANY_PROVIDER inconnu : %q (valeurs possibles : societe, insee)", name)
+	}
+}
+
+// upstreamRateLimitError signale que le fournisseur a refusé l'appel pour
+// dépassement de quota (HTTP 429). retryAfter vaut 0 si le délai est inconnu.
+type upstreamRateLimitError struct {
+	provider   string
+	retryAfter time.Duration
+}
+
+func (e *upstreamRateLimitError) Error() string {
+	return fmt.Sprintf("quota de l'API %s dépassé (réessayer dans %s)", e.provider, e.retryAfter)
+}
+
+// parseRetryAfter interprète l'en-tête Retry-After, en secondes ou en date HTTP
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// writeUpstreamError traduit une erreur du fournisseur (hors entreprise
+// introuvable) : 429 avec Retry-After en cas de quota dépassé, 503 si le
+// disjoncteur est ouvert, 504 si le fournisseur ne répond pas à temps, 500 sinon
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	var rateErr *upstreamRateLimitError
+	if errors.As(err, &rateErr) {
+		if rateErr.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rateErr.retryAfter.Seconds()))))
+		}
+		writeError(w, http.StatusTooManyRequests, "UPSTREAM_RATE_LIMITED", "Quota de l'API entreprise dépassé, réessayez plus tard")
+		return
+	}
+	var openErr *circuitOpenError
+	if errors.As(err, &openErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(openErr.retryAfter.Seconds()))))
+		writeError(w, http.StatusServiceUnavailable, "UPSTREAM_UNAVAILABLE", "L'API entreprise est momentanément indisponible, réessayez plus tard")
+		return
+	}
+	if isUpstreamTimeout(err) {
+		writeError(w, http.StatusGatewayTimeout, "UPSTREAM_TIMEOUT", "L'API entreprise ne répond pas, réessayez plus tard")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "UPSTREAM_ERROR", err.Error())
+}
+
+// isUpstreamTimeout : délai dépassé vers le fournisseur (timeout du client
+// HTTP, erreur réseau de type timeout ou échéance du contexte)
+func isUpstreamTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// upstreamStatusError : réponse HTTP inattendue du fournisseur
+type upstreamStatusError struct {
+	status int
+	body   string
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("erreur API distante : %d - %s", e.status, e.body)
+}
+
+// Délai avant la première nouvelle tentative vers un fournisseur (doublé à
+// chaque essai, avec une gigue aléatoire)
+const upstreamRetryBaseDelay = 200 * time.Millisecond
+
+// withUpstreamRetry exécute fn en retentant les erreurs temporaires (502, 503,
+// 504, erreurs réseau) avec un backoff exponentiel. Le nombre d'essais est
+// configurable via UPSTREAM_MAX_RETRIES. Aucune attente ne dépasse
+// l'échéance de ctx.
+func withUpstreamRetry(ctx context.Context, provider string, fn func() error) error {
+	maxAttempts := envInt("UPSTREAM_MAX_RETRIES", 3)
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	delay := upstreamRetryBaseDelay
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = fn()
+		if err == nil || !isRetryableUpstreamError(err) || attempt == maxAttempts {
+			return err
+		}
+
+		// Gigue : entre delay/2 et delay, pour étaler les essais concurrents
+		wait := delay/2 + rand.N(delay/2+1)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+
+		slog.Warn("échec temporaire du fournisseur, nouvel essai", "provider", provider, "attempt", attempt, "error", err, "retry_in", wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// isRetryableUpstreamError : 502/503/504 et erreurs réseau. Les 4xx (dont
+// 404 et 429) et l'annulation de la requête cliente ne sont pas retentés.
+func isRetryableUpstreamError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *upstreamStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.status {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubLookup : appel reçu par stubProvider
+type stubLookup struct {
+	numid  string
+	fields entrepriseFields
+}
+
+// stubProvider est un fournisseur de données entreprise en mémoire
+type stubProvider struct {
+	lookup func(ctx context.Context, numid string, fields entrepriseFields) (*EntrepriseResponse, error)
+
+	mu    sync.Mutex
+	calls []stubLookup
+}
+
+func (p *stubProvider) Name() string { return "stub" }
+
+func (p *stubProvider) Lookup(ctx context.Context, numid string, fields entrepriseFields) (*EntrepriseResponse, error) {
+	p.mu.Lock()
+	p.calls = append(p.calls, stubLookup{numid, fields})
+	p.mu.Unlock()
+	return p.lookup(ctx, numid, fields)
+}
+
+func (p *stubProvider) lookups() []stubLookup {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]stubLookup(nil), p.calls...)
+}
+
+// danone retourne la fiche de test de DANONE, limitée aux champs demandés
+func danone(_ context.Context, numid string, fields entrepriseFields) (*EntrepriseResponse, error) {
+	if numid != "552032534" && numid != "55203253400646" {
+		return nil, errEntrepriseIntrouvable
+	}
+	data := &EntrepriseResponse{
+		Denomination:      "DANONE",
+		Siren:             "552032534",
+		Siret:             "55203253400646",
+		Status:            "active",
+		ImmatriculeeInsee: true,
+	}
+	if fields.Tva {
+		data.Tva = "FR27552032534"
+	}
+	if fields.Address {
+		data.AdressePostaleLegale = &AdressePostale{Ville: "PARIS", CodePostal: "75009"}
+	}
+	return data, nil
+}
+
+// useFreshCompanyCache remplace le cache entreprise par un cache vide le temps du test
+func useFreshCompanyCache(t *testing.T) {
+	t.Helper()
+	previous := entrepriseCache
+	entrepriseCache = newCompanyCache(time.Hour, 5*time.Minute, 10*time.Minute, 100)
+	t.Cleanup(func() { entrepriseCache = previous })
+}
+
+// useStubProvider remplace le fournisseur et le cache entreprise le temps du test
+func useStubProvider(t *testing.T, lookup func(context.Context, string, entrepriseFields) (*EntrepriseResponse, error)) *stubProvider {
+	t.Helper()
+	p := &stubProvider{lookup: lookup}
+
+	previous := companyProvider
+	companyProvider = p
+	t.Cleanup(func() { companyProvider = previous })
+	useFreshCompanyCache(t)
+	return p
+}
+
+func TestEntrepriseHandlerWithFakeProvider(t *testing.T) {
+	tests := []struct {
+		name   string
+		lookup func(context.Context, string, entrepriseFields) (*EntrepriseResponse, error)
+		target string
+		status int
+		code   string
+	}{
+		{"trouvée", danone, "/api/entreprise/552032534", http.StatusOK, ""},
+		{"SIRET", danone, "/api/entreprise/55203253400646", http.StatusOK, ""},
+		{"introuvable", danone, "/api/entreprise/356000000", http.StatusNotFound, "COMPANY_NOT_FOUND"},
+		{"erreur du fournisseur", func(context.Context, string, entrepriseFields) (*EntrepriseResponse, error) {
+			return nil, &upstreamStatusError{status: http.StatusInternalServerError, body: "panne"}
+		}, "/api/entreprise/552032534", http.StatusInternalServerError, "UPSTREAM_ERROR"},
+	}
+	for _, tt := range tests {
+		p := useStubProvider(t, tt.lookup)
+		w := serve(entrepriseHandler, http.MethodGet, tt.target, "")
+		if w.Code != tt.status {
+			t.Errorf("%s : statut = %d (%s), attendu %d", tt.name, w.Code, w.Body, tt.status)
+			continue
+		}
+		if tt.code != "" {
+			if code := decodeAPIError(t, w).Code; code != tt.code {
+				t.Errorf("%s : code = %q, attendu %s", tt.name, code, tt.code)
+			}
+		} else if data := decodeEntreprise(t, w); data.Denomination != "DANONE" {
+			t.Errorf("%s : réponse = %+v, attendu DANONE", tt.name, data)
+		}
+		if n := len(p.lookups()); n != 1 {
+			t.Errorf("%s : %d appels au fournisseur, attendu 1", tt.name, n)
+		}
+	}
+}
+
+func TestEntrepriseSearchUnsupportedProvider(t *testing.T) {
+	useStubProvider(t, danone)
+	w := serve(entrepriseSearchHandler, http.MethodGet, "/api/entreprise/search?q=danone", "")
+	if w.Code != http.StatusNotImplemented || decodeAPIError(t, w).Code != "SEARCH_UNSUPPORTED" {
+		t.Errorf("statut = %d (%s), attendu 501 SEARCH_UNSUPPORTED", w.Code, w.Body)
+	}
+}
+
+func TestNewCompanyProvider(t *testing.T) {
+	for name, want := range map[string]string{"": "societe", "societe": "societe", "insee": "insee"} {
+		p, err := newCompanyProvider(name)
+		if err != nil || p.Name() != want {
+			t.Errorf("newCompanyProvider(%q) = %v, %v, attendu %s", name, p, err, want)
+		}
+	}
+	if _, err := newCompanyProvider("infogreffe"); err == nil {
+		t.Error("newCompanyProvider(\"infogreffe\") : erreur attendue")
+	}
+}
+
+// countingServer démarre un faux societe.com qui compte les connexions TCP ouvertes
+func countingServer(tb testing.TB) *atomic.Int64 {
+	tb.Helper()
+	var conns atomic.Int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"common":{"siren":"552032534","deno":"DANONE"}}`))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	tb.Cleanup(srv.Close)
+	tb.Setenv("SOCIETE_API_BASE", srv.URL)
+	tb.Setenv("UPSTREAM_MAX_RETRIES", "1")
+	return &conns
+}
+
+func TestUpstreamClientReusesConnections(t *testing.T) {
+	conns := countingServer(t)
+
+	for range 50 {
+		if _, err := fetchSocieteExistData(context.Background(), "552032534", entrepriseFields{}); err != nil {
+			t.Fatalf("fetchSocieteExistData: %v", err)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("%d connexions pour 50 appels successifs, attendu 1 (keep-alive)", n)
+	}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			for range 20 {
+				if _, err := fetchSocieteExistData(context.Background(), "552032534", entrepriseFields{}); err != nil {
+					t.Errorf("fetchSocieteExistData: %v", err)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	if n := conns.Load(); n > 10 {
+		t.Errorf("%d connexions pour 100 appels sur 5 goroutines, attendu au plus UPSTREAM_MAX_IDLE_CONNS_PER_HOST (10)", n)
+	}
+}
+
+// BenchmarkFetchSocieteExistData compare le client partagé à un client
+// neuf par appel (connexions ouvertes par appel : conns/op)
+func BenchmarkFetchSocieteExistData(b *testing.B) {
+	b.Run("client partagé", func(b *testing.B) {
+		conns := countingServer(b)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				fetchSocieteExistData(context.Background(), "552032534", entrepriseFields{})
+			}
+		})
+		b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+	})
+
+	b.Run("client par appel", func(b *testing.B) {
+		conns := countingServer(b)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				client := &http.Client{Timeout: upstreamHTTPClient.Timeout, Transport: &http.Transport{}}
+				req, _ := http.NewRequest(http.MethodGet, societeAPIBase()+"/entreprise/552032534/exist", nil)
+				if resp, err := client.Do(req); err == nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+				client.CloseIdleConnections()
+			}
+		})
+		b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+	})
+}
+
+func TestUpstreamRetryOn503(t *testing.T) {
+	var calls atomic.Int64
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			http.Error(w, "indisponible", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"common":{"siren":"552032534","deno":"DANONE"}}`))
+	})
+	t.Setenv("UPSTREAM_MAX_RETRIES", "3")
+
+	got, err := fetchSocieteExistData(context.Background(), "552032534", entrepriseFields{})
+	if err != nil || got.Denomination != "DANONE" {
+		t.Fatalf("fetchSocieteExistData = %+v, %v, attendu DANONE après deux 503", got, err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("%d appels, attendu 3", n)
+	}
+}
+
+func TestUpstreamRetryNever4xx(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusNotFound, http.StatusTooManyRequests} {
+		var calls atomic.Int64
+		useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			http.Error(w, "refus", status)
+		})
+		t.Setenv("UPSTREAM_MAX_RETRIES", "3")
+
+		if _, err := fetchSocieteExistData(context.Background(), "552032534", entrepriseFields{}); err == nil {
+			t.Errorf("statut %d : erreur attendue", status)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("statut %d : %d appels, attendu 1 (pas de nouvel essai)", status, n)
+		}
+	}
+}
+
+func TestUpstreamRetryRespectsDeadline(t *testing.T) {
+	var calls atomic.Int64
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamRetryBaseDelay/4)
+	defer cancel()
+
+	start := time.Now()
+	err := withUpstreamRetry(ctx, "test", func() error {
+		calls.Add(1)
+		return &upstreamStatusError{status: http.StatusBadGateway}
+	})
+	if err == nil || calls.Load() != 1 {
+		t.Errorf("err = %v après %d appels, attendu l'échec du premier appel sans attente au-delà de l'échéance", err, calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed > upstreamRetryBaseDelay/2 {
+		t.Errorf("retour après %v, au-delà de l'échéance du contexte", elapsed)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- PROBE DE DISPONIBILITÉ (/ready) ---
+
+// ReadyResponse détaille l'état de chaque dépendance ("ok" ou "unavailable").
+// La route n'est pas authentifiée : le détail des erreurs (noms d'hôtes,
+// adresses internes) reste dans les logs.
+type ReadyResponse struct {
+	Status string            `json:"status"` // "ready" ou "not_ready"
+	Checks map[string]string `json:"checks"`
+}
+
+// CompanyPinger est implémenté par les fournisseurs capables de vérifier
+// qu'ils sont joignables
+type CompanyPinger interface {
+	Ping(ctx context.Context) error
+}
+
+// readinessCache mémorise le dernier résultat des vérifications pendant
+// READY_CACHE_TTL, pour ne pas solliciter SMTP et l'API à chaque sonde
+type readinessCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	checked time.Time
+	result  ReadyResponse
+}
+
+var readiness = &readinessCache{ttl: envDuration("READY_CACHE_TTL", 10*time.Second)}
+
+// readyHandler répond 200 si SMTP et le fournisseur de données entreprise
+// sont joignables, 503 sinon. /health reste une simple sonde de vivacité.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	result := readiness.check(r.Context())
+	status := http.StatusOK
+	if result.Status != "ready" {
+		loggerFromContext(r.Context()).Warn("service non prêt", "checks", result.Checks)
+		status = http.StatusServiceUnavailable
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (c *readinessCache) check(ctx context.Context) ReadyResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checked.IsZero() && time.Since(c.checked) < c.ttl {
+		return c.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	checks := make(map[string]string)
+	record := func(name string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		checks[name] = "ok"
+		if err != nil {
+			loggerFromContext(ctx).Warn("dépendance indisponible", "dependency", name, "error", err)
+			checks[name] = "unavailable"
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Go(func() { record("smtp", checkSMTP(ctx)) })
+	if pinger, ok := companyProvider.(CompanyPinger); ok {
+		wg.Go(func() { record(companyProvider.Name(), pinger.Ping(ctx)) })
+	}
+	wg.Wait()
+
+	result := ReadyResponse{Status: "ready", Checks: checks}
+	for _, v := range checks {
+		if v != "ok" {
+			result.Status = "not_ready"
+		}
+	}
+
+	c.result = result
+	c.checked = time.Now()
+	return result
+}
+
+// DependencyCheck : résultat et durée d'une vérification de dépendance
+type DependencyCheck struct {
+	Status    string  `json:"status"` // "ok" ou le message d'erreur
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// dependencyCache mémorise le dernier diagnostic de /health?verbose=1
+// pendant READY_CACHE_TTL : chaque appel ouvre sinon une connexion SMTP et
+// interroge l'API entreprise
+type dependencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	checked time.Time
+	result  map[string]DependencyCheck
+}
+
+var dependencies = &dependencyCache{ttl: readiness.ttl}
+
+func (c *dependencyCache) check(ctx context.Context) map[string]DependencyCheck {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checked.IsZero() && time.Since(c.checked) < c.ttl {
+		return c.result
+	}
+	c.result = checkDependencies(ctx)
+	c.checked = time.Now()
+	return c.result
+}
+
+// checkDependencies mesure la latence vers SMTP et le fournisseur de
+// données entreprise (voir dependencyCache)
+func checkDependencies(ctx context.Context) map[string]DependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	checks := map[string]func(context.Context) error{"smtp": checkSMTP}
+	if pinger, ok := companyProvider.(CompanyPinger); ok {
+		checks[companyProvider.Name()] = pinger.Ping
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]DependencyCheck)
+	for name, check := range checks {
+		wg.Go(func() {
+			start := time.Now()
+			err := check(ctx)
+			result := DependencyCheck{Status: "ok", LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				result.Status = err.Error()
+			}
+
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// checkSMTP vérifie que le serveur SMTP accepte les connexions TCP
+func checkSMTP(ctx context.Context) error {
+	host, port := getenv("SMTP_HOST"), getenv("SMTP_PORT")
+	if host == "" || port == "" {
+		return errSMTPNotConfigured
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// pingUpstream vérifie qu'une API répond. Toute réponse HTTP hors 5xx
+// (y compris 401/404 sur la racine) prouve qu'elle est joignable.
+func pingUpstream(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := upstreamHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return &upstreamStatusError{status: resp.StatusCode}
+	}
+	return nil
+}
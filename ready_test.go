@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useFreshReadiness vide le cache des sondes /ready et /health?verbose=1
+func useFreshReadiness(t *testing.T) {
+	t.Helper()
+	previousReady, previousDeps := readiness, dependencies
+	readiness = &readinessCache{ttl: time.Minute}
+	dependencies = &dependencyCache{ttl: time.Minute}
+	t.Cleanup(func() { readiness, dependencies = previousReady, previousDeps })
+}
+
+// closedPort retourne un port local sur lequel plus rien n'écoute
+func closedPort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+	return port
+}
+
+func decodeReady(t *testing.T, w *httptest.ResponseRecorder) ReadyResponse {
+	t.Helper()
+	var resp ReadyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("réponse /ready illisible: %v", err)
+	}
+	return resp
+}
+
+func TestReadyAllDependenciesUp(t *testing.T) {
+	useFreshReadiness(t)
+	useSocieteProvider(t)
+	useFakeSMTP(t)
+	// La racine de l'API répond 404 : elle est joignable
+	useSocieteFixture(t, http.NotFound)
+
+	w := serve(readyHandler, http.MethodGet, "/ready", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	resp := decodeReady(t, w)
+	if resp.Status != "ready" || resp.Checks["smtp"] != "ok" || resp.Checks["societe"] != "ok" {
+		t.Errorf("réponse = %+v, attendu smtp et societe ok", resp)
+	}
+}
+
+func TestReadyDependencyDown(t *testing.T) {
+	tests := []struct {
+		name     string
+		smtpDown bool
+		upstream http.HandlerFunc
+		failing  string
+	}{
+		{"SMTP injoignable", true, http.NotFound, "smtp"},
+		{"API en erreur 503", false, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}, "societe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFreshReadiness(t)
+			useSocieteProvider(t)
+			useFakeSMTP(t)
+			if tt.smtpDown {
+				t.Setenv("SMTP_PORT", closedPort(t))
+			}
+			useSocieteFixture(t, tt.upstream)
+
+			w := serve(readyHandler, http.MethodGet, "/ready", "")
+			if w.Code != http.StatusServiceUnavailable {
+				t.Fatalf("statut = %d (%s), attendu 503", w.Code, w.Body)
+			}
+			body := w.Body.String()
+			resp := decodeReady(t, w)
+			if resp.Status != "not_ready" || resp.Checks[tt.failing] != "unavailable" {
+				t.Errorf("réponse = %+v, attendu %s unavailable", resp, tt.failing)
+			}
+			// Route publique : aucun détail d'erreur (hôte, adresse, port)
+			if strings.Contains(body, "127.0.0.1") || strings.Contains(body, getenv("SMTP_PORT")) {
+				t.Errorf("réponse = %s, détail de l'erreur exposé", body)
+			}
+
+			// /health reste une sonde de vivacité
+			if w := serve(healthHandler, http.MethodGet, "/health", ""); w.Code != http.StatusOK {
+				t.Errorf("/health : statut = %d, attendu 200", w.Code)
+			}
+		})
+	}
+}
+
+func TestReadyCachesResult(t *testing.T) {
+	useFreshReadiness(t)
+	useSocieteProvider(t)
+	useFakeSMTP(t)
+	var pings atomic.Int64
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		pings.Add(1)
+		http.NotFound(w, r)
+	})
+
+	for range 3 {
+		if w := serve(readyHandler, http.MethodGet, "/ready", ""); w.Code != http.StatusOK {
+			t.Fatalf("statut = %d (%s), attendu 200", w.Code, w.Body)
+		}
+	}
+	if n := pings.Load(); n != 1 {
+		t.Errorf("%d appels à l'API, attendu 1 (résultat en cache pendant READY_CACHE_TTL)", n)
+	}
+}
+
+func TestHealthVerboseDependencies(t *testing.T) {
+	useFreshReadiness(t)
+	useSocieteProvider(t)
+	useFakeSMTP(t)
+	var pings atomic.Int64
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		pings.Add(1)
+		time.Sleep(5 * time.Millisecond)
+		http.NotFound(w, r)
+	})
+	t.Setenv("API_KEY", "")
+
+	// Par défaut : réponse courte, sans aucune vérification
+	w := serve(healthHandler, http.MethodGet, "/health", "")
+	if strings.Contains(w.Body.String(), "dependencies") || pings.Load() != 0 {
+		t.Errorf("réponse par défaut = %s, attendu sans dépendances", w.Body)
+	}
+
+	w = serve(healthHandler, http.MethodGet, "/health?verbose=1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s)", w.Code, w.Body)
+	}
+	var resp struct {
+		Status       string                    `json:"status"`
+		Dependencies map[string]map[string]any `json:"dependencies"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("réponse illisible: %v", err)
+	}
+	for _, name := range []string{"smtp", "societe"} {
+		dep, ok := resp.Dependencies[name]
+		if !ok {
+			t.Errorf("dépendance %s absente : %+v", name, resp.Dependencies)
+			continue
+		}
+		latency, ok := dep["latency_ms"].(float64)
+		if dep["status"] != "ok" || !ok || latency < 0 {
+			t.Errorf("%s = %v, attendu status ok et latency_ms", name, dep)
+		}
+	}
+	if latency, _ := resp.Dependencies["societe"]["latency_ms"].(float64); latency < 5 {
+		t.Errorf("latence societe = %vms, attendu au moins 5ms", latency)
+	}
+
+	// Diagnostic en cache : pas de nouvel appel à l'API
+	serve(healthHandler, http.MethodGet, "/health?verbose=1", "")
+	if n := pings.Load(); n != 1 {
+		t.Errorf("%d appels à l'API, attendu 1", n)
+	}
+}
+
+func TestHealthVerboseRequiresAPIKey(t *testing.T) {
+	useFreshReadiness(t)
+	useSocieteProvider(t)
+	useFakeSMTP(t)
+	useSocieteFixture(t, http.NotFound)
+	t.Setenv("API_KEY", "cle-secrete")
+
+	w := serve(healthHandler, http.MethodGet, "/health?verbose=1", "")
+	if w.Code != http.StatusUnauthorized || strings.Contains(w.Body.String(), "dependencies") {
+		t.Errorf("sans clé : statut = %d (%s), attendu 401 sans dépendances", w.Code, w.Body)
+	}
+	// La sonde de vivacité reste publique
+	if w := serve(healthHandler, http.MethodGet, "/health", ""); w.Code != http.StatusOK {
+		t.Errorf("/health sans clé : statut = %d, attendu 200", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/health?verbose=1", nil)
+	r.Header.Set("X-API-Key", "cle-secrete")
+	w = httptest.NewRecorder()
+	healthHandler(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"latency_ms"`) {
+		t.Errorf("avec clé : statut = %d (%s), attendu les latences", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- RENVOI D'UN EMAIL DU JOURNAL ---
+
+// Corps (optionnel) de POST /api/emails/{id}/resend
+type EmailResendRequest struct {
+	To Recipients `json:"to" validate:"singleline,emaillist"` // Destinataires de remplacement (ceux d'origine sinon)
+}
+
+// emailResendHandler renvoie un message du journal des envois, tel quel, aux
+// destinataires d'origine ou à ceux fournis. Le message n'est disponible que
+// s'il a été conservé (EMAIL_LOG_KEEP_CONTENT=1 au moment de l'envoi).
+func emailResendHandler(w http.ResponseWriter, r *http.Request, rawID string) {
+	logger := loggerFromContext(r.Context())
+
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil || id < 1 {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Identifiant d'envoi invalide")
+		return
+	}
+
+	var req EmailResendRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", "Requête trop volumineuse")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "JSON invalide")
+		return
+	}
+	if errs := validateStruct(req); len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	entry, err := sentEmails.Get(id)
+	switch {
+	case errors.Is(err, errEmailLogEntryNotFound):
+		writeError(w, http.StatusNotFound, "EMAIL_NOT_FOUND", "Envoi absent du journal")
+		return
+	case err != nil:
+		logger.Error("lecture du journal des envois impossible", "error", err)
+		writeError(w, http.StatusInternalServerError, "EMAIL_LOG_UNAVAILABLE", "Journal des envois indisponible")
+		return
+	}
+	if entry.Message == nil {
+		writeError(w, http.StatusGone, "EMAIL_CONTENT_NOT_RETAINED",
+			"Le contenu de cet envoi n'a pas été conservé (EMAIL_LOG_KEEP_CONTENT=1 requis au moment de l'envoi)")
+		return
+	}
+
+	smtpCfg := loadSMTPConfig()
+	if !requireSMTPConfig(w, logger, "/api/emails/{id}/resend", smtpCfg) {
+		return
+	}
+
+	to := entry.To
+	if req.To != "" {
+		to = recipientAddresses(string(req.To))
+	}
+	msg := resentMessage(entry.Message, fromHeader(smtpCfg.user), to, mailNow())
+	out := smtpCfg.outgoing(to, entry.Subject, msg)
+
+	if !waitSMTPSlot(w, r, logger, "/api/emails/{id}/resend") {
+		return
+	}
+	defer releaseSMTPSlot()
+
+	logger.Info("renvoi d'un email du journal", "route", "/api/emails/{id}/resend", "id", id, "to", to)
+	results, err := out.send(logger)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "SMTP_SEND_FAILED", "Échec de l'envoi : "+err.Error())
+		return
+	}
+
+	if len(rejectedRecipients(results)) > 0 {
+		w.WriteHeader(http.StatusMultiStatus)
+		json.NewEncoder(w).Encode(map[string]any{
+			"message":    "Email renvoyé partiellement",
+			"recipients": results,
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email renvoyé avec succès"})
+}
+
+// resentMessage ajoute au message d'origine les en-têtes Resent-* (RFC 5322
+// section 3.6.6) : les en-têtes d'origine (To, Date, Message-ID...) restent
+// inchangés, le renvoi est identifié par son propre Resent-Message-ID
+func resentMessage(msg []byte, from string, to []string, now time.Time) []byte {
+	resent := fmt.Sprintf("Resent-Date: %s\r\nResent-From: %s\r\nResent-To: %s\r\nResent-Message-ID: %s\r\n",
+		now.Format(time.RFC1123Z), from, strings.Join(to, ", "), newMessageID(from))
+	return append([]byte(resent), msg...)
+}
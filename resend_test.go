@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// sendAndLog envoie un email et retourne son identifiant dans le journal
+func sendAndLog(t *testing.T, body string) int64 {
+	t.Helper()
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body); w.Code != http.StatusOK {
+		t.Fatalf("envoi : statut = %d (%s)", w.Code, w.Body)
+	}
+	resp := decodeEmailLog(t, "/api/emails?limit=1")
+	if len(resp.Results) != 1 {
+		t.Fatalf("envoi absent du journal : %+v", resp)
+	}
+	return resp.Results[0].ID
+}
+
+func resend(id, body string) *httptest.ResponseRecorder {
+	return serve(emailJobHandler, http.MethodPost, "/api/emails/"+id+"/resend", body)
+}
+
+func TestEmailResend(t *testing.T) {
+	s := useFakeSMTP(t)
+	useEmailLog(t, newMemoryEmailLog(10))
+	t.Setenv("EMAIL_LOG_KEEP_CONTENT", "1")
+
+	id := strconv.FormatInt(sendAndLog(t, `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`), 10)
+
+	// Destinataires d'origine
+	if w := resend(id, ""); w.Code != http.StatusOK {
+		t.Fatalf("renvoi : statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	// Destinataires de remplacement
+	if w := resend(id, `{"to":"Comptabilité <compta@exemple.fr>"}`); w.Code != http.StatusOK {
+		t.Fatalf("renvoi à compta : statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+
+	mails := s.received()
+	if len(mails) != 3 {
+		t.Fatalf("%d messages reçus, attendu 3", len(mails))
+	}
+	original := parseEmail(t, mails[0].data)
+	for i, wantTo := range []string{"client@exemple.fr", "compta@exemple.fr"} {
+		mail := mails[i+1]
+		if !slices.Equal(mail.to, []string{wantTo}) {
+			t.Errorf("renvoi %d : RCPT TO = %v, attendu %s", i, mail.to, wantTo)
+		}
+		msg := parseEmail(t, mail.data)
+		// En-têtes d'origine inchangés, renvoi identifié par les en-têtes Resent-*
+		if msg.Header.Get("Message-ID") != original.Header.Get("Message-ID") || msg.Header.Get("To") != original.Header.Get("To") {
+			t.Errorf("renvoi %d : en-têtes d'origine modifiés : %v", i, msg.Header)
+		}
+		resentID := msg.Header.Get("Resent-Message-ID")
+		if resentID == "" || resentID == original.Header.Get("Message-ID") {
+			t.Errorf("renvoi %d : Resent-Message-ID = %q, attendu un nouvel identifiant", i, resentID)
+		}
+		if got := msg.Header.Get("Resent-To"); got != wantTo {
+			t.Errorf("renvoi %d : Resent-To = %q, attendu %s", i, got, wantTo)
+		}
+		if msg.Header.Get("Resent-Date") == "" || msg.Header.Get("Resent-From") == "" {
+			t.Errorf("renvoi %d : Resent-Date ou Resent-From absent", i)
+		}
+	}
+}
+
+func TestEmailResendErrors(t *testing.T) {
+	useFakeSMTP(t)
+	useEmailLog(t, newMemoryEmailLog(10))
+
+	// Contenu non conservé au moment de l'envoi
+	t.Setenv("EMAIL_LOG_KEEP_CONTENT", "")
+	id := strconv.FormatInt(sendAndLog(t, `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`), 10)
+	w := resend(id, "")
+	if w.Code != http.StatusGone || decodeAPIError(t, w).Code != "EMAIL_CONTENT_NOT_RETAINED" {
+		t.Errorf("contenu non conservé : statut = %d (%s), attendu 410", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name, id, body string
+		status         int
+		code           string
+	}{
+		{"envoi inconnu", "999", "", http.StatusNotFound, "EMAIL_NOT_FOUND"},
+		{"identifiant invalide", "abc", "", http.StatusBadRequest, "INVALID_ID"},
+		{"destinataire invalide", id, `{"to":"pas une adresse"}`, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{"champ inconnu", id, `{"cc":"a@exemple.fr"}`, http.StatusBadRequest, "INVALID_JSON"},
+	}
+	for _, tt := range tests {
+		w := resend(tt.id, tt.body)
+		if w.Code != tt.status || decodeAPIError(t, w).Code != tt.code {
+			t.Errorf("%s : statut = %d (%s), attendu %d %s", tt.name, w.Code, w.Body, tt.status, tt.code)
+		}
+	}
+	if w := serve(emailJobHandler, http.MethodGet, "/api/emails/"+id+"/resend", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET : statut = %d, attendu 405", w.Code)
+	}
+}
+
+func TestEmailResendRequiresAPIKey(t *testing.T) {
+	s := useFakeSMTP(t)
+	useEmailLog(t, newMemoryEmailLog(10))
+	t.Setenv("EMAIL_LOG_KEEP_CONTENT", "1")
+	id := strconv.FormatInt(sendAndLog(t, `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`), 10)
+
+	handler := newTestHandler(t)
+	t.Setenv("API_KEY", "cle-secrete")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/emails/"+id+"/resend", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("sans clé : statut = %d, attendu 401", w.Code)
+	}
+	if n := len(s.received()); n != 1 {
+		t.Errorf("%d messages reçus, attendu 1 (renvoi refusé)", n)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --- RECHERCHE D'ENTREPRISES PAR NOM ---
+
+const (
+	defaultSearchPerPage = 20
+	maxSearchPerPage     = 100
+)
+
+// Candidat retourné par GET /api/entreprise/search
+type EntrepriseCandidate struct {
+	Denomination string `json:"denomination"`
+	Siren        string `json:"siren"`
+	Ville        string `json:"ville"`
+}
+
+type EntrepriseSearchResponse struct {
+	Results []EntrepriseCandidate `json:"results"`
+	Page    int                   `json:"page"`
+	PerPage int                   `json:"per_page"`
+	Total   int                   `json:"total"`
+}
+
+func entrepriseSearchHandler(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "MISSING_QUERY", "Le paramètre 'q' (nom de l'entreprise) est requis")
+		return
+	}
+
+	page, err := queryInt(r, "page", 1)
+	if err != nil || page < 1 {
+		writeError(w, http.StatusBadRequest, "INVALID_PAGINATION", "Le paramètre 'page' doit être un entier positif")
+		return
+	}
+	perPage, err := queryInt(r, "per_page", defaultSearchPerPage)
+	if err != nil || perPage < 1 || perPage > maxSearchPerPage {
+		writeError(w, http.StatusBadRequest, "INVALID_PAGINATION",
+			fmt.Sprintf("Le paramètre 'per_page' doit être compris entre 1 et %d", maxSearchPerPage))
+		return
+	}
+
+	logger.Info("recherche entreprise par nom", "route", "/api/entreprise/search", "q", q, "page", page)
+
+	searcher, ok := companyProvider.(CompanySearcher)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "SEARCH_UNSUPPORTED",
+			"La recherche par nom n'est pas disponible avec le fournisseur "+companyProvider.Name())
+		return
+	}
+
+	results, err := searcher.Search(r.Context(), q, page, perPage)
+	if err != nil {
+		logger.Error("échec recherche entreprise par nom", "route", "/api/entreprise/search", "q", q, "error", err)
+		writeUpstreamError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
+
+// queryInt lit un paramètre entier de la query string (def si absent)
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
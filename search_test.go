@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+)
+
+// useSocieteProvider sélectionne le fournisseur societe.com le temps du test
+func useSocieteProvider(t *testing.T) {
+	t.Helper()
+	previous := companyProvider
+	companyProvider = societeProvider{}
+	t.Cleanup(func() { companyProvider = previous })
+}
+
+func TestEntrepriseSearchFixture(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/societe_search.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	useSocieteProvider(t)
+
+	var query map[string]string
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/entreprise/search" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		query = map[string]string{"nom": q.Get("nom"), "page": q.Get("page"), "per_page": q.Get("per_page")}
+		w.Write(fixture)
+	})
+
+	w := serve(entrepriseSearchHandler, http.MethodGet, "/api/entreprise/search?q=danone&page=2&per_page=3", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	if query["nom"] != "danone" || query["page"] != "2" || query["per_page"] != "3" {
+		t.Errorf("paramètres transmis à societe.com = %v", query)
+	}
+
+	var got EntrepriseSearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Total != 3 || got.Page != 2 || got.PerPage != 3 || len(got.Results) != 3 {
+		t.Fatalf("réponse = %+v", got)
+	}
+	if want := (EntrepriseCandidate{"DANONE", "552032534", "PARIS"}); got.Results[0] != want {
+		t.Errorf("premier candidat = %+v, attendu %+v", got.Results[0], want)
+	}
+}
+
+func TestEntrepriseSearchEmpty(t *testing.T) {
+	useSocieteProvider(t)
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	w := serve(entrepriseSearchHandler, http.MethodGet, "/api/entreprise/search?q=introuvable", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if results, ok := raw["results"].([]any); !ok || len(results) != 0 {
+		t.Errorf("results = %v, attendu un tableau vide (et non null)", raw["results"])
+	}
+}
+
+func TestEntrepriseSearchValidation(t *testing.T) {
+	tests := []struct {
+		target string
+		code   string
+	}{
+		{"/api/entreprise/search", "MISSING_QUERY"},
+		{"/api/entreprise/search?q=+", "MISSING_QUERY"},
+		{"/api/entreprise/search?q=danone&page=0", "INVALID_PAGINATION"},
+		{"/api/entreprise/search?q=danone&per_page=101", "INVALID_PAGINATION"},
+		{"/api/entreprise/search?q=danone&per_page=abc", "INVALID_PAGINATION"},
+	}
+	for _, tt := range tests {
+		w := serve(entrepriseSearchHandler, http.MethodGet, tt.target, "")
+		if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != tt.code {
+			t.Errorf("%s : statut = %d (%s), attendu 400 %s", tt.target, w.Code, w.Body, tt.code)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// --- ENVOI SMTP ---
+
+// Délai avant la première nouvelle tentative (doublé à chaque essai)
+const smtpRetryBaseDelay = 500 * time.Millisecond
+
+// sendMailWithRetry envoie le message (SSL implicite sur le port 465,
+// STARTTLS sinon) en retentant les échecs temporaires avec un backoff
+// exponentiel. Le nombre d'essais est configurable via SMTP_MAX_RETRIES.
+// Le résultat par destinataire est retourné avec la dernière tentative.
+// Avec dsn, des avis de remise (DSN) sont demandés si le serveur les gère.
+func sendMailWithRetry(addr string, auth smtp.Auth, from string, to []string, msg []byte, dsn bool) ([]RecipientResult, error) {
+	maxAttempts := smtpMaxAttempts()
+
+	_, port, _ := net.SplitHostPort(addr)
+	delay := smtpRetryBaseDelay
+
+	var results []RecipientResult
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		// GESTION SSL (Port 465) vs STARTTLS (587)
+		if port == "465" {
+			slog.Info("connexion SMTP SSL implicite (port 465)", "attempt", attempt, "max_attempts", maxAttempts)
+			results, err = sendMail465(addr, auth, from, to, msg, dsn)
+		} else {
+			slog.Info("connexion SMTP STARTTLS", "attempt", attempt, "max_attempts", maxAttempts)
+			results, err = sendMailStartTLS(addr, auth, from, to, msg, dsn)
+		}
+
+		if err == nil || !isRetryableSMTPError(err) || attempt == maxAttempts {
+			return results, err
+		}
+
+		slog.Warn("échec temporaire SMTP, nouvel essai", "attempt", attempt, "error", err, "retry_in", delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return results, err
+}
+
+// isRetryableSMTPError distingue les erreurs temporaires (réseau, codes 4xx)
+// des rejets définitifs (authentification, codes 5xx) qu'il est inutile de
+// retenter
+func isRetryableSMTPError(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 400 && protoErr.Code < 500
+	}
+
+	// Connexion coupée en cours de dialogue
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Fonction utilitaire pour gérer le SSL (Port 465)
+func sendMail465(addr string, auth smtp.Auth, from string, to []string, msg []byte, dsn bool) ([]RecipientResult, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	timeout := smtpTimeout()
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: false,
+		ServerName:         host,
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Délai global pour tout le dialogue SMTP : un serveur bloqué ne doit
+	// pas suspendre la requête indéfiniment
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return deliverMail(client, auth, from, to, msg, dsn)
+}
+
+// Erreur retournée quand le serveur ne propose pas STARTTLS (non retentée)
+var errSTARTTLSUnavailable = errors.New("le serveur SMTP ne propose pas STARTTLS (définir SMTP_ALLOW_INSECURE=1 pour autoriser l'envoi en clair)")
+
+// sendMailStartTLS se connecte puis exige STARTTLS avant l'authentification,
+// en appliquant le délai SMTP_TIMEOUT à la connexion et au dialogue
+func sendMailStartTLS(addr string, auth smtp.Auth, from string, to []string, msg []byte, dsn bool) ([]RecipientResult, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	timeout := smtpTimeout()
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	// Sans TLS, les identifiants circuleraient en clair : le serveur doit
+	// proposer STARTTLS, sauf dérogation explicite SMTP_ALLOW_INSECURE=1
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return nil, err
+		}
+	} else if getenv("SMTP_ALLOW_INSECURE") == "1" {
+		slog.Warn("serveur SMTP sans STARTTLS : envoi en clair (SMTP_ALLOW_INSECURE=1)", "host", host)
+	} else {
+		return nil, errSTARTTLSUnavailable
+	}
+
+	return deliverMail(client, auth, from, to, msg, dsn)
+}
+
+// RecipientResult : acceptation d'un destinataire par le serveur SMTP (RCPT TO)
+type RecipientResult struct {
+	Address  string `json:"address"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// errAllRecipientsRejected : aucun destinataire accepté, message non transmis
+var errAllRecipientsRejected = errors.New("tous les destinataires ont été refusés")
+
+// deliverMail authentifie le client puis transmet l'enveloppe et le message.
+// Un destinataire refusé (RCPT TO) n'interrompt pas l'envoi aux autres : le
+// message part vers les destinataires acceptés et le résultat de chacun est
+// retourné.
+func deliverMail(client *smtp.Client, auth smtp.Auth, from string, to []string, msg []byte, dsn bool) ([]RecipientResult, error) {
+	var err error
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err = client.Auth(auth); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Avis de remise (RFC 3461) : paramètres ajoutés à MAIL FROM et RCPT TO,
+	// que net/smtp ne sait pas transmettre
+	if dsn {
+		if ok, _ := client.Extension("DSN"); !ok {
+			slog.Warn("le serveur SMTP ne gère pas les avis de remise (DSN), envoi sans")
+			dsn = false
+		}
+	}
+
+	if dsn {
+		err = smtpCmd(client, 250, "MAIL FROM:<%s> RET=HDRS", from)
+	} else {
+		err = client.Mail(from)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RecipientResult, 0, len(to))
+	var lastRejection error
+	for _, addr := range to {
+		if dsn {
+			err = smtpCmd(client, 25, "RCPT TO:<%s> NOTIFY=SUCCESS,FAILURE,DELAY ORCPT=rfc822;%s", addr, xtext(addr))
+		} else {
+			err = client.Rcpt(addr)
+		}
+		if err != nil {
+			// Seul un refus du serveur concerne ce destinataire ; une erreur
+			// réseau interrompt tout l'envoi
+			var protoErr *textproto.Error
+			if !errors.As(err, &protoErr) {
+				return nil, err
+			}
+			slog.Warn("destinataire refusé par le serveur SMTP", "to", addr, "error", err)
+			results = append(results, RecipientResult{Address: addr, Error: err.Error()})
+			lastRejection = err
+			continue
+		}
+		results = append(results, RecipientResult{Address: addr, Accepted: true})
+	}
+	if lastRejection != nil && acceptedCount(results) == 0 {
+		client.Reset()
+		return results, fmt.Errorf("%w : %w", errAllRecipientsRejected, lastRejection)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// DATA accepté : le message est parti. Un échec de QUIT (connexion
+	// coupée) ne doit pas déclencher de nouvel essai, sous peine de doublon.
+	if err := client.Quit(); err != nil {
+		slog.Warn("échec de QUIT après l'acceptation du message (ignoré)", "error", err)
+	}
+	return results, nil
+}
+
+// smtpCmd envoie une commande SMTP brute et vérifie le code de réponse
+// (même convention que textproto.Conn.ReadResponse : 25 accepte 250-259).
+// Les adresses sont validées en amont : aucun CR/LF ne peut s'y glisser.
+func smtpCmd(client *smtp.Client, expectCode int, format string, args ...any) error {
+	id, err := client.Text.Cmd(format, args...)
+	if err != nil {
+		return err
+	}
+	client.Text.StartResponse(id)
+	defer client.Text.EndResponse(id)
+	_, _, err = client.Text.ReadResponse(expectCode)
+	return err
+}
+
+// xtext encode une valeur de paramètre DSN (RFC 3461 section 4) : "+", "="
+// et les caractères hors ASCII visible deviennent "+XX" (ex: a+tag -> a+2Btag)
+func xtext(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x21 || c > 0x7e || c == '+' || c == '=' {
+			fmt.Fprintf(&b, "+%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// acceptedCount compte les destinataires acceptés
+func acceptedCount(results []RecipientResult) int {
+	n := 0
+	for _, r := range results {
+		if r.Accepted {
+			n++
+		}
+	}
+	return n
+}
+
+// smtpAuth choisit le mécanisme d'authentification : SMTP_AUTH (plain ou
+// login) s'il est défini, sinon PLAIN si le serveur le propose, puis LOGIN,
+// et PLAIN par défaut
+type smtpAuth struct {
+	username, password, host string
+	mechanism                string // "plain", "login" ou vide (automatique)
+	login                    bool   // mécanisme LOGIN retenu pour cette session
+}
+
+func newSMTPAuth(username, password, host string) *smtpAuth {
+	return &smtpAuth{
+		username:  username,
+		password:  password,
+		host:      host,
+		mechanism: strings.ToLower(getenv("SMTP_AUTH")),
+	}
+}
+
+func (a *smtpAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Avec SMTP_ALLOW_INSECURE=1, l'authentification en clair est assumée
+	info := *server
+	if getenv("SMTP_ALLOW_INSECURE") == "1" {
+		info.TLS = true
+	}
+
+	mechanism := a.mechanism
+	if mechanism == "" {
+		mechanism = selectAuthMechanism(server.Auth)
+	}
+
+	a.login = mechanism == "login"
+	if !a.login {
+		return smtp.PlainAuth("", a.username, a.password, a.host).Start(&info)
+	}
+
+	// Mêmes garde-fous que smtp.PlainAuth : pas d'identifiants en clair
+	if !info.TLS && info.Name != "localhost" && info.Name != "127.0.0.1" && info.Name != "::1" {
+		return "", nil, errors.New("connexion non chiffrée : authentification LOGIN refusée")
+	}
+	if info.Name != a.host {
+		return "", nil, errors.New("nom d'hôte SMTP inattendu")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *smtpAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	if !a.login {
+		return nil, errors.New("défi inattendu du serveur SMTP")
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:", "user name", "username":
+		return []byte(a.username), nil
+	case "password:", "password":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("défi LOGIN inattendu : %q", fromServer)
+	}
+}
+
+// selectAuthMechanism retient PLAIN si le serveur le propose, sinon LOGIN,
+// et PLAIN à défaut d'information
+func selectAuthMechanism(advertised []string) string {
+	hasLogin := false
+	for _, m := range advertised {
+		switch strings.ToUpper(m) {
+		case "PLAIN":
+			return "plain"
+		case "LOGIN":
+			hasLogin = true
+		}
+	}
+	if hasLogin {
+		return "login"
+	}
+	return "plain"
+}
+
+// --- CONFIGURATION SMTP (ENV) ---
+
+// smtpConfig : serveur et compte d'envoi (SMTP_HOST, SMTP_PORT,
+// SMTP_ADMIN_EMAIL, SMTP_PASS)
+type smtpConfig struct {
+	host, port, user, pass string
+}
+
+func loadSMTPConfig() smtpConfig {
+	return smtpConfig{
+		host: getenv("SMTP_HOST"),
+		port: getenv("SMTP_PORT"),
+		user: getenv("SMTP_ADMIN_EMAIL"),
+		pass: getenv("SMTP_PASS"),
+	}
+}
+
+// complete indique si toutes les variables nécessaires à l'envoi sont définies
+func (c smtpConfig) complete() bool {
+	return c.host != "" && c.port != "" && c.user != "" && c.pass != ""
+}
+
+// outgoing prépare un message à transmettre avec ce compte. L'enveloppe SMTP
+// n'accepte que l'adresse nue, sans nom affiché.
+func (c smtpConfig) outgoing(to []string, subject string, msg []byte) outgoingEmail {
+	return outgoingEmail{
+		addr:    c.host + ":" + c.port,
+		auth:    newSMTPAuth(c.user, c.pass, c.host),
+		from:    c.user,
+		to:      to,
+		subject: subject,
+		msg:     msg,
+	}
+}
+
+// smtpTimeout retourne le délai maximal de connexion et de dialogue SMTP
+func smtpTimeout() time.Duration {
+	return envDuration("SMTP_TIMEOUT", 15*time.Second)
+}
+
+// smtpMaxAttempts retourne le nombre d'essais d'envoi (SMTP_MAX_RETRIES, au
+// moins 1)
+func smtpMaxAttempts() int {
+	return max(envInt("SMTP_MAX_RETRIES", 3), 1)
+}
+
+// smtpSlotTimeout retourne l'attente maximale d'une place d'envoi libre
+// (SMTP_SLOT_TIMEOUT)
+func smtpSlotTimeout() time.Duration {
+	return envDuration("SMTP_SLOT_TIMEOUT", 10*time.Second)
+}
+
+// --- LIMITE D'ENVOIS SIMULTANÉS ---
+
+var errSMTPBusy = errors.New("trop d'envois SMTP simultanés")
+
+// smtpSlots limite le nombre de connexions SMTP ouvertes en même temps
+// (SMTP_MAX_CONCURRENT), pour ne pas dépasser la limite du fournisseur
+var smtpSlots = make(chan struct{}, max(envInt("SMTP_MAX_CONCURRENT", 5), 1))
+
+// acquireSMTPSlot attend une place libre jusqu'à l'annulation de ctx
+func acquireSMTPSlot(ctx context.Context) error {
+	select {
+	case smtpSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errSMTPBusy
+	}
+}
+
+func releaseSMTPSlot() {
+	<-smtpSlots
+}
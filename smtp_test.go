@@ -0,0 +1,695 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMail : message reçu par le serveur SMTP de test
+type fakeMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP est un serveur SMTP minimal, en clair, pour les tests d'envoi :
+// EHLO, AUTH PLAIN/LOGIN, MAIL, RCPT, DATA, RSET et QUIT
+type fakeSMTP struct {
+	ln net.Listener
+
+	mu         sync.Mutex
+	failFirst  int             // connexions refusées d'emblée (421)
+	extensions []string        // extensions annoncées en réponse à EHLO
+	rejected   map[string]bool // destinataires refusés (550)
+	dataDelay  time.Duration   // attente avant d'accepter un message
+	conns      int
+	active     int // connexions ouvertes
+	maxActive  int // pic de connexions simultanées
+	commands   []string
+	auth       []string // mécanisme et identifiants reçus
+	messages   []fakeMail
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeSMTP{
+		ln:         ln,
+		extensions: []string{"AUTH PLAIN LOGIN", "8BITMIME"},
+		rejected:   make(map[string]bool),
+	}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+// useFakeSMTP démarre un serveur de test et y dirige la configuration SMTP
+func useFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	s := newFakeSMTP(t)
+	_, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", port)
+	t.Setenv("SMTP_ADMIN_EMAIL", "contact@vintagestandards.fr")
+	t.Setenv("SMTP_PASS", "secret")
+	t.Setenv("SMTP_ALLOW_INSECURE", "1")
+	t.Setenv("SMTP_MAX_RETRIES", "1")
+	return s
+}
+
+// failConnections refuse les n premières connexions (421)
+func (s *fakeSMTP) failConnections(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failFirst = n
+}
+
+// setExtensions remplace les extensions annoncées en réponse à EHLO
+func (s *fakeSMTP) setExtensions(ext ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.extensions = ext
+}
+
+// reject fait refuser addr à RCPT TO (550)
+func (s *fakeSMTP) reject(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected[addr] = true
+}
+
+// slowDown retarde l'acceptation de chaque message de d
+func (s *fakeSMTP) slowDown(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dataDelay = d
+}
+
+// peakConns retourne le nombre maximal de connexions ouvertes en même temps
+func (s *fakeSMTP) peakConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxActive
+}
+
+func (s *fakeSMTP) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeSMTP) connCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+func (s *fakeSMTP) received() []fakeMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeMail(nil), s.messages...)
+}
+
+func (s *fakeSMTP) commandLog() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *fakeSMTP) authLog() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.auth...)
+}
+
+func (s *fakeSMTP) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTP) handle(nc net.Conn) {
+	defer nc.Close()
+	c := textproto.NewConn(nc)
+
+	s.mu.Lock()
+	s.conns++
+	s.active++
+	s.maxActive = max(s.maxActive, s.active)
+	refuse := s.conns <= s.failFirst
+	extensions := s.extensions
+	delay := s.dataDelay
+	s.mu.Unlock()
+	// Session terminée avant la réponse à QUIT : le client qui la reçoit peut
+	// libérer sa place d'envoi sans fausser le pic de connexions
+	endSession := sync.OnceFunc(func() {
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	})
+	defer endSession()
+
+	if refuse {
+		c.PrintfLine("421 service temporairement indisponible")
+		return
+	}
+	c.PrintfLine("220 fake.smtp ESMTP")
+
+	var mail fakeMail
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			c.PrintfLine("250-fake.smtp")
+			for _, ext := range extensions {
+				c.PrintfLine("250-%s", ext)
+			}
+			c.PrintfLine("250 HELP")
+		case "HELO":
+			c.PrintfLine("250 fake.smtp")
+		case "AUTH":
+			s.authenticate(c, arg)
+		case "MAIL":
+			mail = fakeMail{from: envelopeAddress(arg)}
+			c.PrintfLine("250 OK")
+		case "RCPT":
+			to := envelopeAddress(arg)
+			s.mu.Lock()
+			rejected := s.rejected[to]
+			s.mu.Unlock()
+			if rejected {
+				c.PrintfLine("550 destinataire inconnu")
+				continue
+			}
+			mail.to = append(mail.to, to)
+			c.PrintfLine("250 OK")
+		case "DATA":
+			c.PrintfLine("354 fin avec <CRLF>.<CRLF>")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			mail.data = string(data)
+			time.Sleep(delay)
+			s.mu.Lock()
+			s.messages = append(s.messages, mail)
+			s.mu.Unlock()
+			c.PrintfLine("250 OK message accepté")
+		case "RSET":
+			mail = fakeMail{}
+			c.PrintfLine("250 OK")
+		case "NOOP":
+			c.PrintfLine("250 OK")
+		case "QUIT":
+			endSession()
+			c.PrintfLine("221 au revoir")
+			return
+		default:
+			c.PrintfLine("502 commande non gérée")
+		}
+	}
+}
+
+// authenticate gère AUTH PLAIN (réponse initiale) et AUTH LOGIN (défis)
+func (s *fakeSMTP) authenticate(c *textproto.Conn, arg string) {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	var creds []string
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		raw, _ := base64.StdEncoding.DecodeString(initial)
+		creds = strings.Split(string(raw), "\x00")
+	case "LOGIN":
+		for _, prompt := range []string{"Username:", "Password:"} {
+			c.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			raw, _ := base64.StdEncoding.DecodeString(line)
+			creds = append(creds, string(raw))
+		}
+	default:
+		c.PrintfLine("504 mécanisme non géré")
+		return
+	}
+	s.mu.Lock()
+	s.auth = append([]string{strings.ToUpper(mechanism)}, creds...)
+	s.mu.Unlock()
+	c.PrintfLine("235 authentifié")
+}
+
+// envelopeAddress extrait l'adresse de "FROM:<a@b> ..." ou "TO:<a@b> ..."
+func envelopeAddress(arg string) string {
+	_, rest, _ := strings.Cut(arg, "<")
+	addr, _, _ := strings.Cut(rest, ">")
+	return addr
+}
+
+func TestSendMailWithRetryTemporaryFailures(t *testing.T) {
+	s := useFakeSMTP(t)
+	s.failConnections(2)
+	t.Setenv("SMTP_MAX_RETRIES", "3")
+
+	auth := newSMTPAuth("contact@vintagestandards.fr", "secret", "127.0.0.1")
+	start := time.Now()
+	results, err := sendMailWithRetry(s.addr(), auth, "contact@vintagestandards.fr", []string{"client@exemple.fr"}, []byte("Subject: test\r\n\r\nBonjour\r\n"), false)
+	if err != nil {
+		t.Fatalf("sendMailWithRetry: %v", err)
+	}
+	if n := s.connCount(); n != 3 {
+		t.Errorf("%d connexions, attendu 3 (deux échecs 421 puis succès)", n)
+	}
+	// Backoff exponentiel : 500ms puis 1s
+	if elapsed := time.Since(start); elapsed < 3*smtpRetryBaseDelay {
+		t.Errorf("envoi réussi en %v, attendu au moins %v de backoff", elapsed, 3*smtpRetryBaseDelay)
+	}
+	if len(results) != 1 || !results[0].Accepted {
+		t.Errorf("résultats = %+v, attendu un destinataire accepté", results)
+	}
+	if got := s.received(); len(got) != 1 || !strings.Contains(got[0].data, "Bonjour") {
+		t.Errorf("messages reçus = %+v, attendu un seul message", got)
+	}
+}
+
+func TestSendMailWithRetryGivesUp(t *testing.T) {
+	s := useFakeSMTP(t)
+	s.failConnections(5)
+	t.Setenv("SMTP_MAX_RETRIES", "2")
+
+	_, err := sendMailWithRetry(s.addr(), nil, "contact@vintagestandards.fr", []string{"client@exemple.fr"}, []byte("Bonjour\r\n"), false)
+	if err == nil || !isRetryableSMTPError(err) {
+		t.Fatalf("err = %v, attendu l'erreur temporaire 421", err)
+	}
+	if n := s.connCount(); n != 2 {
+		t.Errorf("%d connexions, attendu 2 (SMTP_MAX_RETRIES)", n)
+	}
+}
+
+func TestIsRetryableSMTPError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&textproto.Error{Code: 421, Msg: "occupé"}, true},
+		{&textproto.Error{Code: 451, Msg: "erreur locale"}, true},
+		{&textproto.Error{Code: 535, Msg: "authentification refusée"}, false},
+		{&textproto.Error{Code: 550, Msg: "boîte inconnue"}, false},
+		{errSTARTTLSUnavailable, false},
+		{&net.OpError{Op: "dial", Err: net.UnknownNetworkError("tcp")}, true},
+	}
+	for _, tt := range tests {
+		if got := isRetryableSMTPError(tt.err); got != tt.want {
+			t.Errorf("isRetryableSMTPError(%v) = %v, attendu %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// silentListener accepte les connexions sans jamais répondre
+func silentListener(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				for _, c := range conns {
+					c.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestSMTPTimeoutOnSilentServer(t *testing.T) {
+	t.Setenv("SMTP_TIMEOUT", "200ms")
+	addr := silentListener(t)
+
+	senders := map[string]func(string, smtp.Auth, string, []string, []byte, bool) ([]RecipientResult, error){
+		"STARTTLS":  sendMailStartTLS,
+		"SSL (465)": sendMail465,
+	}
+	for name, send := range senders {
+		start := time.Now()
+		_, err := send(addr, nil, "contact@vintagestandards.fr", []string{"client@exemple.fr"}, []byte("Bonjour\r\n"), false)
+		elapsed := time.Since(start)
+
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Errorf("%s : err = %v, attendu un délai dépassé", name, err)
+		}
+		if elapsed > 2*time.Second {
+			t.Errorf("%s : abandon après %v, attendu environ SMTP_TIMEOUT (200ms)", name, elapsed)
+		}
+	}
+}
+
+func TestSendMailRequiresSTARTTLS(t *testing.T) {
+	s := useFakeSMTP(t)
+	t.Setenv("SMTP_ALLOW_INSECURE", "")
+	t.Setenv("SMTP_MAX_RETRIES", "3")
+
+	auth := newSMTPAuth("contact@vintagestandards.fr", "secret", "127.0.0.1")
+	_, err := sendMailWithRetry(s.addr(), auth, "contact@vintagestandards.fr", []string{"client@exemple.fr"}, []byte("Bonjour\r\n"), false)
+	if !errors.Is(err, errSTARTTLSUnavailable) {
+		t.Fatalf("err = %v, attendu errSTARTTLSUnavailable", err)
+	}
+	// Refus définitif : pas de nouvel essai, ni identifiants ni message transmis
+	if n := s.connCount(); n != 1 {
+		t.Errorf("%d connexions, attendu 1", n)
+	}
+	for _, cmd := range s.commandLog() {
+		if verb, _, _ := strings.Cut(cmd, " "); verb == "AUTH" || verb == "MAIL" {
+			t.Errorf("commande %q envoyée en clair", cmd)
+		}
+	}
+
+	// STARTTLS annoncé mais refusé par le serveur : pas de repli en clair
+	s.setExtensions("STARTTLS", "AUTH PLAIN LOGIN")
+	if _, err := sendMailStartTLS(s.addr(), auth, "contact@vintagestandards.fr", []string{"client@exemple.fr"}, []byte("Bonjour\r\n"), false); err == nil {
+		t.Error("envoi réussi alors que STARTTLS a échoué")
+	}
+	if len(s.received()) != 0 || len(s.authLog()) != 0 {
+		t.Error("message ou identifiants transmis sans TLS")
+	}
+}
+
+func TestSendMailAllowInsecure(t *testing.T) {
+	s := useFakeSMTP(t)
+
+	auth := newSMTPAuth("contact@vintagestandards.fr", "secret", "127.0.0.1")
+	if _, err := sendMailStartTLS(s.addr(), auth, "contact@vintagestandards.fr", []string{"client@exemple.fr"}, []byte("Bonjour\r\n"), false); err != nil {
+		t.Fatalf("SMTP_ALLOW_INSECURE=1 : %v", err)
+	}
+	if len(s.received()) != 1 {
+		t.Errorf("%d messages reçus, attendu 1", len(s.received()))
+	}
+}
+
+func TestSendEmailWithoutSTARTTLS(t *testing.T) {
+	useFakeSMTP(t)
+	t.Setenv("SMTP_ALLOW_INSECURE", "")
+
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`)
+	if w.Code != http.StatusInternalServerError || decodeAPIError(t, w).Code != "SMTP_SEND_FAILED" {
+		t.Errorf("statut = %d (%s), attendu 500 SMTP_SEND_FAILED", w.Code, w.Body)
+	}
+}
+
+func TestSMTPAuthMechanism(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions string
+		override   string
+		want       string
+	}{
+		{"AUTH LOGIN seul", "AUTH LOGIN", "", "LOGIN"},
+		{"PLAIN préféré", "AUTH LOGIN PLAIN", "", "PLAIN"},
+		{"SMTP_AUTH=login", "AUTH PLAIN LOGIN", "login", "LOGIN"},
+		{"SMTP_AUTH=plain", "AUTH PLAIN LOGIN", "PLAIN", "PLAIN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := useFakeSMTP(t)
+			s.setExtensions(tt.extensions)
+			t.Setenv("SMTP_AUTH", tt.override)
+
+			auth := newSMTPAuth("contact@vintagestandards.fr", "secret", "127.0.0.1")
+			if _, err := sendMailStartTLS(s.addr(), auth, "contact@vintagestandards.fr", []string{"client@exemple.fr"}, []byte("Bonjour\r\n"), false); err != nil {
+				t.Fatalf("envoi : %v", err)
+			}
+			got := s.authLog()
+			if len(got) == 0 || got[0] != tt.want {
+				t.Fatalf("authentification = %q, attendu %s", got, tt.want)
+			}
+			// PLAIN : identité d'autorisation vide, puis identifiants
+			if creds := got[len(got)-2:]; creds[0] != "contact@vintagestandards.fr" || creds[1] != "secret" {
+				t.Errorf("identifiants reçus = %q", creds)
+			}
+		})
+	}
+}
+
+func TestSelectAuthMechanism(t *testing.T) {
+	tests := []struct {
+		advertised []string
+		want       string
+	}{
+		{[]string{"PLAIN", "LOGIN"}, "plain"},
+		{[]string{"LOGIN", "PLAIN"}, "plain"},
+		{[]string{"login"}, "login"},
+		{[]string{"CRAM-MD5", "LOGIN"}, "login"},
+		{[]string{"XOAUTH2"}, "plain"},
+		{nil, "plain"},
+	}
+	for _, tt := range tests {
+		if got := selectAuthMechanism(tt.advertised); got != tt.want {
+			t.Errorf("selectAuthMechanism(%q) = %q, attendu %q", tt.advertised, got, tt.want)
+		}
+	}
+}
+
+func TestSMTPAuthLoginRequiresTLS(t *testing.T) {
+	t.Setenv("SMTP_AUTH", "login")
+	auth := newSMTPAuth("contact@vintagestandards.fr", "secret", "smtp.exemple.fr")
+
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.exemple.fr", Auth: []string{"LOGIN"}}); err == nil {
+		t.Error("LOGIN accepté sur une connexion non chiffrée")
+	}
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "autre.exemple.fr", TLS: true, Auth: []string{"LOGIN"}}); err == nil {
+		t.Error("LOGIN accepté pour un hôte inattendu")
+	}
+
+	mechanism, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.exemple.fr", TLS: true, Auth: []string{"LOGIN"}})
+	if err != nil || mechanism != "LOGIN" {
+		t.Fatalf("Start = %q, %v, attendu LOGIN", mechanism, err)
+	}
+	for challenge, want := range map[string]string{"Username:": "contact@vintagestandards.fr", "Password:": "secret"} {
+		if got, err := auth.Next([]byte(challenge), true); err != nil || string(got) != want {
+			t.Errorf("Next(%q) = %q, %v, attendu %q", challenge, got, err, want)
+		}
+	}
+	if _, err := auth.Next([]byte("Code secret :"), true); err == nil {
+		t.Error("défi inconnu accepté")
+	}
+}
+
+// useSMTPSlots remplace la limite d'envois simultanés (SMTP_MAX_CONCURRENT,
+// lue au démarrage) le temps du test
+func useSMTPSlots(t *testing.T, n int) {
+	t.Helper()
+	previous := smtpSlots
+	smtpSlots = make(chan struct{}, n)
+	t.Cleanup(func() { smtpSlots = previous })
+}
+
+func TestSMTPMaxConcurrent(t *testing.T) {
+	s := useFakeSMTP(t)
+	s.slowDown(30 * time.Millisecond)
+	useSMTPSlots(t, 2)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 6)
+	for i := range codes {
+		wg.Go(func() {
+			w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`)
+			codes[i] = w.Code
+		})
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("envoi %d : statut = %d, attendu 200 (attente d'une place libre)", i, code)
+		}
+	}
+	if peak := s.peakConns(); peak > 2 {
+		t.Errorf("%d connexions SMTP simultanées, attendu au plus 2", peak)
+	}
+	if n := len(s.received()); n != len(codes) {
+		t.Errorf("%d messages reçus, attendu %d", n, len(codes))
+	}
+}
+
+func TestSMTPBusy(t *testing.T) {
+	s := useFakeSMTP(t)
+	useSMTPSlots(t, 1)
+	t.Setenv("SMTP_SLOT_TIMEOUT", "20ms")
+
+	// Place occupée par un autre envoi
+	smtpSlots <- struct{}{}
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`)
+	if w.Code != http.StatusServiceUnavailable || decodeAPIError(t, w).Code != "SMTP_BUSY" {
+		t.Fatalf("statut = %d (%s), attendu 503 SMTP_BUSY", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Retry-After = %q, attendu 5", got)
+	}
+	if n := s.connCount(); n != 0 {
+		t.Errorf("%d connexions SMTP ouvertes malgré la limite", n)
+	}
+
+	// Place libérée : l'envoi passe, et rend sa place ensuite
+	releaseSMTPSlot()
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour"}`); w.Code != http.StatusOK {
+		t.Errorf("place libre : statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	if n := len(smtpSlots); n != 0 {
+		t.Errorf("%d places encore occupées après l'envoi", n)
+	}
+}
+
+func TestSendEmailPartialDelivery(t *testing.T) {
+	s := useFakeSMTP(t)
+	s.reject("inconnu@exemple.fr")
+
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":["client@exemple.fr","inconnu@exemple.fr"],"subject":"Devis","body":"Bonjour"}`)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("statut = %d (%s), attendu 207", w.Code, w.Body)
+	}
+	var resp struct {
+		MessageID  string            `json:"message_id"`
+		Recipients []RecipientResult `json:"recipients"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("réponse illisible: %v", err)
+	}
+	want := map[string]bool{"client@exemple.fr": true, "inconnu@exemple.fr": false}
+	if len(resp.Recipients) != len(want) || resp.MessageID == "" {
+		t.Fatalf("réponse = %+v, attendu un résultat par destinataire", resp)
+	}
+	for _, r := range resp.Recipients {
+		if accepted, ok := want[r.Address]; !ok || r.Accepted != accepted || (!accepted && !strings.Contains(r.Error, "550")) {
+			t.Errorf("résultat %+v inattendu", r)
+		}
+	}
+
+	// Message remis au destinataire accepté uniquement
+	mails := s.received()
+	if len(mails) != 1 || !slices.Equal(mails[0].to, []string{"client@exemple.fr"}) {
+		t.Errorf("messages reçus = %+v, attendu un envoi à client@exemple.fr", mails)
+	}
+}
+
+func TestSendEmailAllRecipientsRejected(t *testing.T) {
+	s := useFakeSMTP(t)
+	s.reject("inconnu@exemple.fr")
+	s.reject("absent@exemple.fr")
+
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":["inconnu@exemple.fr","absent@exemple.fr"],"subject":"Devis","body":"Bonjour"}`)
+	if w.Code != http.StatusInternalServerError || decodeAPIError(t, w).Code != "SMTP_SEND_FAILED" {
+		t.Errorf("statut = %d (%s), attendu 500 SMTP_SEND_FAILED", w.Code, w.Body)
+	}
+	if n := len(s.received()); n != 0 {
+		t.Errorf("%d messages transmis sans destinataire accepté", n)
+	}
+	if cmds := strings.Join(s.commandLog(), "\n"); strings.Contains(cmds, "DATA") {
+		t.Error("DATA envoyé alors que tous les destinataires ont été refusés")
+	}
+}
+
+func TestXtext(t *testing.T) {
+	tests := map[string]string{
+		"client@exemple.fr":       "client@exemple.fr",
+		"client+devis@exemple.fr": "client+2Bdevis@exemple.fr",
+		"a=b@exemple.fr":          "a+3Db@exemple.fr",
+		"é@exemple.fr":            "+C3+A9@exemple.fr",
+	}
+	for input, want := range tests {
+		if got := xtext(input); got != want {
+			t.Errorf("xtext(%q) = %q, attendu %q", input, got, want)
+		}
+	}
+}
+
+func TestSendEmailRequestDSN(t *testing.T) {
+	s := useFakeSMTP(t)
+	s.setExtensions("AUTH PLAIN LOGIN", "DSN")
+
+	body := `{"to":"client+devis@exemple.fr","subject":"Devis","body":"Bonjour","request_dsn":true}`
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body); w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s)", w.Code, w.Body)
+	}
+	cmds := s.commandLog()
+	for _, want := range []string{
+		"MAIL FROM:<contact@vintagestandards.fr> RET=HDRS",
+		"RCPT TO:<client+devis@exemple.fr> NOTIFY=SUCCESS,FAILURE,DELAY ORCPT=rfc822;client+2Bdevis@exemple.fr",
+	} {
+		if !slices.Contains(cmds, want) {
+			t.Errorf("commande %q absente : %q", want, cmds)
+		}
+	}
+
+	// Serveur sans extension DSN : envoi normal, sans paramètres
+	s = useFakeSMTP(t)
+	if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body); w.Code != http.StatusOK {
+		t.Fatalf("sans DSN : statut = %d (%s)", w.Code, w.Body)
+	}
+	for _, cmd := range s.commandLog() {
+		if strings.Contains(cmd, "NOTIFY=") || strings.Contains(cmd, "RET=") {
+			t.Errorf("sans DSN : commande %q avec paramètres DSN", cmd)
+		}
+	}
+	if n := len(s.received()); n != 1 {
+		t.Errorf("sans DSN : %d messages reçus, attendu 1", n)
+	}
+}
+
+func TestSendEmailRequestMDN(t *testing.T) {
+	s := useFakeSMTP(t)
+
+	tests := []struct {
+		extra string
+		want  string
+	}{
+		{`"request_mdn":true,"notify_address":"Suivi <suivi@exemple.fr>"`, `"Suivi" <suivi@exemple.fr>`},
+		{`"request_mdn":true,"reply_to":"sav@exemple.fr"`, "<sav@exemple.fr>"},
+		{`"request_mdn":true`, "<contact@vintagestandards.fr>"},
+		{`"notify_address":"suivi@exemple.fr"`, ""},
+	}
+	for i, tt := range tests {
+		body := `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour",` + tt.extra + `}`
+		if w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body); w.Code != http.StatusOK {
+			t.Fatalf("%s : statut = %d (%s)", tt.extra, w.Code, w.Body)
+		}
+		if got := parseEmail(t, s.received()[i].data).Header.Get("Disposition-Notification-To"); got != tt.want {
+			t.Errorf("%s : Disposition-Notification-To = %q, attendu %q", tt.extra, got, tt.want)
+		}
+	}
+
+	// Adresse de notification invalide : refusée
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", `{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour","request_mdn":true,"notify_address":"suivi"}`)
+	if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != "VALIDATION_FAILED" {
+		t.Errorf("notify_address invalide : statut = %d (%s), attendu 400 VALIDATION_FAILED", w.Code, w.Body)
+	}
+}
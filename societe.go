@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// --- FOURNISSEUR SOCIETE.COM ---
+
+// Token fictif utilisé en DEV_MODE=1 quand SOCIETE_API_TOKEN est absent :
+// l'API le refuse, aucun vrai token ne doit figurer dans le code
+const devFallbackAPIToken = "dev-token-non-valide"
+
+// URL de base par défaut de l'API societe.com (voir SOCIETE_API_BASE)
+const defaultSocieteAPIBase = "https://api.societe.com/api/v1"
+
+// Structure interne API Societe.com (/exist)
+type SocieteExistResponse struct {
+	Common struct {
+		Siren      string `json:"siren"`
+		SiretSiege string `json:"siretsiege"`
+		NumTVA     string `json:"numtva"`
+		Deno       string `json:"deno"`
+		Status     string `json:"status"`
+		ImmatInsee string `json:"immatinsee"`
+	} `json:"common"`
+}
+
+// Structure interne API Societe.com (/infoslegales)
+type SocieteInfosLegalesResponse struct {
+	Data struct {
+		Siege struct {
+			Adresse    string `json:"adresse"`
+			CodePostal string `json:"codepostal"`
+			Ville      string `json:"ville"`
+		} `json:"siege"`
+	} `json:"data"`
+}
+
+// Structure interne API Societe.com (/entreprise/search)
+type SocieteSearchResponse struct {
+	Data struct {
+		Total   int `json:"total"`
+		Results []struct {
+			Deno  string `json:"deno"`
+			Siren string `json:"siren"`
+			Ville string `json:"ville"`
+		} `json:"results"`
+	} `json:"data"`
+}
+
+// societeProvider interroge l'API societe.com (fournisseur par défaut)
+type societeProvider struct{}
+
+func (societeProvider) Name() string { return "societe" }
+
+func (societeProvider) Lookup(ctx context.Context, numid string, fields entrepriseFields) (*EntrepriseResponse, error) {
+	return fetchSocieteExistData(ctx, numid, fields)
+}
+
+func (societeProvider) Search(ctx context.Context, q string, page, perPage int) (*EntrepriseSearchResponse, error) {
+	return searchSocieteEntreprises(ctx, q, page, perPage)
+}
+
+func (societeProvider) Ping(ctx context.Context) error {
+	return pingUpstream(ctx, societeAPIBase()+"/")
+}
+
+// societeAPIToken retourne le token societe.com depuis l'environnement
+// (SOCIETE_API_TOKEN), ou le token historique si DEV_MODE=1
+func societeAPIToken() string {
+	if token := getenv("SOCIETE_API_TOKEN"); token != "" {
+		return token
+	}
+	if getenv("DEV_MODE") == "1" {
+		return devFallbackAPIToken
+	}
+	return ""
+}
+
+// societeAPIBase retourne l'URL de base de l'API societe.com, surchargeable
+// via SOCIETE_API_BASE (ex: serveur de test local)
+func societeAPIBase() string {
+	if base := getenv("SOCIETE_API_BASE"); base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	return defaultSocieteAPIBase
+}
+
+// callSocieteAPI interroge un endpoint societe.com pour un SIREN/SIRET
+// (ex: "exist", "infoslegales") et retourne le corps brut de la réponse
+func callSocieteAPI(ctx context.Context, numid, endpoint string) ([]byte, error) {
+	return societeRequest(ctx, fmt.Sprintf("entreprise/%s/%s", numid, endpoint), nil)
+}
+
+// societeRequest effectue un GET authentifié sur l'API societe.com
+// (chemin relatif à /api/v1/) et retourne le corps brut de la réponse.
+// Les erreurs temporaires (502/503/504, réseau) sont retentées, et les
+// pannes répétées ouvrent le disjoncteur (societeBreaker).
+// L'appel est annulé avec ctx (ex: déconnexion du client).
+func societeRequest(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	endpointURL := societeAPIBase() + "/" + path
+	if len(query) > 0 {
+		endpointURL += "?" + query.Encode()
+	}
+
+	// Fournisseur en panne : échec immédiat plutôt qu'attendre le timeout
+	if err := societeBreaker.allow(); err != nil {
+		return nil, err
+	}
+
+	var bodyBytes []byte
+	err := withUpstreamRetry(ctx, "societe.com", func() error {
+		var err error
+		bodyBytes, err = societeRequestOnce(ctx, endpointURL, path)
+		return err
+	})
+	societeBreaker.record(err)
+	if err != nil {
+		return nil, err
+	}
+
+	// Corps brut uniquement en LOG_LEVEL=debug : il contient des données
+	// entreprise et alourdit les logs
+	slog.Debug("réponse API brute", "path", path, "body", string(bodyBytes))
+
+	return bodyBytes, nil
+}
+
+// societeRequestOnce effectue une seule tentative d'appel à l'API societe.com
+func societeRequestOnce(ctx context.Context, endpointURL, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpointURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-Authorization", "socapi "+societeAPIToken())
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := upstreamHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "" {
+		slog.Debug("quota API societe.com", "path", path, "remaining", remaining)
+	}
+
+	if resp.StatusCode == 404 {
+		return nil, errEntrepriseIntrouvable
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+		slog.Warn("quota API societe.com dépassé", "path", path, "retry_after", retryAfter)
+		return nil, &upstreamRateLimitError{provider: "societe.com", retryAfter: retryAfter}
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, &upstreamStatusError{status: resp.StatusCode, body: string(bodyBytes)}
+	}
+
+	return bodyBytes, nil
+}
+
+func fetchSocieteExistData(ctx context.Context, numid string, fields entrepriseFields) (*EntrepriseResponse, error) {
+	bodyBytes, err := callSocieteAPI(ctx, numid, "exist")
+	if err != nil {
+		return nil, err
+	}
+
+	var apiData SocieteExistResponse
+	if err := json.Unmarshal(bodyBytes, &apiData); err != nil {
+		return nil, fmt.Errorf("erreur de décodage JSON : %v", err)
+	}
+
+	result := &EntrepriseResponse{}
+	result.Denomination = apiData.Common.Deno
+	result.Siren = apiData.Common.Siren
+	result.Siret = apiData.Common.SiretSiege
+	result.Status = mapSocieteStatus(apiData.Common.Status)
+	result.ImmatriculeeInsee = parseSocieteFlag(apiData.Common.ImmatInsee)
+	if fields.Tva {
+		result.Tva = apiData.Common.NumTVA
+	}
+
+	// L'endpoint /exist ne fournit pas l'adresse : appel secondaire à /infoslegales,
+	// uniquement si demandée. Un échec ici ne doit pas faire échouer toute la recherche.
+	if fields.Address {
+		result.AdressePostaleLegale = &AdressePostale{}
+		if err := fillAdresseLegale(ctx, numid, result); err != nil {
+			slog.Warn("adresse légale indisponible", "numid", numid, "error", err)
+		}
+	}
+
+	return result, nil
+}
+
+// mapSocieteStatus convertit le statut societe.com ("Actif", "Radié",
+// "En cessation d'activité"...) vers les statuts exposés par l'API
+func mapSocieteStatus(status string) string {
+	s := strings.ToLower(strings.TrimSpace(status))
+	switch {
+	case s == "":
+		return statutInconnu
+	case strings.Contains(s, "radi"):
+		return statutRadiee
+	case strings.Contains(s, "cess"), strings.Contains(s, "ferm"), strings.Contains(s, "liquid"):
+		return statutCessee
+	case strings.HasPrefix(s, "acti"), strings.Contains(s, "en activit"):
+		return statutActive
+	default:
+		return statutInconnu
+	}
+}
+
+// parseSocieteFlag interprète un indicateur societe.com ("1", "true",
+// "oui"...) ; toute autre valeur vaut faux
+func parseSocieteFlag(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "oui", "o", "yes", "y":
+		return true
+	default:
+		return false
+	}
+}
+
+// fillAdresseLegale complète l'adresse postale légale depuis /infoslegales
+func fillAdresseLegale(ctx context.Context, numid string, result *EntrepriseResponse) error {
+	bodyBytes, err := callSocieteAPI(ctx, numid, "infoslegales")
+	if err != nil {
+		return err
+	}
+
+	var apiData SocieteInfosLegalesResponse
+	if err := json.Unmarshal(bodyBytes, &apiData); err != nil {
+		return fmt.Errorf("erreur de décodage JSON : %v", err)
+	}
+
+	result.AdressePostaleLegale = &AdressePostale{
+		Ville:      apiData.Data.Siege.Ville,
+		CodePostal: apiData.Data.Siege.CodePostal,
+	}
+
+	return nil
+}
+
+// searchSocieteEntreprises recherche des entreprises par dénomination
+func searchSocieteEntreprises(ctx context.Context, q string, page, perPage int) (*EntrepriseSearchResponse, error) {
+	result := &EntrepriseSearchResponse{
+		Results: []EntrepriseCandidate{},
+		Page:    page,
+		PerPage: perPage,
+	}
+
+	query := url.Values{}
+	query.Set("nom", q)
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(perPage))
+
+	bodyBytes, err := societeRequest(ctx, "entreprise/search", query)
+	if errors.Is(err, errEntrepriseIntrouvable) {
+		// Aucun résultat : liste vide plutôt qu'une erreur
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var apiData SocieteSearchResponse
+	if err := json.Unmarshal(bodyBytes, &apiData); err != nil {
+		return nil, fmt.Errorf("erreur de décodage JSON : %v", err)
+	}
+
+	result.Total = apiData.Data.Total
+	for _, r := range apiData.Data.Results {
+		result.Results = append(result.Results, EntrepriseCandidate{
+			Denomination: r.Deno,
+			Siren:        r.Siren,
+			Ville:        r.Ville,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useSocieteFixture redirige les appels societe.com vers handler
+// (SOCIETE_API_BASE), sans nouvel essai et avec un disjoncteur neuf
+func useSocieteFixture(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	t.Setenv("SOCIETE_API_BASE", srv.URL)
+	t.Setenv("UPSTREAM_MAX_RETRIES", "1")
+
+	breaker := societeBreaker
+	societeBreaker = newCircuitBreaker("societe.com", 5, time.Minute)
+	t.Cleanup(func() { societeBreaker = breaker })
+	return srv
+}
+
+func TestSocieteAPITokenHeader(t *testing.T) {
+	t.Setenv("SOCIETE_API_TOKEN", "jeton-de-test")
+
+	var got string
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("X-Authorization")
+		w.Write([]byte(`{"common":{"siren":"552032534","deno":"DANONE"}}`))
+	})
+
+	if _, err := fetchSocieteExistData(context.Background(), "552032534", entrepriseFields{}); err != nil {
+		t.Fatalf("fetchSocieteExistData: %v", err)
+	}
+	if want := "socapi jeton-de-test"; got != want {
+		t.Errorf("X-Authorization = %q, attendu %q", got, want)
+	}
+}
+
+func TestSocieteAPITokenDevFallback(t *testing.T) {
+	t.Setenv("SOCIETE_API_TOKEN", "")
+
+	t.Setenv("DEV_MODE", "")
+	if got := societeAPIToken(); got != "" {
+		t.Errorf("sans DEV_MODE, token = %q, attendu vide", got)
+	}
+
+	t.Setenv("DEV_MODE", "1")
+	if got := societeAPIToken(); got != devFallbackAPIToken {
+		t.Errorf("avec DEV_MODE=1, token = %q, attendu %q", got, devFallbackAPIToken)
+	}
+}
+
+func TestFetchSocieteAddressFromInfosLegales(t *testing.T) {
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/entreprise/552032534/exist":
+			w.Write([]byte(`{"common":{"siren":"552032534","siretsiege":"55203253400646","deno":"DANONE","numtva":"FR27552032534","status":"Actif"}}`))
+		case "/entreprise/552032534/infoslegales":
+			w.Write([]byte(`{"data":{"siege":{"adresse":"17 BD HAUSSMANN","codepostal":"75009","ville":"PARIS"}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	got, err := fetchSocieteExistData(context.Background(), "552032534", allEntrepriseFields)
+	if err != nil {
+		t.Fatalf("fetchSocieteExistData: %v", err)
+	}
+	if got.AdressePostaleLegale == nil {
+		t.Fatal("adresse_postale_legale absente")
+	}
+	if got.AdressePostaleLegale.Ville != "PARIS" || got.AdressePostaleLegale.CodePostal != "75009" {
+		t.Errorf("adresse = %+v, attendu PARIS 75009", *got.AdressePostaleLegale)
+	}
+}
+
+func TestFetchSocieteAddressUnavailable(t *testing.T) {
+	// /infoslegales en erreur : la recherche aboutit, avec une adresse vide
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/entreprise/552032534/exist" {
+			w.Write([]byte(`{"common":{"siren":"552032534","deno":"DANONE"}}`))
+			return
+		}
+		http.Error(w, "indisponible", http.StatusInternalServerError)
+	})
+
+	got, err := fetchSocieteExistData(context.Background(), "552032534", allEntrepriseFields)
+	if err != nil {
+		t.Fatalf("fetchSocieteExistData: %v", err)
+	}
+	if got.AdressePostaleLegale == nil || *got.AdressePostaleLegale != (AdressePostale{}) {
+		t.Errorf("adresse = %+v, attendu une adresse vide", got.AdressePostaleLegale)
+	}
+}
+
+func TestFetchSocieteWithoutAddressField(t *testing.T) {
+	calls := 0
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"common":{"siren":"552032534","deno":"DANONE"}}`))
+	})
+
+	got, err := fetchSocieteExistData(context.Background(), "552032534", entrepriseFields{Tva: true})
+	if err != nil {
+		t.Fatalf("fetchSocieteExistData: %v", err)
+	}
+	if got.AdressePostaleLegale != nil || calls != 1 {
+		t.Errorf("adresse = %+v après %d appels, attendu aucune adresse ni appel à /infoslegales", got.AdressePostaleLegale, calls)
+	}
+}
+
+func TestFetchSocieteCancelled(t *testing.T) {
+	aborted := make(chan struct{})
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(aborted)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := fetchSocieteExistData(ctx, "552032534", allEntrepriseFields)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, attendu context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("appel interrompu après %v, attendu dès l'annulation", elapsed)
+	}
+
+	// Le serveur distant voit la connexion fermée
+	select {
+	case <-aborted:
+	case <-time.After(2 * time.Second):
+		t.Error("requête distante non interrompue après l'annulation")
+	}
+}
+
+func TestMapSocieteStatus(t *testing.T) {
+	tests := map[string]string{
+		"Actif":                     statutActive,
+		"ACTIVE":                    statutActive,
+		"En activité":               statutActive,
+		"Radié":                     statutRadiee,
+		"radiée du RCS":             statutRadiee,
+		"En cessation d'activité":   statutCessee,
+		"Cessée":                    statutCessee,
+		"Fermé":                     statutCessee,
+		"En liquidation judiciaire": statutCessee,
+		"":                          statutInconnu,
+		"   ":                       statutInconnu,
+		"Statut non communiqué":     statutInconnu,
+	}
+	for status, want := range tests {
+		if got := mapSocieteStatus(status); got != want {
+			t.Errorf("mapSocieteStatus(%q) = %q, attendu %q", status, got, want)
+		}
+	}
+}
+
+func TestFetchSocieteStatus(t *testing.T) {
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"common":{"siren":"552032534","deno":"DANONE","status":"Radié","immatinsee":"1"}}`))
+	})
+
+	got, err := fetchSocieteExistData(context.Background(), "552032534", entrepriseFields{})
+	if err != nil {
+		t.Fatalf("fetchSocieteExistData: %v", err)
+	}
+	if got.Status != statutRadiee || !got.ImmatriculeeInsee {
+		t.Errorf("status = %q, immatriculee_insee = %v, attendu %q et true", got.Status, got.ImmatriculeeInsee, statutRadiee)
+	}
+}
+
+func TestEntrepriseUpstreamRateLimited(t *testing.T) {
+	useSocieteProvider(t)
+	useFreshCompanyCache(t)
+	buf := captureLogs(t)
+
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "quota dépassé", http.StatusTooManyRequests)
+	})
+
+	w := serve(entrepriseHandler, http.MethodGet, "/api/entreprise/552032534", "")
+	if w.Code != http.StatusTooManyRequests || decodeAPIError(t, w).Code != "UPSTREAM_RATE_LIMITED" {
+		t.Fatalf("statut = %d (%s), attendu 429 UPSTREAM_RATE_LIMITED", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, attendu 30 (valeur du fournisseur)", got)
+	}
+	if !strings.Contains(buf.String(), `"remaining":"0"`) {
+		t.Errorf("quota restant (X-RateLimit-Remaining) non journalisé : %s", buf)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("120"); got != 2*time.Minute {
+		t.Errorf("parseRetryAfter(\"120\") = %v, attendu 2m", got)
+	}
+	date := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 80*time.Second || got > 90*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %v, attendu environ 90s", date, got)
+	}
+	for _, v := range []string{"", "0", "-5", "bientôt"} {
+		if got := parseRetryAfter(v); got != 0 {
+			t.Errorf("parseRetryAfter(%q) = %v, attendu 0", v, got)
+		}
+	}
+}
+
+func TestSocieteAPIBase(t *testing.T) {
+	t.Setenv("SOCIETE_API_BASE", "")
+	if got := societeAPIBase(); got != defaultSocieteAPIBase {
+		t.Errorf("sans SOCIETE_API_BASE : %q, attendu %q", got, defaultSocieteAPIBase)
+	}
+	t.Setenv("SOCIETE_API_BASE", "http://127.0.0.1:9000/api/v1/")
+	if got := societeAPIBase(); got != "http://127.0.0.1:9000/api/v1" {
+		t.Errorf("SOCIETE_API_BASE avec slash final : %q", got)
+	}
+}
+
+func TestEntrepriseHandlerAgainstLocalServer(t *testing.T) {
+	useSocieteProvider(t)
+	useFreshCompanyCache(t)
+
+	var paths []string
+	srv := useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"common":{"siren":"552032534","siretsiege":"55203253400646","deno":"DANONE","numtva":"FR27552032534","status":"Actif"}}`))
+	})
+	// Base avec un chemin : les endpoints lui sont relatifs
+	t.Setenv("SOCIETE_API_BASE", srv.URL+"/api/v1/")
+
+	w := serve(entrepriseHandler, http.MethodGet, "/api/entreprise/552032534?fields=tva", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	if data := decodeEntreprise(t, w); data.Denomination != "DANONE" || data.Tva != "FR27552032534" || data.Status != statutActive {
+		t.Errorf("réponse = %+v", data)
+	}
+	if len(paths) != 1 || paths[0] != "/api/v1/entreprise/552032534/exist" {
+		t.Errorf("chemins appelés = %v, attendu [/api/v1/entreprise/552032534/exist]", paths)
+	}
+}
+
+func TestParseSocieteFlag(t *testing.T) {
+	tests := map[string]bool{
+		"1": true, "true": true, "TRUE": true, "oui": true, "O": true, "yes": true, "y": true, " 1 ": true,
+		"0": false, "false": false, "non": false, "": false, "peut-être": false,
+	}
+	for v, want := range tests {
+		if got := parseSocieteFlag(v); got != want {
+			t.Errorf("parseSocieteFlag(%q) = %v, attendu %v", v, got, want)
+		}
+	}
+}
+
+func TestEntrepriseImmatriculeeInsee(t *testing.T) {
+	useSocieteProvider(t)
+
+	tests := []struct {
+		common string
+		want   bool
+	}{
+		{`"immatinsee":"1"`, true},
+		{`"immatinsee":"oui"`, true},
+		{`"immatinsee":"0"`, false},
+		{`"immatinsee":""`, false},
+		{`"deno":"DANONE"`, false}, // champ absent
+	}
+	for _, tt := range tests {
+		useFreshCompanyCache(t)
+		useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"common":{"siren":"552032534",` + tt.common + `}}`))
+		})
+
+		w := serve(entrepriseHandler, http.MethodGet, "/api/entreprise/552032534", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s : statut = %d (%s)", tt.common, w.Code, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), `"immatriculee_insee":`) {
+			t.Errorf("%s : champ immatriculee_insee absent de la réponse : %s", tt.common, w.Body)
+		}
+		if got := decodeEntreprise(t, w).ImmatriculeeInsee; got != tt.want {
+			t.Errorf("%s : immatriculee_insee = %v, attendu %v", tt.common, got, tt.want)
+		}
+	}
+}
+
+// useUpstreamTimeout remplace le délai du client HTTP amont (COMPANY_API_TIMEOUT)
+func useUpstreamTimeout(t *testing.T, d time.Duration) {
+	t.Helper()
+	previous := upstreamHTTPClient
+	upstreamHTTPClient = &http.Client{Timeout: d, Transport: &http.Transport{}}
+	t.Cleanup(func() { upstreamHTTPClient = previous })
+}
+
+// slowHandler répond après delay, ou abandonne si le client se déconnecte
+func slowHandler(delay time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+			w.Write([]byte(`{"common":{"siren":"552032534","deno":"DANONE"}}`))
+		case <-r.Context().Done():
+		}
+	}
+}
+
+func TestEntrepriseUpstreamTimeout(t *testing.T) {
+	useSocieteProvider(t)
+	useFreshCompanyCache(t)
+	useSocieteFixture(t, slowHandler(2*time.Second))
+	useUpstreamTimeout(t, 100*time.Millisecond)
+
+	start := time.Now()
+	w := serve(entrepriseHandler, http.MethodGet, "/api/entreprise/552032534", "")
+	if w.Code != http.StatusGatewayTimeout || decodeAPIError(t, w).Code != "UPSTREAM_TIMEOUT" {
+		t.Errorf("statut = %d (%s), attendu 504 UPSTREAM_TIMEOUT", w.Code, w.Body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("réponse après %v, attendu environ le délai du client (100ms)", elapsed)
+	}
+}
+
+func TestCompanyAPITimeoutPerAttempt(t *testing.T) {
+	var calls atomic.Int64
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		// Première tentative en erreur temporaire, la suivante trop lente
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		slowHandler(2*time.Second)(w, r)
+	})
+	t.Setenv("UPSTREAM_MAX_RETRIES", "3")
+	useUpstreamTimeout(t, 100*time.Millisecond)
+
+	start := time.Now()
+	_, err := fetchSocieteExistData(context.Background(), "552032534", entrepriseFields{})
+	elapsed := time.Since(start)
+	if !isUpstreamTimeout(err) {
+		t.Fatalf("erreur = %v, attendu un timeout", err)
+	}
+	// Délai complet pour la tentative retentée ; un timeout n'est pas
+	// retenté (le client attendrait sinon plusieurs fois le délai)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d tentatives, attendu 2", n)
+	}
+	if elapsed < 100*time.Millisecond || elapsed > 100*time.Millisecond+upstreamRetryBaseDelay+500*time.Millisecond {
+		t.Errorf("échec après %v, attendu un délai et un intervalle de nouvel essai", elapsed)
+	}
+}
+
+func TestEntrepriseRequestDeadline(t *testing.T) {
+	useSocieteProvider(t)
+	useFreshCompanyCache(t)
+	// L'appel partagé se poursuit au-delà de l'échéance (voir fetchShared) :
+	// délai court pour ne pas retarder la fermeture du serveur de test
+	useSocieteFixture(t, slowHandler(500*time.Millisecond))
+
+	// Échéance de la requête entrante (client déconnecté, délai du lot...)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	r := httptest.NewRequest(http.MethodGet, "/api/entreprise/552032534", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	start := time.Now()
+	entrepriseHandler(w, r)
+	if w.Code != http.StatusGatewayTimeout || decodeAPIError(t, w).Code != "UPSTREAM_TIMEOUT" {
+		t.Errorf("statut = %d (%s), attendu 504 UPSTREAM_TIMEOUT", w.Code, w.Body)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("réponse après %v, attendu l'échéance de la requête (100ms)", elapsed)
+	}
+
+	// Fin de l'appel partagé (mis en cache) avant de restaurer le fournisseur
+	// et le disjoncteur qu'il utilise
+	deadline := time.Now().Add(2 * time.Second)
+	for entrepriseCache.stats()["entries"] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("appel partagé jamais terminé")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIsUpstreamTimeout(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("appel API : %w", context.DeadlineExceeded), true},
+		{&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, true},
+		{context.Canceled, false},
+		{&upstreamStatusError{status: http.StatusBadGateway}, false},
+		{errEntrepriseIntrouvable, false},
+	}
+	for _, tt := range tests {
+		if got := isUpstreamTimeout(tt.err); got != tt.want {
+			t.Errorf("isUpstreamTimeout(%v) = %v, attendu %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSocieteRawResponseLogOptIn(t *testing.T) {
+	useSocieteFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"common":{"siren":"552032534","deno":"DENOMINATION-CONFIDENTIELLE"}}`))
+	})
+
+	for _, tt := range []struct {
+		level slog.Level
+		want  bool
+	}{
+		{slog.LevelInfo, false}, // niveau par défaut : corps jamais journalisé
+		{slog.LevelDebug, true}, // LOG_LEVEL=debug
+	} {
+		var buf bytes.Buffer
+		previous := slog.Default()
+		slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: tt.level})))
+		_, err := fetchSocieteExistData(context.Background(), "552032534", entrepriseFields{})
+		slog.SetDefault(previous)
+		if err != nil {
+			t.Fatalf("fetchSocieteExistData: %v", err)
+		}
+
+		logged := strings.Contains(buf.String(), "DENOMINATION-CONFIDENTIELLE")
+		if logged != tt.want {
+			t.Errorf("niveau %v : corps journalisé = %v, attendu %v\n%s", tt.level, logged, tt.want, buf.String())
+		}
+		if tt.want && !strings.Contains(buf.String(), "réponse API brute") {
+			t.Errorf("niveau %v : message « réponse API brute » absent", tt.level)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+)
+
+// --- TEMPLATES D'EMAIL ---
+
+// Un template "devis" se compose de fichiers dans TEMPLATES_DIR :
+//   devis.txt.tmpl      corps texte (obligatoire, text/template)
+//   devis.html.tmpl     corps HTML (optionnel, html/template)
+//   devis.subject.tmpl  sujet (optionnel si "subject" est fourni)
+
+var errTemplateNotFound = errors.New("template introuvable")
+
+// Noms de template acceptés (pas de chemin : ni "/", ni "..")
+var templateNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// templatesDir retourne le dossier des templates (TEMPLATES_DIR)
+func templatesDir() string {
+	if dir := getenv("TEMPLATES_DIR"); dir != "" {
+		return dir
+	}
+	return "templates"
+}
+
+// applyTemplate remplit Subject, Body et BodyHTML depuis le template
+// req.Template et ses variables. Une variable manquante est une erreur.
+func (req *EmailRequest) applyTemplate() error {
+	if !templateNameRe.MatchString(req.Template) {
+		return fmt.Errorf("%w : %q", errTemplateNotFound, req.Template)
+	}
+	base := filepath.Join(templatesDir(), req.Template)
+
+	body, err := renderTextTemplate(base+".txt.tmpl", req.Variables)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w : %q", errTemplateNotFound, req.Template)
+	}
+	if err != nil {
+		return err
+	}
+	req.Body = body
+
+	subject, err := renderTextTemplate(base+".subject.tmpl", req.Variables)
+	switch {
+	case err == nil:
+		req.Subject = strings.TrimSpace(subject)
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	html, err := renderHTMLTemplate(base+".html.tmpl", req.Variables)
+	switch {
+	case err == nil:
+		req.BodyHTML = html
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	return nil
+}
+
+func renderTextTemplate(path string, vars map[string]any) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := texttemplate.New(filepath.Base(path)).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return "", fmt.Errorf("template %s invalide : %v", filepath.Base(path), err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("template %s : %v", filepath.Base(path), err)
+	}
+	return buf.String(), nil
+}
+
+// renderHTMLTemplate échappe les variables (html/template) pour éviter
+// l'injection de HTML dans l'email
+func renderHTMLTemplate(path string, vars map[string]any) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := htmltemplate.New(filepath.Base(path)).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return "", fmt.Errorf("template %s invalide : %v", filepath.Base(path), err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("template %s : %v", filepath.Base(path), err)
+	}
+	return buf.String(), nil
+}
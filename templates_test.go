@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var devisVariables = map[string]any{"nom": "Mme Martin", "numero": "2026-042", "montant": "1 250,00"}
+
+func TestApplyTemplateDevis(t *testing.T) {
+	t.Setenv("TEMPLATES_DIR", "templates")
+
+	req := EmailRequest{Template: "devis", Variables: devisVariables}
+	if err := req.applyTemplate(); err != nil {
+		t.Fatalf("applyTemplate: %v", err)
+	}
+	if req.Subject != "Votre devis n°2026-042" {
+		t.Errorf("sujet = %q", req.Subject)
+	}
+	for _, want := range []string{"Bonjour Mme Martin,", "devis n°2026-042", "1 250,00 €"} {
+		if !strings.Contains(req.Body, want) {
+			t.Errorf("corps texte sans %q :\n%s", want, req.Body)
+		}
+	}
+	if !strings.Contains(req.BodyHTML, "<strong>1 250,00 €</strong>") {
+		t.Errorf("corps HTML inattendu :\n%s", req.BodyHTML)
+	}
+}
+
+func TestApplyTemplateErrors(t *testing.T) {
+	t.Setenv("TEMPLATES_DIR", "templates")
+
+	tests := []struct {
+		name      string
+		req       EmailRequest
+		notFound  bool
+		wantInErr string
+	}{
+		{"template absent", EmailRequest{Template: "facture", Variables: devisVariables}, true, "facture"},
+		{"chemin refusé", EmailRequest{Template: "../main", Variables: devisVariables}, true, "../main"},
+		{"variable manquante", EmailRequest{Template: "devis", Variables: map[string]any{"nom": "Mme Martin"}}, false, "numero"},
+	}
+	for _, tt := range tests {
+		err := tt.req.applyTemplate()
+		if err == nil {
+			t.Errorf("%s : aucune erreur", tt.name)
+			continue
+		}
+		if errors.Is(err, errTemplateNotFound) != tt.notFound {
+			t.Errorf("%s : err = %v, errTemplateNotFound attendu = %v", tt.name, err, tt.notFound)
+		}
+		if !strings.Contains(err.Error(), tt.wantInErr) {
+			t.Errorf("%s : err = %v, attendu une mention de %q", tt.name, err, tt.wantInErr)
+		}
+	}
+}
+
+func TestApplyTemplateEscapesHTML(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"alerte.txt.tmpl":  "Bonjour {{.nom}}",
+		"alerte.html.tmpl": "<p>Bonjour {{.nom}}</p>",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TEMPLATES_DIR", dir)
+
+	req := EmailRequest{Template: "alerte", Subject: "Alerte", Variables: map[string]any{"nom": `<script>alert(1)</script>`}}
+	if err := req.applyTemplate(); err != nil {
+		t.Fatalf("applyTemplate: %v", err)
+	}
+	if strings.Contains(req.BodyHTML, "<script>") {
+		t.Errorf("variable non échappée dans le HTML : %s", req.BodyHTML)
+	}
+	if req.Body != "Bonjour <script>alert(1)</script>" {
+		t.Errorf("corps texte = %q, attendu la variable telle quelle", req.Body)
+	}
+	// Sans template de sujet, le sujet fourni est conservé
+	if req.Subject != "Alerte" {
+		t.Errorf("sujet = %q, attendu Alerte", req.Subject)
+	}
+}
+
+func TestSendEmailTemplate(t *testing.T) {
+	t.Setenv("TEMPLATES_DIR", "templates")
+
+	body := emailJSON(t, map[string]any{"to": "client@exemple.fr", "template": "devis", "variables": devisVariables, "dry_run": true})
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	var resp EmailDryRunResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("réponse illisible: %v", err)
+	}
+	if got := resp.Headers["Subject"]; len(got) != 1 || !strings.Contains(got[0], "2026-042") {
+		t.Errorf("Subject = %v, attendu le sujet du template", got)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		vars     map[string]any
+		code     string
+	}{
+		{"template absent", "facture", devisVariables, "TEMPLATE_NOT_FOUND"},
+		{"variable manquante", "devis", map[string]any{"nom": "Mme Martin"}, "TEMPLATE_RENDER_FAILED"},
+	}
+	for _, tt := range tests {
+		body := emailJSON(t, map[string]any{"to": "client@exemple.fr", "template": tt.template, "variables": tt.vars, "dry_run": true})
+		w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s : statut = %d, attendu 400", tt.name, w.Code)
+			continue
+		}
+		if got := decodeAPIError(t, w).Code; got != tt.code {
+			t.Errorf("%s : code = %q, attendu %q", tt.name, got, tt.code)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+)
+
+// --- VALIDATION D'ADRESSE EMAIL ---
+
+// Réponse de GET /api/email/validate
+type EmailValidationResponse struct {
+	Address string `json:"address"`
+	Valid   bool   `json:"valid"`
+	HasMX   *bool  `json:"has_mx,omitempty"` // Uniquement avec ?check_mx=true
+	Reason  string `json:"reason,omitempty"`
+}
+
+// emailValidateHandler vérifie une adresse sans envoyer d'email (formulaires) :
+// syntaxe, et avec ?check_mx=true existence d'un serveur de messagerie
+func emailValidateHandler(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	address := strings.TrimSpace(r.URL.Query().Get("address"))
+	if address == "" {
+		writeError(w, http.StatusBadRequest, "MISSING_ADDRESS", "Le paramètre 'address' est requis")
+		return
+	}
+
+	resp := EmailValidationResponse{Address: address}
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		resp.Reason = "Syntaxe d'adresse email invalide"
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	resp.Address = parsed.Address
+	resp.Valid = true
+
+	if r.URL.Query().Get("check_mx") == "true" {
+		domain := addressDomain(parsed.Address)
+		err := recipientMXChecker.check(r.Context(), domain)
+		switch {
+		case errors.Is(err, errNoMX):
+			hasMX := false
+			resp.HasMX = &hasMX
+			resp.Valid = false
+			resp.Reason = "Le domaine '" + domain + "' n'accepte pas d'emails (ni MX ni adresse IP, ou null MX)"
+		case err != nil:
+			// Erreur DNS temporaire : résultat MX inconnu, has_mx omis
+			logger.Warn("vérification MX impossible", "domain", domain, "error", err)
+			resp.Reason = "Vérification MX impossible pour le moment"
+		default:
+			hasMX := true
+			resp.HasMX = &hasMX
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func decodeValidation(t *testing.T, w *httptest.ResponseRecorder) EmailValidationResponse {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	var resp EmailValidationResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("réponse illisible: %v", err)
+	}
+	return resp
+}
+
+func TestEmailValidate(t *testing.T) {
+	resolver := useFakeResolver(t)
+
+	validate := func(address, query string) EmailValidationResponse {
+		return decodeValidation(t, serve(emailValidateHandler, http.MethodGet, "/api/email/validate?address="+url.QueryEscape(address)+query, ""))
+	}
+
+	// Adresse correcte, sans vérification MX : aucune requête DNS
+	resp := validate(" Client <client@exemple.fr> ", "")
+	if !resp.Valid || resp.Address != "client@exemple.fr" || resp.HasMX != nil || resp.Reason != "" {
+		t.Errorf("adresse correcte = %+v", resp)
+	}
+	if n := resolver.lookupCount(); n != 0 {
+		t.Errorf("%d requêtes DNS sans check_mx", n)
+	}
+
+	// Syntaxe invalide
+	resp = validate("client@@exemple", "&check_mx=true")
+	if resp.Valid || resp.HasMX != nil || resp.Reason == "" {
+		t.Errorf("syntaxe invalide = %+v, attendu invalide avec une raison", resp)
+	}
+
+	// Domaine avec et sans MX
+	resp = validate("client@exemple.fr", "&check_mx=true")
+	if !resp.Valid || resp.HasMX == nil || !*resp.HasMX {
+		t.Errorf("domaine avec MX = %+v, attendu valide et has_mx true", resp)
+	}
+	resp = validate("client@gmial.com", "&check_mx=true")
+	if resp.Valid || resp.HasMX == nil || *resp.HasMX || resp.Reason == "" {
+		t.Errorf("domaine sans MX = %+v, attendu invalide et has_mx false", resp)
+	}
+
+	// Erreur DNS temporaire : syntaxe valide, has_mx inconnu
+	resp = validate("client@dns-en-panne.fr", "&check_mx=true")
+	if !resp.Valid || resp.HasMX != nil || resp.Reason == "" {
+		t.Errorf("DNS en panne = %+v, attendu valide sans has_mx", resp)
+	}
+}
+
+func TestEmailValidateErrors(t *testing.T) {
+	w := serve(emailValidateHandler, http.MethodGet, "/api/email/validate", "")
+	if w.Code != http.StatusBadRequest || decodeAPIError(t, w).Code != "MISSING_ADDRESS" {
+		t.Errorf("sans adresse : statut = %d (%s), attendu 400 MISSING_ADDRESS", w.Code, w.Body)
+	}
+	if w := serve(emailValidateHandler, http.MethodPost, "/api/email/validate?address=a@exemple.fr", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST : statut = %d, attendu 405", w.Code)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strings"
+)
+
+// --- VALIDATION DES REQUÊTES ---
+
+// Règles disponibles dans le tag `validate` (séparées par des virgules) :
+//   - required   : champ non vide
+//   - email      : une adresse email (nom affiché accepté)
+//   - emaillist  : une ou plusieurs adresses séparées par des virgules
+//   - singleline : sans CR/LF (valeur recopiée dans un en-tête MIME)
+//
+// Les champs vides ne sont soumis qu'à la règle required. Les slices de
+// structures sont validées élément par élément (ex: "attachments[0].name").
+
+// FieldError décrit un champ invalide de la requête
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// validateStruct applique les règles `validate` de v (structure ou pointeur
+// de structure) et retourne toutes les erreurs, pas seulement la première
+func validateStruct(v any) []FieldError {
+	var errs []FieldError
+	validateValue(reflect.Indirect(reflect.ValueOf(v)), "", &errs)
+	return errs
+}
+
+func validateValue(v reflect.Value, prefix string, errs *[]FieldError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := prefix + jsonFieldName(field)
+		value := v.Field(i)
+
+		// Éléments d'une liste de structures (pièces jointes, images)
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Struct {
+			for j := 0; j < value.Len(); j++ {
+				validateValue(value.Index(j), fmt.Sprintf("%s[%d].", name, j), errs)
+			}
+			continue
+		}
+
+		rules := field.Tag.Get("validate")
+		if rules == "" || value.Kind() != reflect.String {
+			continue
+		}
+		if fe, ok := checkRules(name, value.String(), strings.Split(rules, ",")); !ok {
+			*errs = append(*errs, fe)
+		}
+	}
+}
+
+// checkRules retourne la première règle non respectée par un champ
+func checkRules(name, value string, rules []string) (FieldError, bool) {
+	for _, rule := range rules {
+		switch rule {
+		case "required":
+			if strings.TrimSpace(value) == "" {
+				return FieldError{name, "MISSING_FIELD", fmt.Sprintf("Le champ '%s' est requis", name)}, false
+			}
+		case "singleline":
+			if strings.ContainsAny(value, "\r\n") {
+				return FieldError{name, "INVALID_HEADER_VALUE", fmt.Sprintf("Le champ '%s' ne doit pas contenir de retour à la ligne", name)}, false
+			}
+		case "email":
+			if value == "" {
+				continue
+			}
+			if _, err := mail.ParseAddress(value); err != nil {
+				return FieldError{name, "INVALID_EMAIL_ADDRESS", fmt.Sprintf("Le champ '%s' n'est pas une adresse email valide : %q", name, value)}, false
+			}
+		case "emaillist":
+			if value == "" {
+				continue
+			}
+			if _, err := mail.ParseAddressList(value); err != nil {
+				return FieldError{name, "INVALID_EMAIL_ADDRESS", fmt.Sprintf("Le champ '%s' n'est pas une liste d'adresses email valide : %q", name, value)}, false
+			}
+		}
+	}
+	return FieldError{}, true
+}
+
+// jsonFieldName retourne le nom JSON d'un champ (nom Go à défaut)
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// writeValidationError répond 400 avec la liste des champs invalides
+func writeValidationError(w http.ResponseWriter, errs []FieldError) {
+	writeAPIError(w, http.StatusBadRequest, APIError{
+		Code:    "VALIDATION_FAILED",
+		Message: fmt.Sprintf("Requête invalide : %d champ(s) en erreur", len(errs)),
+		Details: map[string]any{"fields": errs},
+	})
+}
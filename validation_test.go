@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateStructAddresses(t *testing.T) {
+	tests := []struct {
+		name string
+		req  EmailRequest
+		want string // champ en erreur, vide si valide
+	}{
+		{"adresse simple", EmailRequest{To: "client@exemple.fr"}, ""},
+		{"nom affiché", EmailRequest{To: `"Élodie Martin" <elodie@exemple.fr>`}, ""},
+		{"liste", EmailRequest{To: "a@exemple.fr, Bob <b@exemple.fr>"}, ""},
+		{"reply_to avec nom", EmailRequest{To: "a@exemple.fr", ReplyTo: "Service client <sav@exemple.fr>"}, ""},
+		{"sans arobase", EmailRequest{To: "not-an-email"}, "to"},
+		{"domaine manquant", EmailRequest{To: "client@"}, "to"},
+		{"chevron ouvert", EmailRequest{To: "Bob <b@exemple.fr"}, "to"},
+		{"liste avec une adresse invalide", EmailRequest{To: "a@exemple.fr, pas une adresse"}, "to"},
+		{"cc invalide", EmailRequest{To: "a@exemple.fr", Cc: "@@"}, "cc"},
+		{"bcc invalide", EmailRequest{To: "a@exemple.fr", Bcc: "b@"}, "bcc"},
+		{"reply_to invalide", EmailRequest{To: "a@exemple.fr", ReplyTo: "sav"}, "reply_to"},
+		{"reply_to multiple", EmailRequest{To: "a@exemple.fr", ReplyTo: "a@exemple.fr, b@exemple.fr"}, "reply_to"},
+	}
+	for _, tt := range tests {
+		tt.req.Subject, tt.req.Body = "Sujet", "Corps"
+		errs := validateStruct(tt.req)
+		switch {
+		case tt.want == "" && len(errs) > 0:
+			t.Errorf("%s : erreurs inattendues %+v", tt.name, errs)
+		case tt.want != "" && (len(errs) != 1 || errs[0].Field != tt.want || errs[0].Code != "INVALID_EMAIL_ADDRESS"):
+			t.Errorf("%s : erreurs = %+v, attendu INVALID_EMAIL_ADDRESS sur %q", tt.name, errs, tt.want)
+		}
+	}
+}
+
+func TestSendEmailRejectsInvalidAddress(t *testing.T) {
+	w := serve(sendEmailHandler, http.MethodPost, "/api/email/send", `{"to":"not-an-email","subject":"Devis","body":"Bonjour"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("statut = %d, attendu 400", w.Code)
+	}
+	apiErr := decodeAPIError(t, w)
+	fields, _ := apiErr.Details.(map[string]any)["fields"].([]any)
+	if apiErr.Code != "VALIDATION_FAILED" || len(fields) != 1 {
+		t.Fatalf("réponse = %+v, attendu VALIDATION_FAILED sur un champ", apiErr)
+	}
+	if field := fields[0].(map[string]any); field["field"] != "to" || field["code"] != "INVALID_EMAIL_ADDRESS" {
+		t.Errorf("erreur de champ = %v, attendu INVALID_EMAIL_ADDRESS sur 'to'", field)
+	}
+}
+
+func TestSendEmailRejectsNewlinesInHeaderFields(t *testing.T) {
+	tests := []struct {
+		field string
+		req   map[string]any
+	}{
+		{"to", map[string]any{"to": "client@exemple.fr\r\nBcc: victime@exemple.fr"}},
+		{"subject", map[string]any{"subject": "Devis\r\nBcc: victime@exemple.fr"}},
+		{"subject", map[string]any{"subject": "Devis\nX-Injecte: 1"}},
+		{"attachment_name", map[string]any{"attachment_name": "devis.pdf\r\nContent-Type: text/html", "attachment_data": "JVBERi0="}},
+		{"attachments[0].name", map[string]any{"attachments": []any{map[string]any{"name": "devis\r.pdf", "data": "JVBERi0="}}}},
+	}
+	for _, tt := range tests {
+		req := map[string]any{"to": "client@exemple.fr", "subject": "Devis", "body": "Bonjour", "dry_run": true}
+		for k, v := range tt.req {
+			req[k] = v
+		}
+		w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", emailJSON(t, req))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s : statut = %d (%s), attendu 400", tt.field, w.Code, w.Body)
+			continue
+		}
+		apiErr := decodeAPIError(t, w)
+		fields, _ := apiErr.Details.(map[string]any)["fields"].([]any)
+		if apiErr.Code != "VALIDATION_FAILED" || len(fields) != 1 {
+			t.Errorf("%s : réponse = %+v, attendu VALIDATION_FAILED sur un champ", tt.field, apiErr)
+			continue
+		}
+		if field := fields[0].(map[string]any); field["field"] != tt.field || field["code"] != "INVALID_HEADER_VALUE" {
+			t.Errorf("%s : erreur de champ = %v, attendu INVALID_HEADER_VALUE", tt.field, field)
+		}
+	}
+}
+
+func TestNamedRecipientNewlineIsEncoded(t *testing.T) {
+	// Un CR/LF dans le nom affiché d'un destinataire objet est encodé en
+	// RFC 2047 : aucun en-tête ne peut être injecté
+	body := `{"to":[{"name":"Client\r\nBcc: victime@exemple.fr","address":"client@exemple.fr"}],"subject":"Devis","body":"Bonjour","dry_run":true}`
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("statut = %d (%s), attendu 200", w.Code, w.Body)
+	}
+	var resp EmailDryRunResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resp.Headers["Bcc"]; ok || len(resp.Headers["To"]) != 1 || strings.ContainsAny(resp.Headers["To"][0], "\r\n") {
+		t.Errorf("en-têtes = %v, attendu un seul To encodé et aucun Bcc", resp.Headers)
+	}
+}
+
+func TestSendEmailReportsAllInvalidFields(t *testing.T) {
+	s := useFakeSMTP(t)
+	body := `{
+		"to": "pas une adresse",
+		"subject": "",
+		"reply_to": "sav",
+		"attachments": [{"name": "devis.pdf", "data": "JVBERi0="}, {"name": "a\nb.pdf", "data": "JVBERi0="}]
+	}`
+	w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", body)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("statut = %d (%s), attendu 400", w.Code, w.Body)
+	}
+	apiErr := decodeAPIError(t, w)
+	if apiErr.Code != "VALIDATION_FAILED" {
+		t.Fatalf("code = %q, attendu VALIDATION_FAILED", apiErr.Code)
+	}
+
+	fields, _ := apiErr.Details.(map[string]any)["fields"].([]any)
+	want := []struct{ field, code string }{
+		{"to", "INVALID_EMAIL_ADDRESS"},
+		{"subject", "MISSING_FIELD"},
+		{"body", "MISSING_FIELD"},
+		{"reply_to", "INVALID_EMAIL_ADDRESS"},
+		{"attachments[1].name", "INVALID_HEADER_VALUE"},
+	}
+	if len(fields) != len(want) {
+		t.Fatalf("%d champs en erreur, attendu %d : %v", len(fields), len(want), fields)
+	}
+	for i, f := range fields {
+		got := f.(map[string]any)
+		if got["field"] != want[i].field || got["code"] != want[i].code || got["message"] == "" {
+			t.Errorf("erreur %d = %v, attendu %s sur %q", i, got, want[i].code, want[i].field)
+		}
+	}
+	if !strings.Contains(apiErr.Message, "5 champ(s)") {
+		t.Errorf("message = %q", apiErr.Message)
+	}
+	if n := s.connCount(); n != 0 {
+		t.Errorf("%d connexions SMTP pour une requête invalide", n)
+	}
+}
+
+func TestSendEmailRejectsUnknownField(t *testing.T) {
+	s := useFakeSMTP(t)
+	tests := []struct {
+		body  string
+		field string
+	}{
+		{`{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour","attachment_name":"devis.pdf","attachement_data":"JVBERi0="}`, "attachement_data"},
+		{`{"to":"client@exemple.fr","subject":"Devis","body":"Bonjour","attachments":[{"nom":"devis.pdf","data":"JVBERi0="}]}`, "nom"},
+	}
+	for _, tt := range tests {
+		w := serve(sendEmailHandler, http.MethodPost, "/api/send-email", tt.body)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("statut = %d (%s), attendu 400", w.Code, w.Body)
+		}
+		apiErr := decodeAPIError(t, w)
+		details, _ := apiErr.Details.(map[string]any)
+		if apiErr.Code != "UNKNOWN_FIELD" || details["field"] != tt.field || !strings.Contains(apiErr.Message, tt.field) {
+			t.Errorf("réponse = %+v, attendu UNKNOWN_FIELD sur %q", apiErr, tt.field)
+		}
+	}
+	if n := s.connCount(); n != 0 {
+		t.Errorf("%d connexions SMTP malgré un champ inconnu", n)
+	}
+}